@@ -2,116 +2,324 @@ package commands
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/eldada/metrics-viewer/expression"
 	"github.com/eldada/metrics-viewer/provider"
 	"github.com/jfrog/jfrog-cli-core/v2/common/commands"
 	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
 )
 
-var FileFlag = components.NewStringFlag("file", "Log file with the open metrics format")
+var FileFlag = components.NewStringFlag("file", "Log file with the open metrics format, or a glob of rotated log files to read in order before following the live one, "+
+	"e.g. 'artifactory-metrics*.log*'. Comma delimited list for multiple files, each optionally named using name=file")
 
-var UrlFlag = components.NewStringFlag("url", "Url endpoint to use to get metrics")
+var UrlFlag = components.NewStringFlag("url", "Url endpoint to use to get metrics. Comma delimited list for multiple urls, each optionally named using name=url")
 
-var UserFlag = components.NewStringFlag("user", "Username for url requiring authentication (see --password)")
+var PrometheusFlag = components.NewStringFlag("prometheus", "Url of a Prometheus compatible HTTP API to query the metrics from, e.g. 'http://localhost:9090', "+
+	"using the same credentials and TLS options as --url. The queried series are selected by --filter. Comma delimited list for multiple urls, each optionally named using name=url")
 
-var PasswordFlag = components.NewStringFlag("password", "Password for url requiring authentication (see --user)")
+var UserFlag = components.NewStringFlag("user", "Username for urls and the remote write endpoint requiring authentication (see --password)")
 
-var TokenFlag = components.NewStringFlag("token", "Access token for url requiring authentication")
+var PasswordFlag = components.NewStringFlag("password", "Password for urls and the remote write endpoint requiring authentication (see --user)")
 
-var ServerFlag = components.NewStringFlag("server-id", "Artifactory server ID to use from JFrog CLI configuration (use default if not set)")
+var PasswordFileFlag = components.NewStringFlag("password-file", "File holding the password for urls and the remote write endpoint requiring authentication, read again whenever it changes (see --user). "+
+	"The password can also be set by the "+PasswordEnv+" environment variable")
+
+var TokenFlag = components.NewStringFlag("token", "Access token for urls and the remote write endpoint requiring authentication")
+
+var TokenFileFlag = components.NewStringFlag("token-file", "File holding the access token for urls and the remote write endpoint requiring authentication, read again whenever it changes. "+
+	"The token can also be set by the "+TokenEnv+" environment variable")
+
+var HeaderFlag = components.NewStringFlag("header", "Header to add to the requests to urls and the remote write endpoint, in the form name=value, e.g. 'X-Api-Key=abc'. Comma delimited list for multiple headers, escaping the commas of the values as '\\,'")
+
+var OAuth2TokenUrlFlag = components.NewStringFlag("oauth2-token-url", "Token url of an OAuth2 server, to get access tokens for urls and the remote write endpoint using the client credentials grant "+
+	"(see --oauth2-client-id and --oauth2-client-secret)")
+
+var OAuth2ClientIdFlag = components.NewStringFlag("oauth2-client-id", "OAuth2 client ID (see --oauth2-token-url)")
+
+var OAuth2ClientSecretFlag = components.NewStringFlag("oauth2-client-secret", "OAuth2 client secret (see --oauth2-token-url). "+
+	"The secret can also be set by the "+OAuth2ClientSecretEnv+" environment variable")
+
+var OAuth2ScopesFlag = components.NewStringFlag("oauth2-scopes", "Comma delimited list of scopes to request for the OAuth2 access tokens (see --oauth2-token-url)")
+
+var ServerFlag = components.NewStringFlag("server-id", "Artifactory server ID to use from JFrog CLI configuration (use default if no other source is set). Comma delimited list for multiple server IDs. "+
+	"Metrics of multiple sources are labeled with the source name as '"+provider.InstanceLabel+"'")
+
+var ProductsFlag = components.NewStringFlag("products", "Comma delimited list of the JFrog products to get the metrics of from each server of --server-id (available: artifactory, xray, distribution, access). "+
+	"Their metrics are labeled with the product as '"+provider.ProductLabel+"', and the sources are named with the product as <server>/<product> when there are multiple products")
+
+var CACertFlag = components.NewStringFlag("ca-cert", "PEM file of the certificate authorities to trust for url sources and the remote write endpoint, instead of the system ones")
+
+var ClientCertFlag = components.NewStringFlag("client-cert", "PEM file of the client certificate for url sources and the remote write endpoint requiring mutual TLS (see --client-key)")
+
+var ClientKeyFlag = components.NewStringFlag("client-key", "PEM file of the private key of the client certificate (see --client-cert)")
+
+var InsecureSkipVerifyFlag = components.NewBoolFlag("insecure-skip-verify", "Skip the verification of the certificates of url sources and the remote write endpoint. Insecure, use for testing only")
+
+var TLSServerNameFlag = components.NewStringFlag("tls-server-name", "Server name to verify the certificates of url sources and the remote write endpoint against, instead of the url host")
+
+var TimeoutFlag = components.StringFlag{
+	BaseFlag:     components.NewFlag("timeout", "Timeout in seconds of each request to a url, server or remote write endpoint"),
+	DefaultValue: "10",
+}
+
+var RetriesFlag = components.StringFlag{
+	BaseFlag:     components.NewFlag("retries", "Number of times to retry a failed request to a url, server or remote write endpoint, waiting exponentially longer before each retry"),
+	DefaultValue: "2",
+}
 
 var IntervalFlag = components.StringFlag{
 	BaseFlag:     components.NewFlag("interval", "Scraping interval in seconds"),
 	DefaultValue: "5",
 }
 
-var FilterFlag = components.NewStringFlag("filter", "Regular expression to use for filtering the metrics")
+var FilterFlag = components.NewStringFlag("filter", "Regular expression to use for filtering the metrics, or a selector of metric name and labels, e.g. 'name{label=\"x\",other=~\"y.*\",bad!=\"z\"}'")
 
 var AggregateIgnoreLabelsFlag = components.StringFlag{
 	BaseFlag:     components.NewFlag("aggregate-ignore-labels", "Comma delimited list of labels to ignore when aggregating metrics. Use 'ALL' or 'NONE' to ignore all or none of the labels."),
 	DefaultValue: "start,end,status",
 }
 
+var AggregateFuncFlag = components.StringFlag{
+	BaseFlag:     components.NewFlag("aggregate-func", "Function to combine values of metrics aggregated by ignoring labels (available: sum, avg, min, max, count)"),
+	DefaultValue: string(provider.AggregateSum),
+}
+
+var ExpressionsFlag = components.NewStringFlag("expr", "Derived metric to add, in the form name=expression using a subset of PromQL, e.g. 'heap_used=jfrt_runtime_heap_maxmemory_bytes - jfrt_runtime_heap_freememory_bytes'. "+
+	"Comma delimited list for multiple derived metrics")
+
+var ReplayFlag = components.NewStringFlag("replay", "Recording made by the record command to replay instead of scraping. Cannot be used with other sources")
+
+var ReplaySpeedFlag = components.StringFlag{
+	BaseFlag:     components.NewFlag("replay-speed", "Speed of the replay relative to the recording, e.g. 10 replays 10 times faster (see --replay)"),
+	DefaultValue: "1",
+}
+
 func getCommonFlags() []components.Flag {
-	return []components.Flag{
+	flags := append([]components.Flag{
 		FileFlag,
 		UrlFlag,
-		UserFlag,
-		PasswordFlag,
-		TokenFlag,
+	}, getUrlRequestFlags()...)
+	return append(flags,
 		ServerFlag,
+		ProductsFlag,
+		TimeoutFlag,
+		RetriesFlag,
 		IntervalFlag,
 		FilterFlag,
 		AggregateIgnoreLabelsFlag,
+		AggregateFuncFlag,
+		ExpressionsFlag,
+		ReplayFlag,
+		ReplaySpeedFlag,
+	)
+}
+
+// getUrlRequestFlags returns the flags of the credentials, headers and TLS options of the requests to url sources
+func getUrlRequestFlags() []components.Flag {
+	return []components.Flag{
+		UserFlag,
+		PasswordFlag,
+		PasswordFileFlag,
+		TokenFlag,
+		TokenFileFlag,
+		HeaderFlag,
+		OAuth2TokenUrlFlag,
+		OAuth2ClientIdFlag,
+		OAuth2ClientSecretFlag,
+		OAuth2ScopesFlag,
+		CACertFlag,
+		ClientCertFlag,
+		ClientKeyFlag,
+		InsecureSkipVerifyFlag,
+		TLSServerNameFlag,
 	}
 }
 
 type commonConfiguration struct {
-	file                  string
-	urlMetricsFetcher     provider.UrlMetricsFetcher
+	sources               []provider.Source
 	interval              time.Duration
 	filter                *regexp.Regexp
+	selector              *provider.Selector
 	aggregateIgnoreLabels provider.StringSet
+	aggregateFunc         provider.AggregateFunc
+	expressions           []*expression.Expression
+	retryPolicy           provider.RetryPolicy
+	httpClient            *http.Client
+	authenticator         provider.Authenticator
 }
 
-func (c commonConfiguration) UrlMetricsFetcher() provider.UrlMetricsFetcher {
-	return c.urlMetricsFetcher
-}
-
-func (c commonConfiguration) File() string {
-	return c.file
+func (c commonConfiguration) Sources() []provider.Source {
+	return c.sources
 }
 
 func (c commonConfiguration) Interval() time.Duration {
 	return c.interval
 }
 
+// RetryPolicy bounds the requests to the url and server sources, and to the remote write endpoint
+func (c commonConfiguration) RetryPolicy() provider.RetryPolicy {
+	return c.retryPolicy
+}
+
+// HttpClient is the client of the url and prometheus sources, and of the remote write endpoint, with the TLS options
+func (c commonConfiguration) HttpClient() *http.Client {
+	return c.httpClient
+}
+
+// Authenticator authorizes the requests to the url and prometheus sources, and to the remote write endpoint, nil if none
+func (c commonConfiguration) Authenticator() provider.Authenticator {
+	return c.authenticator
+}
+
 func (c commonConfiguration) Filter() *regexp.Regexp {
 	return c.filter
 }
 
+func (c commonConfiguration) Selector() *provider.Selector {
+	return c.selector
+}
+
 func (c commonConfiguration) AggregateIgnoreLabels() provider.StringSet {
 	return c.aggregateIgnoreLabels
 }
 
+func (c commonConfiguration) AggregateFunc() provider.AggregateFunc {
+	return c.aggregateFunc
+}
+
+func (c commonConfiguration) Expressions() []*expression.Expression {
+	return c.expressions
+}
+
+// isReplay returns whether the metrics are replayed from a recording
+func (c commonConfiguration) isReplay() bool {
+	return len(c.sources) == 1 && c.sources[0].Replay != ""
+}
+
 func (c commonConfiguration) String() string {
-	return fmt.Sprintf("file: '%s', %s, interval: %s, filter: %s",
-		c.file, c.urlMetricsFetcher, c.interval, c.filter.String())
+	filter := ""
+	if c.selector != nil {
+		filter = c.selector.String()
+	} else if c.filter != nil {
+		filter = c.filter.String()
+	}
+	sources := make([]string, 0, len(c.sources))
+	for _, source := range c.sources {
+		sources = append(sources, source.String())
+	}
+	return fmt.Sprintf("sources: [%s], interval: %s, filter: %s",
+		strings.Join(sources, "; "), c.interval, filter)
 }
 
 func parseCommonConfig(c cliContext) (*commonConfiguration, error) {
-	conf := commonConfiguration{
-		file: c.GetStringFlagValue("file"),
+	conf := commonConfiguration{}
+
+	for _, value := range getStringFlagValues(c, "file") {
+		name, file := parseNamedSource(value, filepath.Base(value))
+		if provider.IsLogFilesPattern(file) {
+			archives, live, err := provider.RotatedLogFiles(file)
+			if err != nil {
+				return nil, err
+			}
+			if name == filepath.Base(value) && live != "" {
+				name = filepath.Base(live)
+			}
+			conf.sources = append(conf.sources, provider.Source{Name: name, File: live, Archives: archives})
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("could not open file %s: %w", file, err)
+		}
+		_ = f.Close()
+		conf.sources = append(conf.sources, provider.Source{Name: name, File: file})
 	}
-	url := c.GetStringFlagValue("url")
 
-	countInputFlags := 0
-	if conf.file != "" {
-		countInputFlags++
+	retryPolicy, err := parseRetryPolicy(c)
+	if err != nil {
+		return nil, err
 	}
-	if url != "" {
-		countInputFlags++
+	conf.retryPolicy = retryPolicy
+
+	tlsOptions := provider.TLSOptions{
+		CACert:             c.GetStringFlagValue("ca-cert"),
+		ClientCert:         c.GetStringFlagValue("client-cert"),
+		ClientKey:          c.GetStringFlagValue("client-key"),
+		InsecureSkipVerify: c.GetBoolFlagValue("insecure-skip-verify"),
+		ServerName:         c.GetStringFlagValue("tls-server-name"),
+	}
+	client, err := provider.NewHttpClient(tlsOptions)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := parseAuthenticator(c, client)
+	if err != nil {
+		return nil, err
+	}
+	conf.httpClient = client
+	conf.authenticator = authenticator
+
+	urls := getStringFlagValues(c, "url")
+	prometheusUrls := getStringFlagValues(c, "prometheus")
+	for _, value := range urls {
+		name, endpoint := parseNamedSource(value, hostOf(value))
+		conf.sources = append(conf.sources, provider.Source{
+			Name:              name,
+			UrlMetricsFetcher: provider.NewUrlMetricsFetcher(endpoint, client, authenticator, retryPolicy),
+		})
+	}
+	match := prometheusMatch(c.GetStringFlagValue("filter"))
+	for _, value := range prometheusUrls {
+		name, endpoint := parseNamedSource(value, hostOf(value))
+		conf.sources = append(conf.sources, provider.Source{
+			Name:       name,
+			Prometheus: provider.NewPrometheusAPI(endpoint, match, client, authenticator, retryPolicy),
+		})
 	}
 
-	if countInputFlags > 1 {
-		return nil, fmt.Errorf("only zero or one flag is required: --file | --url")
+	serverIds := getStringFlagValues(c, "server-id")
+	products, err := parseProducts(c)
+	if err != nil {
+		return nil, err
 	}
 
-	if conf.file != "" {
-		f, err := os.Open(conf.file)
+	if replay := c.GetStringFlagValue("replay"); replay != "" {
+		if len(conf.sources) > 0 || len(serverIds) > 0 {
+			return nil, fmt.Errorf("cannot use --replay with other sources")
+		}
+		flagValue := c.GetStringFlagValue("replay-speed")
+		speed, err := strconv.ParseFloat(flagValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse replay speed value: %s; cause: %w", flagValue, err)
+		}
+		if speed <= 0 {
+			return nil, fmt.Errorf("replay speed value must be positive; got: %s", flagValue)
+		}
+		f, err := os.Open(replay)
 		if err != nil {
-			return nil, fmt.Errorf("could not open file %s: %w", conf.file, err)
+			return nil, fmt.Errorf("could not open recording %s: %w", replay, err)
 		}
 		_ = f.Close()
+		conf.sources = append(conf.sources, provider.Source{Name: filepath.Base(replay), Replay: replay, ReplaySpeed: speed})
 	}
 
-	if countInputFlags == 0 {
-		serverId := c.GetStringFlagValue("server-id")
+	if len(products) > 0 && len(serverIds) == 0 && len(conf.sources) > 0 {
+		return nil, fmt.Errorf("--products applies only to servers; use it with --server-id")
+	}
+	if len(serverIds) == 0 && len(conf.sources) == 0 {
+		// Use the default server
+		serverIds = []string{""}
+	}
+	for _, value := range serverIds {
+		name, serverId := parseNamedSource(value, value)
 		rtDetails, err := commands.GetConfig(serverId, false)
 		if err != nil {
 			msg := fmt.Sprintf("could not load configuration for Artifactory server %s", serverId)
@@ -120,37 +328,39 @@ func parseCommonConfig(c cliContext) (*commonConfiguration, error) {
 			}
 			return nil, fmt.Errorf("%s; cause: %w", msg, err)
 		}
-		conf.urlMetricsFetcher, err = provider.NewArtifactoryMetricsFetcher(rtDetails)
-		if err != nil {
-			return nil, fmt.Errorf("could not initiate metrics fetcher from Artifactory; cause: %w", err)
+		if name == "" {
+			name = rtDetails.ServerId
 		}
-	}
-
-	if url != "" {
-		var authenticator provider.Authenticator
-		username := c.GetStringFlagValue("user")
-		password := c.GetStringFlagValue("password")
-		if username != "" {
-			authenticator = provider.UserPassAuthenticator{
-				Username: username,
-				Password: password,
+		if len(products) == 0 {
+			urlMetricsFetcher, err := provider.NewArtifactoryMetricsFetcher(rtDetails, retryPolicy)
+			if err != nil {
+				return nil, fmt.Errorf("could not initiate metrics fetcher from Artifactory; cause: %w", err)
 			}
+			conf.sources = append(conf.sources, provider.Source{Name: name, UrlMetricsFetcher: urlMetricsFetcher})
+			continue
 		}
-		token := c.GetStringFlagValue("token")
-		if token != "" {
-			if authenticator != nil {
-				return nil, fmt.Errorf("cannot use both user-password credentials and an access token; choose one")
+		for _, product := range products {
+			urlMetricsFetcher, err := provider.NewProductMetricsFetcher(rtDetails, product, retryPolicy)
+			if err != nil {
+				return nil, fmt.Errorf("could not initiate metrics fetcher from %s; cause: %w", product, err)
 			}
-			authenticator = provider.AccessTokenAuthenticator{
-				Token: token,
+			productName := name
+			if len(products) > 1 {
+				productName = name + "/" + string(product)
 			}
+			conf.sources = append(conf.sources, provider.Source{Name: productName, UrlMetricsFetcher: urlMetricsFetcher})
 		}
-		conf.urlMetricsFetcher = provider.NewUrlMetricsFetcher(url, authenticator)
 	}
 
-	var flagValue string
+	names := map[string]bool{}
+	for _, source := range conf.sources {
+		if names[source.Name] {
+			return nil, fmt.Errorf("duplicate source name: %s; name the sources explicitly using name=value", source.Name)
+		}
+		names[source.Name] = true
+	}
 
-	flagValue = c.GetStringFlagValue("interval")
+	flagValue := c.GetStringFlagValue("interval")
 	intValue, err := strconv.ParseInt(flagValue, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse interval value: %s; cause: %w", flagValue, err)
@@ -161,7 +371,12 @@ func parseCommonConfig(c cliContext) (*commonConfiguration, error) {
 	conf.interval = time.Duration(intValue) * time.Second
 
 	flagValue = c.GetStringFlagValue("filter")
-	if flagValue != "" {
+	if provider.IsSelector(flagValue) {
+		conf.selector, err = provider.ParseSelector(flagValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter selector; cause: %w", err)
+		}
+	} else if flagValue != "" {
 		conf.filter, err = regexp.Compile(flagValue)
 		if err != nil {
 			return nil, fmt.Errorf("invalid filter expression; cause: %w", err)
@@ -174,9 +389,282 @@ func parseCommonConfig(c cliContext) (*commonConfiguration, error) {
 		conf.aggregateIgnoreLabels.Add(strings.Split(flagValue, ",")...)
 	}
 
+	flagValue = c.GetStringFlagValue("aggregate-func")
+	if flagValue == "" {
+		conf.aggregateFunc = provider.AggregateSum
+	} else if aggregateFunc, ok := provider.SupportedAggregateFuncs[flagValue]; ok {
+		conf.aggregateFunc = aggregateFunc
+	} else {
+		return nil, fmt.Errorf("unknown aggregate function: %s", flagValue)
+	}
+
+	conf.expressions, err = expression.ParseList(getStringFlagValues(c, "expr"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --expr value; cause: %w", err)
+	}
+
 	return &conf, nil
 }
 
+// Environment variables holding secrets, so they are not passed on the command line where they leak to the shell history
+const (
+	PasswordEnv           = "METRICS_VIEWER_PASSWORD"
+	TokenEnv              = "METRICS_VIEWER_TOKEN"
+	OAuth2ClientSecretEnv = "METRICS_VIEWER_OAUTH2_CLIENT_SECRET"
+)
+
+// parseAuthenticator parses the credentials and headers for url sources, returning nil if there are none
+func parseAuthenticator(c cliContext, client *http.Client) (provider.Authenticator, error) {
+	password, err := parseSecret(c, "password", "password-file")
+	if err != nil {
+		return nil, err
+	}
+	token, err := parseSecret(c, "token", "token-file")
+	if err != nil {
+		return nil, err
+	}
+	username := c.GetStringFlagValue("user")
+	tokenUrl := c.GetStringFlagValue("oauth2-token-url")
+	// The environment variables are used only if no other credentials are set
+	if username != "" && password == nil {
+		password = envSecret(PasswordEnv)
+	}
+	if username == "" && token == nil && tokenUrl == "" {
+		token = envSecret(TokenEnv)
+	}
+
+	var authenticators provider.Authenticators
+	if values := getStringFlagValues(c, "header"); len(values) > 0 {
+		headers := http.Header{}
+		for _, value := range values {
+			name, headerValue, found := strings.Cut(value, "=")
+			name = strings.TrimSpace(name)
+			if !found || name == "" {
+				return nil, fmt.Errorf("invalid header: %s; must be in the form name=value", value)
+			}
+			headers.Add(name, strings.TrimSpace(headerValue))
+		}
+		authenticators = append(authenticators, provider.HeadersAuthenticator{Headers: headers})
+	}
+	var credentials provider.Authenticator
+	if username != "" {
+		if password == nil {
+			password = provider.StaticSecret("")
+		}
+		credentials = provider.UserPassAuthenticator{
+			Username: username,
+			Password: password,
+		}
+	}
+	if token != nil {
+		if credentials != nil {
+			return nil, fmt.Errorf("cannot use both user-password credentials and an access token; choose one")
+		}
+		credentials = provider.AccessTokenAuthenticator{
+			Token: token,
+		}
+	}
+	if tokenUrl != "" {
+		if credentials != nil {
+			return nil, fmt.Errorf("cannot use both OAuth2 client credentials and other credentials; choose one")
+		}
+		clientId := c.GetStringFlagValue("oauth2-client-id")
+		if clientId == "" {
+			return nil, fmt.Errorf("--oauth2-client-id is required with --oauth2-token-url")
+		}
+		clientSecret := envSecret(OAuth2ClientSecretEnv)
+		if flagValue := c.GetStringFlagValue("oauth2-client-secret"); flagValue != "" {
+			clientSecret = provider.StaticSecret(flagValue)
+		}
+		if clientSecret == nil {
+			return nil, fmt.Errorf("--oauth2-client-secret or the %s environment variable is required with --oauth2-token-url", OAuth2ClientSecretEnv)
+		}
+		var scopes []string
+		if flagValue := c.GetStringFlagValue("oauth2-scopes"); flagValue != "" {
+			scopes = strings.Split(flagValue, ",")
+		}
+		credentials = provider.NewOAuth2Authenticator(tokenUrl, clientId, clientSecret, scopes, client)
+	}
+	if credentials != nil {
+		authenticators = append(authenticators, credentials)
+	}
+	switch len(authenticators) {
+	case 0:
+		return nil, nil
+	case 1:
+		return authenticators[0], nil
+	}
+	return authenticators, nil
+}
+
+// parseSecret returns the secret set by the flag or by the file flag, or nil if none is set
+func parseSecret(c cliContext, flag string, fileFlag string) (provider.Secret, error) {
+	value := c.GetStringFlagValue(flag)
+	file := c.GetStringFlagValue(fileFlag)
+	if value != "" && file != "" {
+		return nil, fmt.Errorf("cannot use both --%s and --%s; choose one", flag, fileFlag)
+	}
+	if value != "" {
+		return provider.StaticSecret(value), nil
+	}
+	if file != "" {
+		secret := provider.NewFileSecret(file)
+		if _, err := secret.Value(); err != nil {
+			return nil, err
+		}
+		return secret, nil
+	}
+	return nil, nil
+}
+
+// envSecret returns the secret set by the environment variable, or nil if it is not set
+func envSecret(env string) provider.Secret {
+	if value := os.Getenv(env); value != "" {
+		return provider.StaticSecret(value)
+	}
+	return nil
+}
+
+// prometheusMatch returns the series selector to query from a Prometheus API, matching the series kept by the filter
+func prometheusMatch(filter string) string {
+	if provider.IsSelector(filter) {
+		if selector, err := provider.ParseSelector(filter); err == nil {
+			return selector.String()
+		}
+	}
+	if filter != "" {
+		// Prometheus regular expressions are anchored, unlike the filter
+		return fmt.Sprintf(`{__name__=~%q}`, ".*(?:"+filter+").*")
+	}
+	return `{__name__=~".+"}`
+}
+
+// parseRetryPolicy parses the timeout and retries of the requests to url and server sources
+func parseRetryPolicy(c cliContext) (provider.RetryPolicy, error) {
+	retryPolicy := provider.DefaultRetryPolicy
+	if flagValue := c.GetStringFlagValue("timeout"); flagValue != "" {
+		intValue, err := strconv.ParseInt(flagValue, 10, 64)
+		if err != nil {
+			return retryPolicy, fmt.Errorf("failed to parse timeout value: %s; cause: %w", flagValue, err)
+		}
+		if intValue <= 0 {
+			return retryPolicy, fmt.Errorf("timeout value must be positive; got: %d", intValue)
+		}
+		retryPolicy.Timeout = time.Duration(intValue) * time.Second
+	}
+	if flagValue := c.GetStringFlagValue("retries"); flagValue != "" {
+		intValue, err := strconv.Atoi(flagValue)
+		if err != nil {
+			return retryPolicy, fmt.Errorf("failed to parse retries value: %s; cause: %w", flagValue, err)
+		}
+		if intValue < 0 {
+			return retryPolicy, fmt.Errorf("retries value must not be negative; got: %d", intValue)
+		}
+		retryPolicy.Retries = intValue
+	}
+	return retryPolicy, nil
+}
+
+var sourceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// parseProducts parses the products to get the metrics of from each server. None are returned if the flag is not set,
+// in which case only the metrics of Artifactory are scraped, without the product label.
+func parseProducts(c cliContext) ([]provider.Product, error) {
+	flagValue := c.GetStringFlagValue("products")
+	if flagValue == "" {
+		return nil, nil
+	}
+	var products []provider.Product
+	seen := map[provider.Product]bool{}
+	for _, value := range strings.Split(flagValue, ",") {
+		value = strings.TrimSpace(value)
+		product, ok := provider.SupportedProducts[value]
+		if !ok {
+			return nil, fmt.Errorf("unknown product: %s", value)
+		}
+		if !seen[product] {
+			seen[product] = true
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+// getStringFlagValues returns the comma separated values of a flag, e.g. --url a,b, skipping empty values.
+// Commas between brackets or quotes do not separate values, e.g. in expressions and selectors, and a comma is escaped by
+// a backslash, e.g. in a header value.
+func getStringFlagValues(c cliContext, flagName string) []string {
+	var values []string
+	for _, value := range splitFlagValues(c.GetStringFlagValue(flagName)) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// splitFlagValues splits the value of a flag on the commas which are not between brackets or quotes, nor escaped
+func splitFlagValues(s string) []string {
+	var values []string
+	value := strings.Builder{}
+	depth := 0
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			if c != ',' {
+				value.WriteRune('\\')
+			}
+			value.WriteRune(c)
+			escaped = false
+			continue
+		case c == '\\':
+			escaped = true
+			continue
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == ',' && depth == 0:
+			values = append(values, value.String())
+			value.Reset()
+			continue
+		}
+		value.WriteRune(c)
+	}
+	if escaped {
+		value.WriteRune('\\')
+	}
+	return append(values, value.String())
+}
+
+// parseNamedSource parses a source value optionally prefixed with its name (name=value), using the default name if not set
+func parseNamedSource(s string, defaultName string) (string, string) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) == 2 && sourceNamePattern.MatchString(parts[0]) {
+		return parts[0], parts[1]
+	}
+	return defaultName, s
+}
+
+// hostOf returns the host (and port) of the url, or the url itself if it has no host
+func hostOf(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return s
+	}
+	return u.Host
+}
+
 type cliContext interface {
 	GetStringFlagValue(flagName string) string
 	GetBoolFlagValue(flagName string) bool
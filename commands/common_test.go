@@ -1,13 +1,14 @@
 package commands
 
 import (
-	"fmt"
+	"net/http"
 	"os"
 	"path"
 	"regexp"
 	"testing"
 	"time"
 
+	"github.com/eldada/metrics-viewer/expression"
 	"github.com/eldada/metrics-viewer/provider"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -26,22 +27,80 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 	defaultCliCtx.stringFlags["interval"] = "5"
 	testFilepath := path.Join(t.TempDir(), "foo")
 	require.NoError(t, os.WriteFile(testFilepath, []byte("hello"), 0777))
+	testArchivePath := testFilepath + ".1.gz"
+	require.NoError(t, os.WriteFile(testArchivePath, []byte{0x1f, 0x8b}, 0777))
 	tests := []struct {
-		name    string
-		cliCtx  cliContextMock
-		want    commonConfig
-		wantUrl string
-		wantErr string
+		name        string
+		cliCtx      cliContextMock
+		want        commonConfig
+		wantSources []string
+		wantErr     string
 	}{
 		{
 			name: "both file and url",
 			cliCtx: cliContextMock{
 				stringFlags: map[string]string{
-					"file": "foo",
+					"file": testFilepath,
 					"url":  "boo",
 				},
 			},
-			wantErr: "only zero or one flag is required: --file | --url",
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{"foo: file: '" + testFilepath + "'", "boo: url: boo"},
+		},
+		{
+			name: "multiple named urls",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url": "node1=http://node1:8082/metrics, http://node2:8082/metrics?a=b;x=y,",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{"node1: url: http://node1:8082/metrics", "node2:8082: url: http://node2:8082/metrics?a=b;x=y"},
+		},
+		{
+			name: "prometheus with filter",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"prometheus": "prom=http://localhost:9090",
+					"filter":     "jfrt_.*",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				filter:                regexp.MustCompile("jfrt_.*"),
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{`prom: prometheus: http://localhost:9090, match: {__name__=~".*(?:jfrt_.*).*"}`},
+		},
+		{
+			name: "prometheus with filter selector",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"prometheus": "http://localhost:9090",
+					"filter":     `jfrt_http_requests_total{method="GET"}`,
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				selector:              mustParseSelector(t, `jfrt_http_requests_total{method="GET"}`),
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{`localhost:9090: prometheus: http://localhost:9090, match: jfrt_http_requests_total{method="GET"}`},
+		},
+		{
+			name: "duplicate source names",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url": "http://node1:8082/metrics,http://node1:8082/other",
+				},
+			},
+			wantErr: "duplicate source name: node1:8082; name the sources explicitly using name=value",
 		},
 		{
 			name: "file",
@@ -52,10 +111,33 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 				},
 			},
 			want: commonConfiguration{
-				file:                  testFilepath,
 				interval:              5 * time.Second,
 				aggregateIgnoreLabels: provider.StringSet{},
 			},
+			wantSources: []string{"foo: file: '" + testFilepath + "'"},
+		},
+		{
+			name: "rotated files",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"file":     testFilepath + "*",
+					"interval": "5",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{"foo: file: '" + testFilepath + "', archives: ['" + testArchivePath + "']"},
+		},
+		{
+			name: "no rotated files",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"file": testFilepath + "*.zst",
+				},
+			},
+			wantErr: "no files match " + testFilepath + "*.zst",
 		},
 		{
 			name: "no such file",
@@ -66,6 +148,70 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 			},
 			wantErr: "could not open file foo: open foo: no such file or directory",
 		},
+		{
+			name: "replay",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"replay":       testFilepath,
+					"replay-speed": "2.5",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{"foo: replay: '" + testFilepath + "', speed: 2.5"},
+		},
+		{
+			name: "replay with other sources",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"replay":       testFilepath,
+					"replay-speed": "1",
+					"url":          "foo",
+				},
+			},
+			wantErr: "cannot use --replay with other sources",
+		},
+		{
+			name: "replay speed is zero",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"replay":       testFilepath,
+					"replay-speed": "0",
+				},
+			},
+			wantErr: "replay speed value must be positive; got: 0",
+		},
+		{
+			name: "no such recording",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"replay":       "foo",
+					"replay-speed": "1",
+				},
+			},
+			wantErr: "could not open recording foo: open foo: no such file or directory",
+		},
+		{
+			name: "unknown product",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"products": "artifactory,pipelines",
+				},
+			},
+			wantErr: "unknown product: pipelines",
+		},
+		{
+			name: "products without server",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"products": "artifactory, xray",
+					"url":      "foo",
+				},
+			},
+			wantErr: "--products applies only to servers; use it with --server-id",
+		},
 		{
 			name: "url without auth",
 			cliCtx: cliContextMock{
@@ -78,7 +224,7 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 				interval:              5 * time.Second,
 				aggregateIgnoreLabels: provider.StringSet{},
 			},
-			wantUrl: "url: foo",
+			wantSources: []string{"foo: url: foo"},
 		},
 		{
 			name: "url with basic auth",
@@ -94,7 +240,7 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 				interval:              5 * time.Second,
 				aggregateIgnoreLabels: provider.StringSet{},
 			},
-			wantUrl: "url: foo, auth-by-user: kermit",
+			wantSources: []string{"foo: url: foo, auth-by-user: kermit"},
 		},
 		{
 			name: "url with token auth",
@@ -109,7 +255,93 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 				interval:              5 * time.Second,
 				aggregateIgnoreLabels: provider.StringSet{},
 			},
-			wantUrl: "url: foo, auth-by-token: *****",
+			wantSources: []string{"foo: url: foo, auth-by-token: *****"},
+		},
+		{
+			name: "url with token file and headers",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":        "foo",
+					"token-file": testFilepath,
+					"header":     "X-Api-Key=abc, x-tenant=a=b",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{"foo: url: foo, auth-by-headers: X-Api-Key,X-Tenant, token: *****"},
+		},
+		{
+			name: "url with oauth2 client credentials",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":                  "foo",
+					"oauth2-token-url":     "http://auth/token",
+					"oauth2-client-id":     "viewer",
+					"oauth2-client-secret": "secret",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			wantSources: []string{"foo: url: foo, auth-by-oauth2-client: viewer"},
+		},
+		{
+			name: "both token and token file",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":        "foo",
+					"token":      "bar",
+					"token-file": testFilepath,
+				},
+			},
+			wantErr: "cannot use both --token and --token-file; choose one",
+		},
+		{
+			name: "missing token file",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":        "foo",
+					"token-file": "foo",
+				},
+			},
+			wantErr: "could not read secret file foo; cause: stat foo: no such file or directory",
+		},
+		{
+			name: "invalid header",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":    "foo",
+					"header": "X-Api-Key",
+				},
+			},
+			wantErr: "invalid header: X-Api-Key; must be in the form name=value",
+		},
+		{
+			name: "both oauth2 and token",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":                  "foo",
+					"token":                "bar",
+					"oauth2-token-url":     "http://auth/token",
+					"oauth2-client-id":     "viewer",
+					"oauth2-client-secret": "secret",
+				},
+			},
+			wantErr: "cannot use both OAuth2 client credentials and other credentials; choose one",
+		},
+		{
+			name: "oauth2 without client id",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":                  "foo",
+					"oauth2-token-url":     "http://auth/token",
+					"oauth2-client-secret": "secret",
+				},
+			},
+			wantErr: "--oauth2-client-id is required with --oauth2-token-url",
 		},
 		{
 			name: "url with both basic auth and token auth",
@@ -158,6 +390,46 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 			},
 			wantErr: "interval value must be positive; got: -7",
 		},
+		{
+			name: "client cert without key",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":         "foo",
+					"client-cert": testFilepath,
+				},
+			},
+			wantErr: "--client-cert and --client-key must be used together",
+		},
+		{
+			name: "timeout is not a number",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":     "foo",
+					"timeout": "1.5",
+				},
+			},
+			wantErr: `failed to parse timeout value: 1.5; cause: strconv.ParseInt: parsing "1.5": invalid syntax`,
+		},
+		{
+			name: "timeout is zero",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":     "foo",
+					"timeout": "0",
+				},
+			},
+			wantErr: "timeout value must be positive; got: 0",
+		},
+		{
+			name: "retries is negative",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":     "foo",
+					"retries": "-1",
+				},
+			},
+			wantErr: "retries value must not be negative; got: -1",
+		},
 		{
 			name: "filter",
 			cliCtx: cliContextMock{
@@ -171,7 +443,7 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 				aggregateIgnoreLabels: provider.StringSet{},
 				filter:                regexp.MustCompile("foo.*"),
 			},
-			wantUrl: "url: foo",
+			wantSources: []string{"foo: url: foo"},
 		},
 		{
 			name: "filter with bad regex",
@@ -183,6 +455,31 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 			},
 			wantErr: "invalid filter expression; cause: error parsing regexp: missing closing ): `(`",
 		},
+		{
+			name: "filter with selector",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":    "foo",
+					"filter": `foo{bar="x",baz=~"y.*"}`,
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+				selector:              mustParseSelector(t, `foo{bar="x",baz=~"y.*"}`),
+			},
+			wantSources: []string{"foo: url: foo"},
+		},
+		{
+			name: "filter with bad selector",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":    "foo",
+					"filter": `foo{bar="x",baz}`,
+				},
+			},
+			wantErr: "invalid filter selector; cause: expected label matching operator (=, !=, =~, !~) after label baz",
+		},
 		{
 			name: "aggregate ignore labels",
 			cliCtx: cliContextMock{
@@ -199,7 +496,60 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 					"baz": {},
 				},
 			},
-			wantUrl: "url: foo",
+			wantSources: []string{"foo: url: foo"},
+		},
+		{
+			name: "aggregate func",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":            "foo",
+					"aggregate-func": "max",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+				aggregateFunc:         provider.AggregateMax,
+			},
+			wantSources: []string{"foo: url: foo"},
+		},
+		{
+			name: "unknown aggregate func",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":            "foo",
+					"aggregate-func": "median",
+				},
+			},
+			wantErr: "unknown aggregate function: median",
+		},
+		{
+			name: "expressions",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":  "foo",
+					"expr": "heap_used=max - free,requests_rate=sum by (method, status) (rate(requests_total[1m]))",
+				},
+			},
+			want: commonConfiguration{
+				interval:              5 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+				expressions: []*expression.Expression{
+					mustParseExpression(t, "heap_used=max - free"),
+					mustParseExpression(t, "requests_rate=sum by (method, status) (rate(requests_total[1m]))"),
+				},
+			},
+			wantSources: []string{"foo: url: foo"},
+		},
+		{
+			name: "bad expression",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":  "foo",
+					"expr": "heap_used=max -",
+				},
+			},
+			wantErr: "invalid --expr value; cause: failed to parse expression heap_used; cause: unexpected end of expression at position 5",
 		},
 	}
 	for _, tc := range tests {
@@ -213,16 +563,54 @@ func testParseCommonConfig(t *testing.T, defaultCliCtx cliContextMock, parse fun
 			}
 			require.NoError(t, err)
 			assert.Equal(t, tc.want.Filter(), conf.Filter(), "filter")
-			assert.Equal(t, tc.want.File(), conf.File(), "file")
+			assert.Equal(t, tc.want.Selector(), conf.Selector(), "selector")
 			assert.Equal(t, tc.want.AggregateIgnoreLabels(), conf.AggregateIgnoreLabels(), "aggregate ignore labels")
 			assert.Equal(t, tc.want.Interval(), conf.Interval(), "interval")
-			if tc.wantUrl == "" {
-				assert.Nil(t, conf.UrlMetricsFetcher(), "url metrics fetcher")
-			} else {
-				if assert.NotNil(t, conf.UrlMetricsFetcher(), "url metrics fetcher") {
-					assert.Equal(t, tc.wantUrl, fmt.Sprintf("%s", conf.UrlMetricsFetcher()), "url metrics fetcher")
-				}
+			wantAggregateFunc := tc.want.AggregateFunc()
+			if wantAggregateFunc == "" {
+				wantAggregateFunc = provider.AggregateSum
+			}
+			assert.Equal(t, wantAggregateFunc, conf.AggregateFunc(), "aggregate func")
+			assert.Equal(t, tc.want.Expressions(), conf.Expressions(), "expressions")
+			var sources []string
+			for _, source := range conf.Sources() {
+				sources = append(sources, source.String())
 			}
+			assert.Equal(t, tc.wantSources, sources, "sources")
+		})
+	}
+}
+
+func Test_parseAuthenticator_headers(t *testing.T) {
+	authenticator, err := parseAuthenticator(cliContextMock{stringFlags: map[string]string{
+		"header": `X-Api-Key=abc,Cookie=a=1; b=2,cookie=c=3,Accept=text/plain\, application/json`,
+	}}, http.DefaultClient)
+	require.NoError(t, err)
+	assert.Equal(t, provider.HeadersAuthenticator{Headers: http.Header{
+		"X-Api-Key": {"abc"},
+		"Cookie":    {"a=1; b=2", "c=3"},
+		"Accept":    {"text/plain, application/json"},
+	}}, authenticator, "header values keep their semicolons and escaped commas")
+
+	_, err = parseAuthenticator(cliContextMock{stringFlags: map[string]string{"header": "X-Api-Key"}}, http.DefaultClient)
+	assert.EqualError(t, err, "invalid header: X-Api-Key; must be in the form name=value")
+}
+
+func Test_splitFlagValues(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", []string{""}},
+		{"a,b,", []string{"a", "b", ""}},
+		{`foo{a="1,2"},bar`, []string{`foo{a="1,2"}`, "bar"}},
+		{"x=sum by (a, b) (rate(c[1m])),y=histogram_quantile(0.9, d)", []string{"x=sum by (a, b) (rate(c[1m]))", "y=histogram_quantile(0.9, d)"}},
+		{`Accept=a\, b,X-Api-Key=abc`, []string{"Accept=a, b", "X-Api-Key=abc"}},
+		{`c:\logs\a.log,b.log\`, []string{`c:\logs\a.log`, `b.log\`}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.want, splitFlagValues(tc.input))
 		})
 	}
 }
@@ -261,9 +649,23 @@ func (c cliContextMock) OverrideWith(other cliContextMock) cliContextMock {
 }
 
 type commonConfig interface {
-	UrlMetricsFetcher() provider.UrlMetricsFetcher
-	File() string
+	Sources() []provider.Source
 	Interval() time.Duration
 	Filter() *regexp.Regexp
+	Selector() *provider.Selector
 	AggregateIgnoreLabels() provider.StringSet
+	AggregateFunc() provider.AggregateFunc
+	Expressions() []*expression.Expression
+}
+
+func mustParseSelector(t *testing.T, s string) *provider.Selector {
+	selector, err := provider.ParseSelector(s)
+	require.NoError(t, err)
+	return selector
+}
+
+func mustParseExpression(t *testing.T, definition string) *expression.Expression {
+	e, err := expression.Parse(definition)
+	require.NoError(t, err)
+	return e
 }
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/eldada/metrics-viewer/printer"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+func GetExportCommand() components.Command {
+	return components.Command{
+		Name:        "export",
+		Description: "Export the metrics of log files, or of rotated gzip or zstd archives, from start to end in any print format, and exit",
+		Aliases:     []string{"e"},
+		Flags:       getExportFlags(),
+		Action: func(c *components.Context) error {
+			return exportCmd(c)
+		},
+	}
+}
+
+func getExportFlags() []components.Flag {
+	return append([]components.Flag{
+		components.NewStringFlag("file", "Log file, or gzip or zstd archive, with the open metrics format to export (required), "+
+			"or a glob of rotated log files to export in order, e.g. 'artifactory-metrics*.log*'. Comma delimited list for multiple files, each optionally named using name=file"),
+		IntervalFlag,
+		FilterFlag,
+		AggregateIgnoreLabelsFlag,
+		AggregateFuncFlag,
+		ExpressionsFlag,
+		components.NewStringFlag("output", "File to write the exported metrics to, instead of the standard output"),
+	}, getOutputFlags()...)
+}
+
+type exportConfiguration struct {
+	printConfiguration
+	output string
+	writer io.Writer
+}
+
+func (c exportConfiguration) Output() string {
+	return c.output
+}
+
+func (c exportConfiguration) Writer() io.Writer {
+	if c.writer == nil {
+		return os.Stdout
+	}
+	return c.writer
+}
+
+func (c exportConfiguration) String() string {
+	return fmt.Sprintf("%s, output: '%s'", c.printConfiguration, c.output)
+}
+
+func exportCmd(c *components.Context) error {
+	conf, err := parseExportCmdConfig(c)
+	if err != nil {
+		return err
+	}
+	log.Debug("command config:", conf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signalChan
+		cancel()
+	}()
+
+	if conf.output == "" {
+		if err := checkBinaryOutput(conf); err != nil {
+			return fmt.Errorf("%w, or use --output", err)
+		}
+		return export(ctx, conf)
+	}
+	f, err := os.Create(conf.output)
+	if err != nil {
+		return fmt.Errorf("could not create output file %s; cause: %w", conf.output, err)
+	}
+	conf.writer = f
+	err = export(ctx, conf)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write output file %s; cause: %w", conf.output, closeErr)
+	}
+	return err
+}
+
+// export prints all the entries of the files, returning an error if any of them could not be read or printed
+func export(ctx context.Context, conf *exportConfiguration) error {
+	fetcher, err := printer.NewFetcherWithContext(ctx, conf)
+	if err != nil {
+		return err
+	}
+	defer fetcher.Close()
+	p, err := printer.NewPrinter(conf)
+	if err != nil {
+		return err
+	}
+	failed, err := printEntries(ctx, fetcher, p, conf)
+	if closeErr := p.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write the exported metrics; cause: %w", closeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("export stopped; cause: %w", err)
+	}
+	if err := printer.FetchErr(fetcher); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to export %d entries", failed)
+	}
+	return nil
+}
+
+func parseExportCmdConfig(c cliContext) (*exportConfiguration, error) {
+	if c.GetStringFlagValue("file") == "" {
+		return nil, fmt.Errorf("--file is required")
+	}
+	commonConfig, err := parseCommonConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	for i := range commonConfig.sources {
+		commonConfig.sources[i].NoFollow = true
+	}
+	conf := exportConfiguration{
+		printConfiguration: printConfiguration{
+			commonConfiguration: *commonConfig,
+		},
+	}
+	if err := parseOutputConfig(c, &conf.printConfiguration); err != nil {
+		return nil, err
+	}
+	conf.output = c.GetStringFlagValue("output")
+	if conf.output != "" && conf.parquetDir != "" {
+		return nil, fmt.Errorf("cannot use both --output and --parquet-dir; choose one")
+	}
+	return &conf, nil
+}
@@ -0,0 +1,233 @@
+package commands
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eldada/metrics-viewer/printer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exportTestLog = `# TYPE foo gauge
+foo{a="1"} 1 1606343802324
+bar 2 1606343802324
+foo{a="1"} 3 1606343813456
+bar 4 1606343813456
+`
+
+func Test_parseExportCmdConfig(t *testing.T) {
+	testFilepath := path.Join(t.TempDir(), "foo.log")
+	require.NoError(t, os.WriteFile(testFilepath, []byte(exportTestLog), 0777))
+	defaultCliCtx := cliContextMock{
+		stringFlags: map[string]string{
+			"file":     testFilepath,
+			"interval": "5",
+			"format":   string(printer.CSVFormat),
+		},
+	}
+	tests := []struct {
+		name    string
+		cliCtx  cliContextMock
+		want    exportConfiguration
+		wantErr string
+	}{
+		{
+			name: "stdout",
+			want: exportConfiguration{},
+		},
+		{
+			name: "output",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"output": "out.csv",
+				},
+			},
+			want: exportConfiguration{
+				output: "out.csv",
+			},
+		},
+		{
+			name: "no file",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"file": "",
+				},
+			},
+			wantErr: "--file is required",
+		},
+		{
+			name: "unknown output format",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format": "foo",
+				},
+			},
+			wantErr: "unknown output format: foo",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cliCtx := defaultCliCtx.OverrideWith(tc.cliCtx)
+			conf, err := parseExportCmdConfig(cliCtx)
+			if tc.wantErr != "" {
+				require.NotNil(t, err, "error")
+				assert.Equal(t, tc.wantErr, err.Error(), "error")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want.Output(), conf.Output(), "output")
+			assert.Equal(t, printer.CSVFormat, conf.Format(), "format")
+			require.Len(t, conf.Sources(), 1, "sources")
+			assert.True(t, conf.Sources()[0].NoFollow, "no follow")
+			assert.Equal(t, os.Stdout, conf.Writer(), "writer")
+		})
+	}
+}
+
+func Test_export(t *testing.T) {
+	dir := t.TempDir()
+	plain := path.Join(dir, "artifactory-metrics.log")
+	require.NoError(t, os.WriteFile(plain, []byte(exportTestLog), 0644))
+	archive := path.Join(dir, "artifactory-metrics.log.gz")
+	b := bytes.Buffer{}
+	gz := gzip.NewWriter(&b)
+	_, _ = gz.Write([]byte(exportTestLog))
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(archive, b.Bytes(), 0644))
+	truncated := path.Join(dir, "truncated.log.gz")
+	require.NoError(t, os.WriteFile(truncated, b.Bytes()[:b.Len()-10], 0644))
+
+	tests := []struct {
+		name     string
+		file     string
+		filter   string
+		expr     string
+		expected string
+		wantErr  string
+	}{
+		{
+			name: "plain file",
+			file: plain,
+			expected: `timestamp,bar,"foo{a=""1""}"
+2020-11-25T22:36:42.324,2.000000,1.000000
+2020-11-25T22:36:53.456,4.000000,3.000000
+`,
+		},
+		{
+			name:   "gzip archive, filtered",
+			file:   archive,
+			filter: "foo",
+			expected: `timestamp,"foo{a=""1""}"
+2020-11-25T22:36:42.324,1.000000
+2020-11-25T22:36:53.456,3.000000
+`,
+		},
+		{
+			name:   "derived metrics of every scrape",
+			file:   plain,
+			filter: "bar",
+			expr:   "double_bar=bar * 2",
+			expected: `timestamp,bar,double_bar
+2020-11-25T22:36:42.324,2.000000,4.000000
+2020-11-25T22:36:53.456,4.000000,8.000000
+`,
+		},
+		{
+			name:    "truncated gzip archive",
+			file:    truncated,
+			wantErr: "failed to read " + truncated + "; cause: unexpected EOF",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf, err := parseExportCmdConfig(cliContextMock{
+				stringFlags: map[string]string{
+					"file":                    tc.file,
+					"interval":                "5",
+					"filter":                  tc.filter,
+					"expr":                    tc.expr,
+					"format":                  string(printer.CSVFormat),
+					"aggregate-ignore-labels": "NONE",
+				},
+			})
+			require.NoError(t, err)
+			out := bytes.Buffer{}
+			conf.writer = &out
+			err = export(context.Background(), conf)
+			if tc.wantErr != "" {
+				require.NotNil(t, err, "error")
+				assert.Equal(t, tc.wantErr, err.Error(), "error")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func Test_export_formats(t *testing.T) {
+	file := path.Join(t.TempDir(), "artifactory-metrics.log")
+	require.NoError(t, os.WriteFile(file, []byte(exportTestLog), 0644))
+	var remoteWrites atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteWrites.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	// Every format must print all the entries once the export ends, including the ones buffered by the printer
+	checks := map[printer.OutputFormat]func(t *testing.T, out string){
+		printer.OpenMetricsFormat: func(t *testing.T, out string) {
+			assert.Contains(t, out, "bar 4 1606343813456")
+		},
+		printer.CSVFormat: func(t *testing.T, out string) {
+			assert.Contains(t, out, "2020-11-25T22:36:53.456,4.000000,3.000000\n")
+		},
+		printer.JSONFormat: func(t *testing.T, out string) {
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			require.Len(t, lines, 2, "documents")
+			assert.Contains(t, lines[1], `"timestamp":"2020-11-25T22:36:53.456Z"`)
+		},
+		printer.NDJSONFormat: func(t *testing.T, out string) {
+			assert.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 4, "samples")
+		},
+		printer.RemoteWriteFormat: func(t *testing.T, out string) {
+			assert.Empty(t, out)
+			assert.Positive(t, remoteWrites.Load(), "remote writes")
+		},
+		printer.ParquetFormat: func(t *testing.T, out string) {
+			// The footer, which is written on close, ends with the magic number as well
+			assert.True(t, strings.HasPrefix(out, "PAR1") && strings.HasSuffix(out, "PAR1"), "parquet file")
+		},
+	}
+	for name, format := range printer.SupportedOutputFormats {
+		t.Run(name, func(t *testing.T) {
+			check, found := checks[format]
+			require.True(t, found, "the export of the format is not tested")
+			conf, err := parseExportCmdConfig(cliContextMock{
+				stringFlags: map[string]string{
+					"file":                    file,
+					"interval":                "5",
+					"format":                  name,
+					"metrics":                 `bar,foo{a="1"}`,
+					"aggregate-ignore-labels": "NONE",
+					"remote-write-url":        receiver.URL,
+				},
+			})
+			require.NoError(t, err)
+			out := bytes.Buffer{}
+			conf.writer = &out
+			require.NoError(t, export(context.Background(), conf))
+			check(t, out.String())
+		})
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/eldada/metrics-viewer/expression"
 	"github.com/eldada/metrics-viewer/models"
 	"github.com/eldada/metrics-viewer/provider"
 	"github.com/eldada/metrics-viewer/visualization"
@@ -28,24 +31,49 @@ func GetGraphCommand() components.Command {
 func getGraphFlags() []components.Flag {
 	return append(
 		getCommonFlags(),
+		PrometheusFlag,
 		components.StringFlag{
-			BaseFlag:     components.NewFlag("time", "Time window to show in seconds"),
+			BaseFlag:     components.NewFlag("time", "Time window to show in seconds. With --file, the window is filled from the end of the log on startup"),
 			DefaultValue: "300",
 		},
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("counter-mode", "How to show counters (available: raw, rate, increase). Can be toggled per metric in the viewer using 'r'"),
+			DefaultValue: string(provider.CounterModeRaw),
+		},
+		components.NewStringFlag("storage-dir", "Directory to store the scraped metrics in, and to load the metrics of previous sessions from on startup. "+
+			"Can be shared by multiple sessions. The time window can be scrolled back through the stored metrics"),
+		components.NewStringFlag("storage-retention", "Time in seconds to keep the stored metrics for, after which they are deleted (see --storage-dir). "+
+			"The stored metrics are kept forever if not set"),
 	)
 }
 
 type graphConfiguration struct {
 	commonConfiguration
-	timeWindow time.Duration
+	timeWindow       time.Duration
+	counterMode      provider.CounterMode
+	storageDir       string
+	storageRetention time.Duration
 }
 
 func (c graphConfiguration) TimeWindow() time.Duration {
 	return c.timeWindow
 }
 
+func (c graphConfiguration) CounterMode() provider.CounterMode {
+	return c.counterMode
+}
+
+func (c graphConfiguration) StorageDir() string {
+	return c.storageDir
+}
+
+func (c graphConfiguration) StorageRetention() time.Duration {
+	return c.storageRetention
+}
+
 func (c graphConfiguration) String() string {
-	return fmt.Sprintf("%s, time: %s", c.commonConfiguration, c.timeWindow)
+	return fmt.Sprintf("%s, time: %s, counter mode: %s, storage dir: '%s', storage retention: %s",
+		c.commonConfiguration, c.timeWindow, c.counterMode, c.storageDir, c.storageRetention)
 }
 
 func graphCmd(c *components.Context) error {
@@ -60,7 +88,10 @@ func graphCmd(c *components.Context) error {
 		return err
 	}
 
-	visualization.NewIndex().Present(context.TODO(), conf.interval, prov)
+	// Cancels the pending scrape once the viewer exits
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	visualization.NewIndex().Present(ctx, conf.interval, prov)
 	return nil
 }
 
@@ -83,35 +114,184 @@ func parseGraphCmdConfig(c cliContext) (*graphConfiguration, error) {
 	}
 	conf.timeWindow = time.Duration(intValue) * time.Second
 
+	flagValue = c.GetStringFlagValue("counter-mode")
+	if flagValue == "" {
+		conf.counterMode = provider.CounterModeRaw
+	} else if counterMode, ok := provider.SupportedCounterModes[flagValue]; ok {
+		conf.counterMode = counterMode
+	} else {
+		return nil, fmt.Errorf("unknown counter mode: %s", flagValue)
+	}
+
+	conf.storageDir = c.GetStringFlagValue("storage-dir")
+	if conf.storageDir != "" && conf.isReplay() {
+		return nil, fmt.Errorf("cannot use --storage-dir with --replay, the replayed metrics are already stored")
+	}
+	if flagValue = c.GetStringFlagValue("storage-retention"); flagValue != "" {
+		if conf.storageDir == "" {
+			return nil, fmt.Errorf("--storage-retention requires --storage-dir")
+		}
+		intValue, err := strconv.ParseInt(flagValue, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse storage retention value: %s; cause: %w", flagValue, err)
+		}
+		if intValue <= 0 {
+			return nil, fmt.Errorf("storage retention value must be positive; got: %d", intValue)
+		}
+		conf.storageRetention = time.Duration(intValue) * time.Second
+	}
+
 	return &conf, nil
 }
 
-func newGraphMetricsProvider(conf provider.Config) (*graphMetricsProvider, error) {
+type graphProviderConfig interface {
+	provider.Config
+	CounterMode() provider.CounterMode
+	Expressions() []*expression.Expression
+	StorageDir() string
+	StorageRetention() time.Duration
+}
+
+func newGraphMetricsProvider(conf graphProviderConfig) (*graphMetricsProvider, error) {
 	prov, err := provider.New(conf)
 	if err != nil {
 		return nil, err
 	}
-	return &graphMetricsProvider{
+	// Expressions are evaluated over the whole time window, so they need the data of their longest range before it
+	var maxRange time.Duration
+	for _, e := range conf.Expressions() {
+		if e.Range() > maxRange {
+			maxRange = e.Range()
+		}
+	}
+	history := conf.TimeWindow() + maxRange + 2*conf.Interval()
+	// A replay runs by the recording time, so the time windows end at it rather than at the wall clock
+	newMetricsCache := provider.NewMetricsCache
+	if clock, ok := prov.(provider.Clock); ok {
+		newMetricsCache = func(timeWindow time.Duration) *provider.MetricsCache {
+			return provider.NewMetricsCacheWithClock(timeWindow, clock.Now)
+		}
+	}
+	if conf.StorageDir() != "" {
+		storage, err := provider.NewDiskStorageWithRetention(conf.StorageDir(), conf.StorageRetention())
+		if err != nil {
+			return nil, err
+		}
+		prov = provider.NewStoredProvider(prov, storage, history)
+	}
+	// Past time windows are queried from the sources keeping a history of the metrics, or from the stored metrics
+	rangeQuerier, _ := prov.(provider.RangeQuerier)
+	p := &graphMetricsProvider{
 		provider:          prov,
-		mapMetrics:        provider.NewLabelsMetricsMapper(conf.AggregateIgnoreLabels(), ","),
+		selectSamples:     provider.NewSelectorSamplesMapper(conf.Selector()),
+		mapMetrics:        provider.NewLabelsMetricsMapper(conf.AggregateIgnoreLabels(), ",", conf.AggregateFunc()),
 		shouldKeepMetrics: provider.NewRegexMetricsFilter(conf.Filter()),
-		cachedMetrics:     provider.NewMetricsCache(conf.TimeWindow()),
-	}, nil
+		transformCounters: provider.NewCounterTransformer(conf.CounterMode()),
+		cachedMetrics:     newMetricsCache(conf.TimeWindow()),
+		expressions:       conf.Expressions(),
+		interval:          conf.Interval(),
+		timeWindow:        conf.TimeWindow(),
+		maxRange:          maxRange,
+		rangeQuerier:      rangeQuerier,
+	}
+	if len(p.expressions) > 0 {
+		p.rawMetrics = newMetricsCache(history)
+		p.mapRawMetrics = provider.NewLabelsMetricsMapper(provider.StringSet{"NONE": {}}, ",", provider.AggregateSum)
+	}
+	// Seed the caches with the metrics already in the files, unless continuing from the stored ones
+	if backfiller, ok := prov.(provider.Backfiller); ok && conf.StorageDir() == "" {
+		metricsCollection, err := backfiller.Backfill(time.Now().Add(-history))
+		if err != nil {
+			log.Warn("failed to backfill the metrics:", err.Error())
+		} else {
+			p.add(metricsCollection)
+		}
+	}
+	return p, nil
 }
 
 type graphMetricsProvider struct {
 	provider          provider.Provider
+	selectSamples     provider.MetricsMapperFunc // by the selector filter, before the labels are ignored
 	mapMetrics        provider.MetricsMapperFunc
-	shouldKeepMetrics provider.MetricsFilterFunc
+	shouldKeepMetrics provider.MetricsFilterFunc // by the regular expression filter, after the labels are ignored
+	transformCounters *provider.CounterTransformer
 	cachedMetrics     *provider.MetricsCache
+	mapRawMetrics     provider.MetricsMapperFunc
+	rawMetrics        *provider.MetricsCache // metrics with all labels, before filtering and counter transformation, used by expressions
+	expressions       []*expression.Expression
+	interval          time.Duration
+	timeWindow        time.Duration
+	maxRange          time.Duration // the longest range of the expressions
+	rangeQuerier      provider.RangeQuerier
+	offset            atomic.Int64 // how long ago the shown time window ends, if scrolled back
+	mu                sync.Mutex
 }
 
-func (p graphMetricsProvider) Get() ([]models.Metrics, error) {
-	metricsCollection, err := p.provider.Get()
+func (p *graphMetricsProvider) Get(ctx context.Context) ([]models.Metrics, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	metricsCollection, err := p.provider.Get(ctx)
+	if offset := time.Duration(p.offset.Load()); offset > 0 {
+		// The sources are still scraped while scrolled back, so the present time window is complete when scrolled forward
+		if err != nil {
+			log.Warn("failed to get the metrics while scrolled back:", err.Error())
+		} else {
+			p.add(metricsCollection)
+		}
+		return p.getPast(ctx, offset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.add(metricsCollection), nil
+}
+
+// getPast queries the metrics of the time window ending at the offset before now, and the derived ones.
+// The caches are not used, as they hold the metrics of the present time window.
+func (p *graphMetricsProvider) getPast(ctx context.Context, offset time.Duration) ([]models.Metrics, error) {
+	end := time.Now().Add(-offset)
+	start := end.Add(-p.timeWindow)
+	metricsCollection, err := p.rangeQuerier.QueryRange(ctx, start.Add(-p.maxRange), end)
 	if err != nil {
 		return nil, err
 	}
-	newCollection := p.mapMetrics(metricsCollection)
+	var derivedCollection []models.Metrics
+	if len(p.expressions) > 0 {
+		rawCollection := p.mapRawMetrics(metricsCollection)
+		for _, e := range p.expressions {
+			derivedCollection = append(derivedCollection, e.Evaluate(rawCollection, start, end, p.interval)...)
+		}
+	}
+	filteredCollection := make([]models.Metrics, 0)
+	for _, metrics := range p.mapMetrics(p.selectSamples(metricsCollection)) {
+		if p.shouldKeepMetrics(metrics) {
+			filteredCollection = append(filteredCollection, metrics)
+		}
+	}
+	filteredCollection = p.transformCounters.Fresh().Transform(filteredCollection)
+	window := provider.NewMetricsCacheWithClock(p.timeWindow, func() time.Time { return end })
+	return append(window.Add(filteredCollection), derivedCollection...), nil
+}
+
+// Scroll moves the time window back or forward by half of it, if the metrics of past time windows can be queried
+func (p *graphMetricsProvider) Scroll(back bool) (time.Duration, bool) {
+	if p.rangeQuerier == nil {
+		return 0, false
+	}
+	by := p.timeWindow / 2
+	if !back {
+		by = -by
+	}
+	offset := max(time.Duration(p.offset.Load())+by, 0)
+	p.offset.Store(int64(offset))
+	return offset, true
+}
+
+// add adds the metrics to the caches, returning the cached metrics of the time window with the derived ones
+func (p *graphMetricsProvider) add(metricsCollection []models.Metrics) []models.Metrics {
+	derivedCollection := p.evaluateExpressions(metricsCollection)
+	newCollection := p.mapMetrics(p.selectSamples(metricsCollection))
 	filteredCollection := make([]models.Metrics, 0)
 	for _, metrics := range newCollection {
 		if !p.shouldKeepMetrics(metrics) {
@@ -119,6 +299,42 @@ func (p graphMetricsProvider) Get() ([]models.Metrics, error) {
 		}
 		filteredCollection = append(filteredCollection, metrics)
 	}
+	filteredCollection = p.transformCounters.Transform(filteredCollection)
 	newCollection = p.cachedMetrics.Add(filteredCollection)
-	return newCollection, nil
+	return append(newCollection, derivedCollection...)
+}
+
+// evaluateExpressions adds the metrics to the raw cache, and evaluates the expressions over the time window.
+// The derived metrics are not filtered, since they were explicitly requested.
+func (p *graphMetricsProvider) evaluateExpressions(metricsCollection []models.Metrics) []models.Metrics {
+	if p.rawMetrics == nil {
+		return nil
+	}
+	rawCollection := p.rawMetrics.Add(p.mapRawMetrics(metricsCollection))
+	end, ok := expression.Latest(rawCollection)
+	if !ok {
+		return nil
+	}
+	var derivedCollection []models.Metrics
+	for _, e := range p.expressions {
+		derivedCollection = append(derivedCollection, e.Evaluate(rawCollection, end.Add(-p.timeWindow), end, p.interval)...)
+	}
+	return derivedCollection
+}
+
+func (p *graphMetricsProvider) CounterMode(name string) (provider.CounterMode, bool) {
+	return p.transformCounters.Mode(name)
+}
+
+// ToggleCounterMode switches the metric to the next counter mode.
+// The cached values of the metric are dropped, since they are no longer comparable with the new ones. The lock of Get
+// is held, so a concurrent update never caches values of the previous mode after they were dropped.
+func (p *graphMetricsProvider) ToggleCounterMode(name string) (provider.CounterMode, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mode, ok := p.transformCounters.Toggle(name)
+	if ok {
+		p.cachedMetrics.Remove(name)
+	}
+	return mode, ok
 }
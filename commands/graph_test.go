@@ -1,11 +1,20 @@
 package commands
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/provider"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -61,6 +70,84 @@ func Test_parseGraphCmdConfig(t *testing.T) {
 			},
 			wantErr: `failed to parse time window value: foo; cause: strconv.ParseInt: parsing "foo": invalid syntax`,
 		},
+		{
+			name: "counter mode rate",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"counter-mode": "rate",
+				},
+			},
+			want: graphConfiguration{
+				timeWindow:  5 * time.Second,
+				counterMode: provider.CounterModeRate,
+			},
+		},
+		{
+			name: "unknown counter mode",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"counter-mode": "foo",
+				},
+			},
+			wantErr: "unknown counter mode: foo",
+		},
+		{
+			name: "storage dir",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"storage-dir": "/tmp/metrics",
+				},
+			},
+			want: graphConfiguration{
+				timeWindow: 5 * time.Second,
+				storageDir: "/tmp/metrics",
+			},
+		},
+		{
+			name: "storage dir with replay",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"file":         "",
+					"replay":       testFilepath,
+					"replay-speed": "1",
+					"storage-dir":  "/tmp/metrics",
+				},
+			},
+			wantErr: "cannot use --storage-dir with --replay, the replayed metrics are already stored",
+		},
+		{
+			name: "storage retention",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"storage-dir":       "/tmp/metrics",
+					"storage-retention": "86400",
+				},
+			},
+			want: graphConfiguration{
+				timeWindow:       5 * time.Second,
+				storageDir:       "/tmp/metrics",
+				storageRetention: 24 * time.Hour,
+			},
+		},
+		{
+			name: "storage retention without storage dir",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"storage-retention": "86400",
+				},
+			},
+			wantErr: "--storage-retention requires --storage-dir",
+		},
+		{
+			name: "negative storage retention",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"storage-dir":       "/tmp/metrics",
+					"storage-retention": "-1",
+				},
+			},
+			wantErr: "storage retention value must be positive; got: -1",
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -73,6 +160,152 @@ func Test_parseGraphCmdConfig(t *testing.T) {
 			}
 			require.NoError(t, err)
 			assert.Equal(t, tc.want.TimeWindow(), conf.TimeWindow(), "time window")
+			wantCounterMode := tc.want.CounterMode()
+			if wantCounterMode == "" {
+				wantCounterMode = provider.CounterModeRaw
+			}
+			assert.Equal(t, wantCounterMode, conf.CounterMode(), "counter mode")
+			assert.Equal(t, tc.want.StorageDir(), conf.StorageDir(), "storage dir")
+			assert.Equal(t, tc.want.StorageRetention(), conf.StorageRetention(), "storage retention")
 		})
 	}
 }
+
+// newPrometheusServer serves a series foo with the value 1 at every step of the queried range
+func newPrometheusServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/series" {
+			_, _ = w.Write([]byte(`{"status":"success","data":[{"__name__":"foo"}]}`))
+			return
+		}
+		start, _ := strconv.ParseFloat(r.FormValue("start"), 64)
+		end, _ := strconv.ParseFloat(r.FormValue("end"), 64)
+		step, _ := strconv.ParseFloat(r.FormValue("step"), 64)
+		var values []string
+		for ts := start; ts <= end; ts += step {
+			values = append(values, fmt.Sprintf(`[%.3f,"1"]`, ts))
+		}
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"foo"},"values":[%s]}]}}`,
+			strings.Join(values, ","))
+	}))
+}
+
+func Test_graphMetricsProviderScroll(t *testing.T) {
+	server := newPrometheusServer()
+	defer server.Close()
+	conf := graphConfiguration{
+		commonConfiguration: commonConfiguration{
+			sources: []provider.Source{{
+				Name:       "prom",
+				Prometheus: provider.NewPrometheusAPI(server.URL, `{__name__="foo"}`, server.Client(), nil, provider.DefaultRetryPolicy),
+			}},
+			interval:              10 * time.Second,
+			aggregateIgnoreLabels: provider.StringSet{},
+		},
+		timeWindow:  time.Minute,
+		counterMode: provider.CounterModeRaw,
+	}
+	p, err := newGraphMetricsProvider(conf)
+	require.NoError(t, err)
+
+	timeRange := func(metricsCollection []models.Metrics) (time.Time, time.Time) {
+		require.Len(t, metricsCollection, 1)
+		metrics := metricsCollection[0].Metrics
+		require.NotEmpty(t, metrics)
+		return metrics[0].Timestamp, metrics[len(metrics)-1].Timestamp
+	}
+	metricsCollection, err := p.Get(context.Background())
+	require.NoError(t, err)
+	first, last := timeRange(metricsCollection)
+	assert.WithinDuration(t, time.Now().Add(-time.Minute), first, 11*time.Second, "first of the present window")
+	assert.WithinDuration(t, time.Now(), last, 11*time.Second, "last of the present window")
+
+	offset, ok := p.Scroll(true)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, offset)
+	offset, _ = p.Scroll(true)
+	assert.Equal(t, time.Minute, offset)
+	metricsCollection, err = p.Get(context.Background())
+	require.NoError(t, err)
+	first, last = timeRange(metricsCollection)
+	assert.WithinDuration(t, time.Now().Add(-2*time.Minute), first, 11*time.Second, "first of the past window")
+	assert.WithinDuration(t, time.Now().Add(-time.Minute), last, 11*time.Second, "last of the past window")
+
+	// Scrolling forward stops at the present
+	_, _ = p.Scroll(false)
+	offset, _ = p.Scroll(false)
+	assert.Equal(t, time.Duration(0), offset)
+	offset, _ = p.Scroll(false)
+	assert.Equal(t, time.Duration(0), offset)
+}
+
+func Test_graphMetricsProviderScrollSources(t *testing.T) {
+	var scrapes atomic.Int32
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrapes.Add(1)
+		_, _ = w.Write([]byte("bar 1\n"))
+	}))
+	defer node.Close()
+	prometheus := newPrometheusServer()
+	defer prometheus.Close()
+	newProvider := func(sources ...provider.Source) *graphMetricsProvider {
+		p, err := newGraphMetricsProvider(graphConfiguration{
+			commonConfiguration: commonConfiguration{
+				sources:               sources,
+				interval:              10 * time.Second,
+				aggregateIgnoreLabels: provider.StringSet{},
+			},
+			timeWindow:  time.Minute,
+			counterMode: provider.CounterModeRaw,
+		})
+		require.NoError(t, err)
+		return p
+	}
+	nodeSource := func(name string) provider.Source {
+		return provider.Source{Name: name, UrlMetricsFetcher: provider.NewUrlMetricsFetcher(node.URL, node.Client(), nil, provider.DefaultRetryPolicy)}
+	}
+
+	// Without a source keeping a history of the metrics, there is nothing to scroll back to
+	p := newProvider(nodeSource("node1"), nodeSource("node2"))
+	_, ok := p.Scroll(true)
+	assert.False(t, ok, "scrolled without history")
+
+	// The stored metrics are a history to scroll back to
+	stored, err := newGraphMetricsProvider(graphConfiguration{
+		commonConfiguration: commonConfiguration{
+			sources:               []provider.Source{nodeSource("node1")},
+			interval:              10 * time.Second,
+			aggregateIgnoreLabels: provider.StringSet{},
+		},
+		timeWindow:  time.Minute,
+		counterMode: provider.CounterModeRaw,
+		storageDir:  t.TempDir(),
+	})
+	require.NoError(t, err)
+	_, ok = stored.Scroll(true)
+	assert.True(t, ok, "scrolled with stored metrics")
+
+	// The live sources are still scraped while scrolled back
+	p = newProvider(nodeSource("node1"), provider.Source{
+		Name:       "prom",
+		Prometheus: provider.NewPrometheusAPI(prometheus.URL, `{__name__="foo"}`, prometheus.Client(), nil, provider.DefaultRetryPolicy),
+	})
+	_, ok = p.Scroll(true)
+	require.True(t, ok, "scrolled with history")
+	metricsCollection, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), scrapes.Load(), "scrapes while scrolled back")
+	require.Len(t, metricsCollection, 1)
+	assert.Equal(t, `foo{instance="prom"}`, metricsCollection[0].Name)
+
+	_, _ = p.Scroll(false)
+	metricsCollection, err = p.Get(context.Background())
+	require.NoError(t, err)
+	var names []string
+	for _, metrics := range metricsCollection {
+		names = append(names, metrics.Name)
+	}
+	assert.ElementsMatch(t, []string{`bar{instance="node1"}`, `foo{instance="prom"}`}, names)
+	assert.Equal(t, int32(2), scrapes.Load(), "scrapes")
+}
@@ -6,14 +6,18 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/eldada/metrics-viewer/parser"
 	"github.com/eldada/metrics-viewer/printer"
 	"github.com/eldada/metrics-viewer/provider"
 	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
 	"github.com/jfrog/jfrog-client-go/utils/log"
+	"golang.org/x/term"
 )
 
 func GetPrintCommand() components.Command {
@@ -29,22 +33,79 @@ func GetPrintCommand() components.Command {
 }
 
 func getPrintFlags() []components.Flag {
-	return append(
-		getCommonFlags(),
+	return append(getCommonFlags(), getOutputFlags()...)
+}
+
+// getOutputFlags returns the flags of the output format, shared by the print and export commands
+func getOutputFlags() []components.Flag {
+	return []components.Flag{
 		components.StringFlag{
-			BaseFlag:     components.NewFlag("format", "Format in which to print the metrics (available: open-metrics, csv)"),
+			BaseFlag:     components.NewFlag("format", "Format in which to print the metrics (available: open-metrics, csv, json, ndjson, remote-write, parquet)"),
 			DefaultValue: "open-metrics",
 		},
-		components.NewStringFlag("metrics", "Comma separated list of metrics to collect. This is required when the output format is csv"),
+		components.NewStringFlag("metrics", "Comma separated list of metrics to collect. When the output format is csv, these are the columns, "+
+			"which are otherwise discovered from the metrics passing --filter. When the output format is json, ndjson or parquet, these are the metrics to print"),
 		components.NewBoolFlag("no-header", "Indicate whether to print the header line when the output format is csv"),
-	)
+		components.NewBoolFlag("type-header", "Print a second csv header line with the type and unit of each column, e.g. 'gauge (bytes)'"),
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("discover-scrapes", "Number of scrapes to buffer for discovering the csv columns when --metrics is not set. Columns of metrics appearing later are appended, printing the header again"),
+			DefaultValue: "3",
+		},
+		components.NewStringFlag("schema-file", "File to write the csv header to instead of the output, updated whenever columns are discovered"),
+		components.StringFlag{
+			BaseFlag: components.NewFlag("timestamp-format", "Format of the csv timestamps: rfc3339, epoch (seconds), epoch-ms (milliseconds), "+
+				"or a Go time layout (e.g. 2006-01-02 15:04:05)"),
+			DefaultValue: printer.DefaultTimestampFormat,
+		},
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("time-zone", "Time zone of the csv timestamps, e.g. Local or Europe/Berlin"),
+			DefaultValue: "UTC",
+		},
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("float-format", "Printf format of the csv values, e.g. %.2f, or %e for scientific notation"),
+			DefaultValue: "%f",
+		},
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("delimiter", "Delimiter of the csv fields, a single character or tab"),
+			DefaultValue: ",",
+		},
+		components.NewStringFlag("align", "Window in seconds within which samples are printed in the same csv record or json document, 0 for exact timestamps (default: the interval)"),
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("fill", "How to fill missing csv values (available: empty, previous, nan)"),
+			DefaultValue: string(printer.FillEmpty),
+		},
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("parquet-row-group-size", "Number of rows in each row group when the output format is parquet"),
+			DefaultValue: "10000",
+		},
+		components.NewStringFlag("parquet-dir", "Directory to write the parquet output to as a complete file per row group, which is readable as soon as it appears, "+
+			"instead of a single file readable only once the output ends"),
+		components.NewStringFlag("remote-write-url", "Prometheus remote write endpoint to push the metrics to. This is required when the output format is remote-write"),
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("remote-write-batch-size", "Maximum number of samples in each remote write request"),
+			DefaultValue: "500",
+		},
+	}
 }
 
 type printConfiguration struct {
 	commonConfiguration
-	format   printer.OutputFormat
-	metrics  []string
-	noHeader bool
+	format               printer.OutputFormat
+	metrics              []string
+	noHeader             bool
+	typeHeader           bool
+	remoteWriteURL       string
+	remoteWriteBatchSize int
+	discoverScrapes      int
+	schemaFile           string
+	timestampFormat      string
+	timeZone             *time.Location
+	floatFormat          string
+	delimiter            rune
+	align                time.Duration
+	fillPolicy           printer.FillPolicy
+	parquetRowGroupSize  int
+	parquetDir           string
 }
 
 func (c printConfiguration) Format() printer.OutputFormat {
@@ -63,6 +124,58 @@ func (c printConfiguration) NoHeader() bool {
 	return c.noHeader
 }
 
+func (c printConfiguration) TypeHeader() bool {
+	return c.typeHeader
+}
+
+func (c printConfiguration) DiscoverScrapes() int {
+	return c.discoverScrapes
+}
+
+func (c printConfiguration) SchemaFile() string {
+	return c.schemaFile
+}
+
+func (c printConfiguration) TimestampFormat() string {
+	return c.timestampFormat
+}
+
+func (c printConfiguration) TimeZone() *time.Location {
+	return c.timeZone
+}
+
+func (c printConfiguration) FloatFormat() string {
+	return c.floatFormat
+}
+
+func (c printConfiguration) Delimiter() rune {
+	return c.delimiter
+}
+
+func (c printConfiguration) Align() time.Duration {
+	return c.align
+}
+
+func (c printConfiguration) FillPolicy() printer.FillPolicy {
+	return c.fillPolicy
+}
+
+func (c printConfiguration) ParquetRowGroupSize() int {
+	return c.parquetRowGroupSize
+}
+
+func (c printConfiguration) ParquetDir() string {
+	return c.parquetDir
+}
+
+func (c printConfiguration) RemoteWriteURL() string {
+	return c.remoteWriteURL
+}
+
+func (c printConfiguration) RemoteWriteBatchSize() int {
+	return c.remoteWriteBatchSize
+}
+
 func (c printConfiguration) String() string {
 	return fmt.Sprintf("%s, format: %s", c.commonConfiguration, c.format)
 }
@@ -73,6 +186,9 @@ func printCmd(c *components.Context) error {
 		return err
 	}
 	log.Debug("command config:", conf)
+	if err := checkBinaryOutput(conf); err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -94,15 +210,43 @@ func printCmd(c *components.Context) error {
 	if err != nil {
 		return err
 	}
-	shouldPrintEntry := getFilterFunc(conf)
+	_, _ = printEntries(ctx, fetcher, p, conf)
+	if err := p.Close(); err != nil {
+		return fmt.Errorf("failed to write the printed metrics; cause: %w", err)
+	}
+	return nil
+}
 
+// printEntries prints the entries of the fetcher until all of them were fetched (e.g. a replay ended), or until the
+// context is done. It returns the number of entries which failed to print.
+func printEntries(ctx context.Context, fetcher printer.MetricEntryFetcher, p printer.Printer, conf printer.Config) (int, error) {
+	shouldPrintEntry := getFilterFunc(conf)
+	evaluator := printer.NewExpressionEvaluator(conf)
+	failed := 0
+	printDerived := func(entries []string) {
+		for _, derivedEntry := range entries {
+			if err := p.Print(derivedEntry); err != nil {
+				failed++
+			}
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
-		case entry := <-fetcher.Entries():
+			printDerived(evaluator.Flush())
+			return failed, ctx.Err()
+		case entry, ok := <-fetcher.Entries():
+			if !ok {
+				// The expressions of the last scrape are evaluated once no later scrape can complete it
+				printDerived(evaluator.Flush())
+				return failed, nil
+			}
+			// Expressions are evaluated over all entries, and their entries are printed regardless of the filter
+			printDerived(evaluator.Observe(entry))
 			if shouldPrintEntry(entry) {
-				_ = p.Print(entry)
+				if err := p.Print(entry); err != nil {
+					failed++
+				}
 			}
 		}
 	}
@@ -116,41 +260,185 @@ func parsePrintCmdConfig(c cliContext) (*printConfiguration, error) {
 	conf := printConfiguration{
 		commonConfiguration: *commonConfig,
 	}
+	if err := parseOutputConfig(c, &conf); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// checkBinaryOutput refuses to write a binary output format to a terminal, where it garbles the screen
+func checkBinaryOutput(conf printer.Config) error {
+	if conf.Format() == printer.ParquetFormat && conf.ParquetDir() == "" && isTerminal(conf.Writer()) {
+		return fmt.Errorf("cannot write the binary %s format to a terminal; redirect the output to a file", conf.Format())
+	}
+	return nil
+}
 
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// parseOutputConfig parses the flags of the output format, shared by the print and export commands
+func parseOutputConfig(c cliContext, conf *printConfiguration) error {
+	var err error
 	flagValue := c.GetStringFlagValue("format")
 	if format, ok := printer.SupportedOutputFormats[flagValue]; ok {
 		conf.format = format
 	} else {
-		return nil, fmt.Errorf("unknown output format: %s", flagValue)
+		return fmt.Errorf("unknown output format: %s", flagValue)
 	}
 
 	flagValue = c.GetStringFlagValue("metrics")
-	if flagValue == "" && conf.format == printer.CSVFormat {
-		return nil, fmt.Errorf("--metrics is required when output format is csv")
-	}
 	conf.metrics = splitCommaSeparatedMetricsNames(flagValue)
 
 	conf.noHeader = c.GetBoolFlagValue("no-header")
+	conf.typeHeader = c.GetBoolFlagValue("type-header")
 
-	return &conf, nil
+	flagValue = c.GetStringFlagValue("discover-scrapes")
+	if flagValue != "" {
+		intValue, err := strconv.ParseInt(flagValue, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse discover scrapes value: %s; cause: %w", flagValue, err)
+		}
+		if intValue <= 0 {
+			return fmt.Errorf("discover scrapes value must be positive; got: %d", intValue)
+		}
+		conf.discoverScrapes = int(intValue)
+	}
+
+	conf.schemaFile = c.GetStringFlagValue("schema-file")
+
+	conf.timestampFormat = c.GetStringFlagValue("timestamp-format")
+	if !isValidTimestampFormat(conf.timestampFormat) {
+		return fmt.Errorf("invalid timestamp format: %s", conf.timestampFormat)
+	}
+
+	flagValue = c.GetStringFlagValue("time-zone")
+	if flagValue != "" {
+		conf.timeZone, err = time.LoadLocation(flagValue)
+		if err != nil {
+			return fmt.Errorf("failed to load time zone: %s; cause: %w", flagValue, err)
+		}
+	}
+
+	conf.floatFormat = c.GetStringFlagValue("float-format")
+	if conf.floatFormat != "" && strings.Contains(fmt.Sprintf(conf.floatFormat, 1.5), "%!") {
+		return fmt.Errorf("invalid float format: %s", conf.floatFormat)
+	}
+
+	flagValue = c.GetStringFlagValue("delimiter")
+	conf.delimiter, err = parseDelimiter(flagValue)
+	if err != nil {
+		return err
+	}
+
+	conf.align = conf.interval
+	flagValue = c.GetStringFlagValue("align")
+	if flagValue != "" {
+		intValue, err := strconv.ParseInt(flagValue, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse align value: %s; cause: %w", flagValue, err)
+		}
+		if intValue < 0 {
+			return fmt.Errorf("align value must not be negative; got: %d", intValue)
+		}
+		conf.align = time.Duration(intValue) * time.Second
+	}
+
+	flagValue = c.GetStringFlagValue("fill")
+	if flagValue != "" {
+		fillPolicy, ok := printer.SupportedFillPolicies[flagValue]
+		if !ok {
+			return fmt.Errorf("unknown fill policy: %s", flagValue)
+		}
+		conf.fillPolicy = fillPolicy
+	}
+
+	flagValue = c.GetStringFlagValue("parquet-row-group-size")
+	if flagValue != "" {
+		intValue, err := strconv.ParseInt(flagValue, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse parquet row group size value: %s; cause: %w", flagValue, err)
+		}
+		if intValue <= 0 {
+			return fmt.Errorf("parquet row group size value must be positive; got: %d", intValue)
+		}
+		conf.parquetRowGroupSize = int(intValue)
+	}
+
+	conf.parquetDir = c.GetStringFlagValue("parquet-dir")
+	if conf.parquetDir != "" {
+		if conf.format != printer.ParquetFormat {
+			return fmt.Errorf("--parquet-dir requires the parquet output format")
+		}
+		if info, err := os.Stat(conf.parquetDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("parquet directory %s does not exist", conf.parquetDir)
+		}
+	}
+
+	conf.remoteWriteURL = c.GetStringFlagValue("remote-write-url")
+	if conf.remoteWriteURL == "" && conf.format == printer.RemoteWriteFormat {
+		return fmt.Errorf("--remote-write-url is required when output format is remote-write")
+	}
+
+	flagValue = c.GetStringFlagValue("remote-write-batch-size")
+	if flagValue != "" {
+		intValue, err := strconv.ParseInt(flagValue, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse remote write batch size value: %s; cause: %w", flagValue, err)
+		}
+		if intValue <= 0 {
+			return fmt.Errorf("remote write batch size value must be positive; got: %d", intValue)
+		}
+		conf.remoteWriteBatchSize = int(intValue)
+	}
+
+	return nil
+}
+
+// isValidTimestampFormat returns whether the format is either named or a Go time layout with at least one element
+func isValidTimestampFormat(format string) bool {
+	switch format {
+	case "", printer.RFC3339TimestampFormat, printer.EpochTimestampFormat, printer.EpochMillisTimestampFormat:
+		return true
+	}
+	return time.Date(2020, 11, 25, 22, 36, 42, 0, time.UTC).Format(format) != format
+}
+
+func parseDelimiter(s string) (rune, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "tab", `\t`:
+		return '\t', nil
+	}
+	runes := []rune(s)
+	if len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' || runes[0] == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter: %s; must be a single character other than a quote or a line break", s)
+	}
+	return runes[0], nil
 }
 
 func getFilterFunc(conf printer.Config) func(entry string) bool {
 	filter := conf.Filter()
-	if filter == nil {
+	if filter == nil && conf.Selector() == nil {
 		return func(entry string) bool {
 			return true
 		}
 	}
-	mapMetrics := provider.NewLabelsMetricsMapper(conf.AggregateIgnoreLabels(), ",")
+	// The selector matches the samples by all their labels, and the regular expression matches the names of the series
+	selectSamples := provider.NewSelectorSamplesMapper(conf.Selector())
+	shouldKeepMetrics := provider.NewRegexMetricsFilter(filter)
+	mapMetrics := provider.NewLabelsMetricsMapper(conf.AggregateIgnoreLabels(), ",", conf.AggregateFunc())
 	return func(entry string) bool {
 		metrics, err := parser.ParseMetrics(strings.NewReader(entry))
 		if err != nil {
 			return false
 		}
-		metrics = mapMetrics(metrics)
+		metrics = mapMetrics(selectSamples(metrics))
 		for _, m := range metrics {
-			if filter.MatchString(m.Name) {
+			if shouldKeepMetrics(m) {
 				return true
 			}
 		}
@@ -3,9 +3,12 @@ package commands
 import (
 	"os"
 	"path"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/eldada/metrics-viewer/printer"
+	"github.com/eldada/metrics-viewer/provider"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -37,20 +40,89 @@ func Test_parsePrintCmdConfig(t *testing.T) {
 			},
 			wantErr: "unknown output format: foo",
 		},
+		{
+			name: "parquet dir without the parquet format",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format":      string(printer.CSVFormat),
+					"parquet-dir": t.TempDir(),
+				},
+			},
+			wantErr: "--parquet-dir requires the parquet output format",
+		},
 		{
 			name: "output format default",
 			want: printConfiguration{
 				format: printer.OpenMetricsFormat,
 			},
 		},
+		{
+			name: "output format ndjson, no metrics",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format": string(printer.NDJSONFormat),
+				},
+			},
+			want: printConfiguration{
+				format: printer.NDJSONFormat,
+			},
+		},
+		{
+			name: "output format remote-write, no url",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format": string(printer.RemoteWriteFormat),
+				},
+			},
+			wantErr: "--remote-write-url is required when output format is remote-write",
+		},
+		{
+			name: "output format remote-write",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format":                  string(printer.RemoteWriteFormat),
+					"remote-write-url":        "http://localhost:9090/api/v1/write",
+					"remote-write-batch-size": "100",
+				},
+			},
+			want: printConfiguration{
+				format:               printer.RemoteWriteFormat,
+				remoteWriteURL:       "http://localhost:9090/api/v1/write",
+				remoteWriteBatchSize: 100,
+			},
+		},
+		{
+			name: "remote write batch size is zero",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"remote-write-batch-size": "0",
+				},
+			},
+			wantErr: "remote write batch size value must be positive; got: 0",
+		},
 		{
 			name: "output format csv, no metrics",
 			cliCtx: cliContextMock{
 				stringFlags: map[string]string{
-					"format": string(printer.CSVFormat),
+					"format":           string(printer.CSVFormat),
+					"discover-scrapes": "5",
+					"schema-file":      "schema.csv",
+				},
+			},
+			want: printConfiguration{
+				format:          printer.CSVFormat,
+				discoverScrapes: 5,
+				schemaFile:      "schema.csv",
+			},
+		},
+		{
+			name: "discover scrapes is zero",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"discover-scrapes": "0",
 				},
 			},
-			wantErr: "--metrics is required when output format is csv",
+			wantErr: "discover scrapes value must be positive; got: 0",
 		},
 		{
 			name: "output format csv, with metrics",
@@ -65,6 +137,142 @@ func Test_parsePrintCmdConfig(t *testing.T) {
 				metrics: []string{"foo", "bar", "baz"},
 			},
 		},
+		{
+			name: "csv format options",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format":           string(printer.CSVFormat),
+					"timestamp-format": printer.EpochMillisTimestampFormat,
+					"time-zone":        "Local",
+					"float-format":     "%.2e",
+					"delimiter":        "tab",
+				},
+			},
+			want: printConfiguration{
+				format:          printer.CSVFormat,
+				timestampFormat: printer.EpochMillisTimestampFormat,
+				timeZone:        time.Local,
+				floatFormat:     "%.2e",
+				delimiter:       '\t',
+			},
+		},
+		{
+			name: "custom timestamp layout and semicolon delimiter",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"timestamp-format": "02.01.2006 15:04",
+					"delimiter":        ";",
+				},
+			},
+			want: printConfiguration{
+				format:          printer.OpenMetricsFormat,
+				timestampFormat: "02.01.2006 15:04",
+				delimiter:       ';',
+			},
+		},
+		{
+			name: "invalid timestamp format",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"timestamp-format": "foo",
+				},
+			},
+			wantErr: "invalid timestamp format: foo",
+		},
+		{
+			name: "unknown time zone",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"time-zone": "Foo/Bar",
+				},
+			},
+			wantErr: "failed to load time zone: Foo/Bar; cause: unknown time zone Foo/Bar",
+		},
+		{
+			name: "invalid float format",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"float-format": "%d",
+				},
+			},
+			wantErr: "invalid float format: %d",
+		},
+		{
+			name: "invalid delimiter",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"delimiter": "::",
+				},
+			},
+			wantErr: "invalid delimiter: ::; must be a single character other than a quote or a line break",
+		},
+		{
+			name: "align and fill",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format": string(printer.CSVFormat),
+					"align":  "30",
+					"fill":   string(printer.FillPrevious),
+				},
+			},
+			want: printConfiguration{
+				format:     printer.CSVFormat,
+				align:      30 * time.Second,
+				fillPolicy: printer.FillPrevious,
+			},
+		},
+		{
+			name: "align defaults to the interval",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"interval": "15",
+				},
+			},
+			want: printConfiguration{
+				format: printer.OpenMetricsFormat,
+				align:  15 * time.Second,
+			},
+		},
+		{
+			name: "align is negative",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"align": "-1",
+				},
+			},
+			wantErr: "align value must not be negative; got: -1",
+		},
+		{
+			name: "unknown fill policy",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"fill": "zero",
+				},
+			},
+			wantErr: "unknown fill policy: zero",
+		},
+		{
+			name: "output format parquet",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"format":                 string(printer.ParquetFormat),
+					"parquet-row-group-size": "1000",
+				},
+			},
+			want: printConfiguration{
+				format:              printer.ParquetFormat,
+				parquetRowGroupSize: 1000,
+			},
+		},
+		{
+			name: "parquet row group size is zero",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"parquet-row-group-size": "0",
+				},
+			},
+			wantErr: "parquet row group size value must be positive; got: 0",
+		},
 		{
 			name: "no-header",
 			cliCtx: cliContextMock{
@@ -91,11 +299,69 @@ func Test_parsePrintCmdConfig(t *testing.T) {
 			assert.Equal(t, tc.want.Format(), conf.Format(), "format")
 			assert.Equal(t, tc.want.Metrics(), conf.Metrics(), "metrics")
 			assert.Equal(t, tc.want.NoHeader(), conf.NoHeader(), "no-header")
+			assert.Equal(t, tc.want.SchemaFile(), conf.SchemaFile(), "schema file")
+			if tc.want.DiscoverScrapes() != 0 {
+				assert.Equal(t, tc.want.DiscoverScrapes(), conf.DiscoverScrapes(), "discover scrapes")
+			}
+			if tc.want.TimestampFormat() != "" {
+				assert.Equal(t, tc.want.TimestampFormat(), conf.TimestampFormat(), "timestamp format")
+			}
+			if tc.want.TimeZone() != nil {
+				assert.Equal(t, tc.want.TimeZone(), conf.TimeZone(), "time zone")
+			}
+			if tc.want.FloatFormat() != "" {
+				assert.Equal(t, tc.want.FloatFormat(), conf.FloatFormat(), "float format")
+			}
+			if tc.want.Delimiter() != 0 {
+				assert.Equal(t, tc.want.Delimiter(), conf.Delimiter(), "delimiter")
+			}
+			if tc.want.Align() != 0 {
+				assert.Equal(t, tc.want.Align(), conf.Align(), "align")
+			}
+			if tc.want.FillPolicy() != "" {
+				assert.Equal(t, tc.want.FillPolicy(), conf.FillPolicy(), "fill policy")
+			}
+			if tc.want.ParquetRowGroupSize() != 0 {
+				assert.Equal(t, tc.want.ParquetRowGroupSize(), conf.ParquetRowGroupSize(), "parquet row group size")
+			}
+			assert.Equal(t, tc.want.RemoteWriteURL(), conf.RemoteWriteURL(), "remote write url")
+			if tc.want.RemoteWriteBatchSize() != 0 {
+				assert.Equal(t, tc.want.RemoteWriteBatchSize(), conf.RemoteWriteBatchSize(), "remote write batch size")
+			}
 			assert.Equal(t, os.Stdout, conf.Writer(), "writer")
 		})
 	}
 }
 
+func Test_getFilterFunc(t *testing.T) {
+	entry := "foo{status=\"200\",path=\"/a\"} 1\nfoo{status=\"500\",path=\"/b\"} 2\n"
+	tests := []struct {
+		name     string
+		filter   string
+		expected bool
+	}{
+		{name: "selector of an ignored label", filter: `foo{status="200"}`, expected: true},
+		{name: "selector of an ignored label not matching", filter: `foo{status="404"}`, expected: false},
+		{name: "selector of an ignored label and a kept one", filter: `foo{status="200",path="/b"}`, expected: false},
+		{name: "regular expression of the series name", filter: `foo\{path="/a"\}`, expected: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := printConfiguration{commonConfiguration: commonConfiguration{
+				aggregateIgnoreLabels: provider.StringSet{"status": {}},
+			}}
+			if provider.IsSelector(tc.filter) {
+				selector, err := provider.ParseSelector(tc.filter)
+				require.NoError(t, err)
+				conf.selector = selector
+			} else {
+				conf.filter = regexp.MustCompile(tc.filter)
+			}
+			assert.Equal(t, tc.expected, getFilterFunc(conf)(entry))
+		})
+	}
+}
+
 func Test_splitCommaSeparatedMetricsNames(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+func GetRecordCommand() components.Command {
+	return components.Command{
+		Name:        "record",
+		Description: "Record the scraped Open Metrics payloads, to replay later using --replay",
+		Aliases:     []string{"r"},
+		Flags:       getRecordFlags(),
+		Action: func(c *components.Context) error {
+			return recordCmd(c)
+		},
+	}
+}
+
+func getRecordFlags() []components.Flag {
+	flags := append([]components.Flag{
+		UrlFlag,
+	}, getUrlRequestFlags()...)
+	return append(flags,
+		ServerFlag,
+		ProductsFlag,
+		TimeoutFlag,
+		RetriesFlag,
+		IntervalFlag,
+		components.NewStringFlag("output", "File to write the compressed recording to (required)"),
+		components.NewStringFlag("duration", "Duration of the recording in seconds. Records until interrupted if not set"),
+	)
+}
+
+type recordConfiguration struct {
+	commonConfiguration
+	output   string
+	duration time.Duration
+}
+
+func (c recordConfiguration) Output() string {
+	return c.output
+}
+
+func (c recordConfiguration) Duration() time.Duration {
+	return c.duration
+}
+
+func (c recordConfiguration) String() string {
+	return fmt.Sprintf("%s, output: '%s', duration: %s", c.commonConfiguration, c.output, c.duration)
+}
+
+func recordCmd(c *components.Context) error {
+	conf, err := parseRecordCmdConfig(c)
+	if err != nil {
+		return err
+	}
+	log.Debug("command config:", conf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if conf.duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, conf.duration)
+		defer cancel()
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signalChan
+		cancel()
+	}()
+
+	f, err := os.Create(conf.output)
+	if err != nil {
+		return fmt.Errorf("could not create recording %s; cause: %w", conf.output, err)
+	}
+	defer f.Close()
+	w, err := provider.NewRecordWriter(f)
+	if err != nil {
+		return err
+	}
+	count := record(ctx, conf.sources, conf.interval, w)
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("could not close recording %s; cause: %w", conf.output, err)
+	}
+	log.Info(fmt.Sprintf("recorded %d payloads to %s", count, conf.output))
+	return nil
+}
+
+// record writes the payloads of all the sources at each interval until the context is done, returning the number of written payloads
+func record(ctx context.Context, sources []provider.Source, interval time.Duration, w *provider.RecordWriter) int {
+	count := 0
+	mu := sync.Mutex{}
+	scrape := func() {
+		wg := sync.WaitGroup{}
+		for _, source := range sources {
+			wg.Add(1)
+			go func(source provider.Source) {
+				defer wg.Done()
+				data, err := source.UrlMetricsFetcher.Get(ctx)
+				if err != nil {
+					log.Warn(fmt.Sprintf("failed to get metrics from %s; cause: %s", source.Name, err))
+					return
+				}
+				r := provider.Record{Time: time.Now(), Source: source.Name, Payload: data}
+				if f, ok := source.UrlMetricsFetcher.(provider.ContentTypeAware); ok {
+					r.ContentType = f.ContentType()
+				}
+				if err := w.Write(r); err != nil {
+					log.Error(err)
+					return
+				}
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}(source)
+		}
+		wg.Wait()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	scrape()
+	for {
+		select {
+		case <-ctx.Done():
+			return count
+		case <-ticker.C:
+			scrape()
+		}
+	}
+}
+
+func parseRecordCmdConfig(c cliContext) (*recordConfiguration, error) {
+	commonConfig, err := parseCommonConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	conf := recordConfiguration{
+		commonConfiguration: *commonConfig,
+	}
+	for _, source := range conf.sources {
+		if source.UrlMetricsFetcher == nil {
+			return nil, fmt.Errorf("only url and server-id sources can be recorded; got: %s", source)
+		}
+	}
+
+	conf.output = c.GetStringFlagValue("output")
+	if conf.output == "" {
+		return nil, fmt.Errorf("--output is required")
+	}
+
+	flagValue := c.GetStringFlagValue("duration")
+	if flagValue != "" {
+		intValue, err := strconv.ParseInt(flagValue, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse duration value: %s; cause: %w", flagValue, err)
+		}
+		if intValue <= 0 {
+			return nil, fmt.Errorf("duration value must be positive; got: %d", intValue)
+		}
+		conf.duration = time.Duration(intValue) * time.Second
+	}
+
+	return &conf, nil
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseRecordCmdConfig(t *testing.T) {
+	defaultCliCtx := cliContextMock{
+		stringFlags: map[string]string{
+			"url":      "foo",
+			"interval": "5",
+			"output":   "recording.gz",
+		},
+	}
+	testFilepath := path.Join(t.TempDir(), "foo")
+	require.NoError(t, os.WriteFile(testFilepath, []byte("hello"), 0777))
+	tests := []struct {
+		name    string
+		cliCtx  cliContextMock
+		want    recordConfiguration
+		wantErr string
+	}{
+		{
+			name: "output",
+			want: recordConfiguration{
+				output: "recording.gz",
+			},
+		},
+		{
+			name: "no output",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"output": "",
+				},
+			},
+			wantErr: "--output is required",
+		},
+		{
+			name: "duration",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"duration": "60",
+				},
+			},
+			want: recordConfiguration{
+				output:   "recording.gz",
+				duration: time.Minute,
+			},
+		},
+		{
+			name: "zero duration",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"duration": "0",
+				},
+			},
+			wantErr: "duration value must be positive; got: 0",
+		},
+		{
+			name: "file source",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"url":  "",
+					"file": testFilepath,
+				},
+			},
+			wantErr: "only url and server-id sources can be recorded; got: foo: file: '" + testFilepath + "'",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cliCtx := defaultCliCtx.OverrideWith(tc.cliCtx)
+			conf, err := parseRecordCmdConfig(cliCtx)
+			if tc.wantErr != "" {
+				require.NotNil(t, err, "error")
+				assert.Equal(t, tc.wantErr, err.Error(), "error")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want.Output(), conf.Output(), "output")
+			assert.Equal(t, tc.want.Duration(), conf.Duration(), "duration")
+		})
+	}
+}
+
+func Test_record(t *testing.T) {
+	filename := path.Join(t.TempDir(), "recording.gz")
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	w, err := provider.NewRecordWriter(f)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	count := record(ctx, []provider.Source{
+		{Name: "node1", UrlMetricsFetcher: staticMetricsFetcher("foo 1\n")},
+		{Name: "node2", UrlMetricsFetcher: staticMetricsFetcher("foo 2\n")},
+	}, 10*time.Millisecond, w)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	records, err := provider.ReadRecords(filename)
+	require.NoError(t, err)
+	assert.Len(t, records, count)
+	assert.GreaterOrEqual(t, count, 2)
+	for _, r := range records {
+		assert.Equal(t, map[string]string{"node1": "foo 1\n", "node2": "foo 2\n"}[r.Source], string(r.Payload), "payload of %s", r.Source)
+	}
+}
+
+type staticMetricsFetcher string
+
+func (f staticMetricsFetcher) Get(_ context.Context) ([]byte, error) {
+	return []byte(f), nil
+}
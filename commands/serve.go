@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/eldada/metrics-viewer/exporter"
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/jfrog/jfrog-cli-core/v2/plugins/components"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+func GetServeCommand() components.Command {
+	return components.Command{
+		Name:        "serve",
+		Description: "Expose the latest values of the metrics on a local /metrics endpoint, to be scraped by Prometheus",
+		Aliases:     []string{"s"},
+		Flags:       getServeFlags(),
+		Action: func(c *components.Context) error {
+			return serveCmd(c)
+		},
+	}
+}
+
+func getServeFlags() []components.Flag {
+	flags := append([]components.Flag{
+		FileFlag,
+		UrlFlag,
+		PrometheusFlag,
+	}, getUrlRequestFlags()...)
+	return append(flags,
+		ServerFlag,
+		ProductsFlag,
+		TimeoutFlag,
+		RetriesFlag,
+		IntervalFlag,
+		FilterFlag,
+		ReplayFlag,
+		ReplaySpeedFlag,
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("listen", "Address to listen on for scrapes of the /metrics endpoint"),
+			DefaultValue: ":9596",
+		},
+		components.StringFlag{
+			BaseFlag:     components.NewFlag("stale", "Time in seconds after which a series whose latest sample is older is no longer exposed, by the recording time when replaying"),
+			DefaultValue: "300",
+		},
+	)
+}
+
+type serveConfiguration struct {
+	commonConfiguration
+	listen     string
+	staleAfter time.Duration
+}
+
+func (c serveConfiguration) Listen() string {
+	return c.listen
+}
+
+// TimeWindow is the stale duration, as the exposed metrics have no other time window
+func (c serveConfiguration) TimeWindow() time.Duration {
+	return c.staleAfter
+}
+
+func (c serveConfiguration) String() string {
+	return fmt.Sprintf("%s, listen: %s, stale: %s", c.commonConfiguration, c.listen, c.staleAfter)
+}
+
+func serveCmd(c *components.Context) error {
+	conf, err := parseServeCmdConfig(c)
+	if err != nil {
+		return err
+	}
+	log.Debug("command config:", conf)
+
+	prov, err := provider.New(conf)
+	if err != nil {
+		return err
+	}
+	shouldKeepMetrics := provider.NewRegexMetricsFilter(conf.Filter())
+	if conf.Selector() != nil {
+		shouldKeepMetrics = provider.NewSelectorMetricsFilter(conf.Selector())
+	}
+	e := exporter.New(prov, shouldKeepMetrics, conf.staleAfter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signalChan
+		cancel()
+	}()
+
+	// File sources are followed from their end, after exposing their recent metrics
+	if err := e.Backfill(); err != nil {
+		log.Warn("failed to backfill the exported metrics:", err.Error())
+	}
+	if err := e.Update(ctx); err != nil {
+		log.Warn("failed to update the exported metrics:", err.Error())
+	}
+	go e.Run(ctx, conf.interval)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	server := &http.Server{Addr: conf.listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	log.Info(fmt.Sprintf("serving metrics on %s/metrics", conf.listen))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve metrics on %s; cause: %w", conf.listen, err)
+	}
+	return nil
+}
+
+func parseServeCmdConfig(c cliContext) (*serveConfiguration, error) {
+	commonConfig, err := parseCommonConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	conf := serveConfiguration{
+		commonConfiguration: *commonConfig,
+	}
+
+	conf.listen = c.GetStringFlagValue("listen")
+	if conf.listen == "" {
+		return nil, fmt.Errorf("--listen is required")
+	}
+
+	flagValue := c.GetStringFlagValue("stale")
+	intValue, err := strconv.ParseInt(flagValue, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stale value: %s; cause: %w", flagValue, err)
+	}
+	if intValue <= 0 {
+		return nil, fmt.Errorf("stale value must be positive; got: %d", intValue)
+	}
+	conf.staleAfter = time.Duration(intValue) * time.Second
+
+	return &conf, nil
+}
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseServeCmdConfig(t *testing.T) {
+	defaultCliCtx := cliContextMock{
+		stringFlags: map[string]string{
+			"listen": ":9596",
+			"stale":  "300",
+		},
+	}
+	testParseCommonConfig(t, defaultCliCtx, func(ctx cliContext) (commonConfig, error) {
+		return parseServeCmdConfig(ctx)
+	})
+	testFilepath := path.Join(t.TempDir(), "foo")
+	require.NoError(t, os.WriteFile(testFilepath, []byte("hello"), 0777))
+	defaultCliCtx.stringFlags["file"] = testFilepath
+	defaultCliCtx.stringFlags["interval"] = "5"
+	tests := []struct {
+		name    string
+		cliCtx  cliContextMock
+		want    serveConfiguration
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: serveConfiguration{
+				listen:     ":9596",
+				staleAfter: 5 * time.Minute,
+			},
+		},
+		{
+			name: "listen",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"listen": "localhost:8080",
+				},
+			},
+			want: serveConfiguration{
+				listen:     "localhost:8080",
+				staleAfter: 5 * time.Minute,
+			},
+		},
+		{
+			name: "no listen",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"listen": "",
+				},
+			},
+			wantErr: "--listen is required",
+		},
+		{
+			name: "stale is zero",
+			cliCtx: cliContextMock{
+				stringFlags: map[string]string{
+					"stale": "0",
+				},
+			},
+			wantErr: "stale value must be positive; got: 0",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cliCtx := defaultCliCtx.OverrideWith(tc.cliCtx)
+			conf, err := parseServeCmdConfig(cliCtx)
+			if tc.wantErr != "" {
+				require.NotNil(t, err, "error")
+				assert.Equal(t, tc.wantErr, err.Error(), "error")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want.Listen(), conf.Listen(), "listen")
+			assert.Equal(t, tc.want.TimeWindow(), conf.TimeWindow(), "stale")
+		})
+	}
+}
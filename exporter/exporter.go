@@ -0,0 +1,275 @@
+// Package exporter exposes the latest values of scraped metrics in the Prometheus text exposition format,
+// so metrics which are only available in log files can be scraped by a standard Prometheus.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// New creates an exporter of the metrics of the provider which pass the filter.
+// Series whose latest sample is older than the stale duration are no longer exposed. The age of the samples is judged
+// by the clock of the provider if it has one (e.g. the recording time of a replay), or by the wall clock otherwise.
+func New(prov provider.Provider, shouldKeepMetrics provider.MetricsFilterFunc, staleAfter time.Duration) *Exporter {
+	clock := now
+	if c, ok := prov.(provider.Clock); ok {
+		clock = c.Now
+	}
+	return &Exporter{
+		provider:          prov,
+		shouldKeepMetrics: shouldKeepMetrics,
+		staleAfter:        staleAfter,
+		clock:             clock,
+		families:          map[string]*family{},
+	}
+}
+
+type Exporter struct {
+	provider          provider.Provider
+	shouldKeepMetrics provider.MetricsFilterFunc
+	staleAfter        time.Duration
+	clock             func() time.Time
+	families          map[string]*family // by name
+	mu                sync.RWMutex
+}
+
+// family is a metric family as exposed, e.g. a histogram with its "_bucket", "_sum" and "_count" series
+type family struct {
+	name       string
+	help       string
+	metricType string
+	series     []*series // in the order they were first seen
+	index      map[string]*series
+}
+
+type series struct {
+	name      string
+	labels    map[string]string
+	value     float64
+	timestamp time.Time
+}
+
+// Run updates the exported metrics at every interval until the context is done
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Update(ctx); err != nil {
+				log.Warn("failed to update the exported metrics:", err.Error())
+			}
+		}
+	}
+}
+
+// Backfill exposes the metrics which the provider had before it started, e.g. the recent ones in its log files,
+// if it can backfill them. It is called before the first update, which then gets only the new metrics.
+func (e *Exporter) Backfill() error {
+	backfiller, ok := e.provider.(provider.Backfiller)
+	if !ok {
+		return nil
+	}
+	metricsCollection, err := backfiller.Backfill(e.clock().Add(-e.staleAfter))
+	if err != nil {
+		return err
+	}
+	e.update(metricsCollection)
+	return nil
+}
+
+// Update gets the metrics of the provider, keeping the latest value of each series
+func (e *Exporter) Update(ctx context.Context) error {
+	metricsCollection, err := e.provider.Get(ctx)
+	if err != nil {
+		return err
+	}
+	e.update(metricsCollection)
+	return nil
+}
+
+// update keeps the latest value of each series, and evicts the series whose latest sample is older than the stale duration.
+// Samples without a timestamp are stamped with the update time.
+func (e *Exporter) update(metricsCollection []models.Metrics) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	updated := e.clock()
+	for _, metrics := range metricsCollection {
+		var f *family
+		for i, metric := range metrics.Metrics {
+			// Each sample is filtered on its own, so a selector matches its labels rather than those of the first sample
+			sample := metrics
+			sample.Metrics = metrics.Metrics[i : i+1]
+			if !e.shouldKeepMetrics(sample) {
+				continue
+			}
+			if f == nil {
+				f = e.family(metrics)
+			}
+			timestamp := metric.Timestamp
+			if timestamp.IsZero() {
+				timestamp = updated
+			}
+			signature := metrics.Key + models.LabelsSignature(metric.Labels)
+			s, found := f.index[signature]
+			if !found {
+				s = &series{name: metrics.Key, labels: metric.Labels}
+				f.index[signature] = s
+				f.series = append(f.series, s)
+			} else if timestamp.Before(s.timestamp) {
+				continue
+			}
+			s.value = metric.Value
+			s.timestamp = timestamp
+		}
+	}
+	e.evictStale(updated.Add(-e.staleAfter))
+}
+
+// family returns the family of the metrics, updating its help and type with the latest known ones
+func (e *Exporter) family(metrics models.Metrics) *family {
+	name, metricType := familyOf(metrics)
+	f, found := e.families[name]
+	if !found {
+		f = &family{
+			name:  name,
+			index: map[string]*series{},
+		}
+		e.families[name] = f
+	}
+	if metrics.Description != "" {
+		f.help = metrics.Description
+	}
+	if metricType != "untyped" || f.metricType == "" {
+		f.metricType = metricType
+	}
+	return f
+}
+
+func (e *Exporter) evictStale(before time.Time) {
+	for name, f := range e.families {
+		var fresh []*series
+		for _, s := range f.series {
+			if s.timestamp.Before(before) {
+				delete(f.index, s.name+models.LabelsSignature(s.labels))
+				continue
+			}
+			fresh = append(fresh, s)
+		}
+		f.series = fresh
+		if len(fresh) == 0 {
+			delete(e.families, name)
+		}
+	}
+}
+
+// familyOf returns the name and type of the family of the metrics as exposed in the text format.
+// OpenMetrics types which are not supported by the text format are exposed as untyped.
+func familyOf(metrics models.Metrics) (string, string) {
+	switch metrics.Type {
+	case models.MetricTypeCounter, models.MetricTypeGauge, models.MetricTypeHistogram, models.MetricTypeSummary:
+		return metrics.FamilyName(), string(metrics.Type)
+	}
+	return metrics.Key, "untyped"
+}
+
+// ServeHTTP writes the latest values of all the series. Timestamps are omitted, so the values are stamped by the scraper.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if err := e.Write(w); err != nil {
+		log.Debug("failed to write the exported metrics:", err.Error())
+	}
+}
+
+// Write writes the latest values of all the series in the text exposition format
+func (e *Exporter) Write(w io.Writer) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.families))
+	for name := range e.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := strings.Builder{}
+	for _, name := range names {
+		f := e.families[name]
+		if f.help != "" {
+			out.WriteString(fmt.Sprintf("# HELP %s %s\n", f.name, escapeHelp(f.help)))
+		}
+		out.WriteString(fmt.Sprintf("# TYPE %s %s\n", f.name, f.metricType))
+		for _, s := range f.series {
+			out.WriteString(s.name)
+			writeLabels(&out, s.labels)
+			out.WriteRune(' ')
+			out.WriteString(formatValue(s.value))
+			out.WriteRune('\n')
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func writeLabels(out *strings.Builder, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out.WriteRune('{')
+	for i, k := range keys {
+		if i > 0 {
+			out.WriteRune(',')
+		}
+		out.WriteString(fmt.Sprintf(`%s="%s"`, k, escapeLabelValue(labels[k])))
+	}
+	out.WriteRune('}')
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var nowFunc = time.Now
+
+func now() time.Time {
+	return nowFunc()
+}
@@ -0,0 +1,185 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	wallTime := time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	nowFunc = func() time.Time {
+		return wallTime
+	}
+	defer func() { nowFunc = time.Now }()
+	t0 := time.Date(2020, 11, 25, 22, 36, 42, 0, time.UTC)
+	prov := &providerMock{}
+	e := New(prov, provider.NewRegexMetricsFilter(nil), time.Minute)
+
+	prov.metricsCollection = []models.Metrics{
+		{
+			Key: "http_requests_total", Name: "http_requests_total", Type: models.MetricTypeCounter,
+			Description: "Requests.\nAll of them",
+			Metrics: []models.Metric{
+				{Value: 1, Labels: map[string]string{"path": `/a"b`}, Timestamp: t0},
+				{Value: 2, Labels: map[string]string{"path": "/a"}, Timestamp: t0},
+				{Value: 3, Labels: map[string]string{"path": "/a"}, Timestamp: t0.Add(time.Second)},
+			},
+		},
+		{
+			Key: "latency_bucket", Name: "latency_bucket", Type: models.MetricTypeHistogram, Description: "Latency.",
+			Metrics: []models.Metric{
+				{Value: 1, Labels: map[string]string{"le": "0.5"}, Timestamp: t0},
+				{Value: 2, Labels: map[string]string{"le": "+Inf"}, Timestamp: t0},
+			},
+		},
+		{
+			Key: "latency_sum", Name: "latency_sum", Type: models.MetricTypeHistogram, Description: "Latency.",
+			Metrics: []models.Metric{{Value: 0.7, Timestamp: t0}},
+		},
+		{
+			Key: "latency_count", Name: "latency_count", Type: models.MetricTypeHistogram, Description: "Latency.",
+			Metrics: []models.Metric{{Value: 2, Timestamp: t0}},
+		},
+		{
+			Key: "temperature", Name: "temperature", Type: models.MetricTypeGauge,
+			Metrics: []models.Metric{{Value: math.NaN(), Timestamp: t0}},
+		},
+	}
+	require.NoError(t, e.Update(context.Background()))
+
+	// Later values of only some of the series
+	wallTime = wallTime.Add(50 * time.Second)
+	prov.metricsCollection = []models.Metrics{
+		{
+			Key: "temperature", Name: "temperature", Type: models.MetricTypeUntyped,
+			Metrics: []models.Metric{{Value: 21.5, Timestamp: t0.Add(time.Minute)}},
+		},
+		{
+			// just read, but sampled too long ago
+			Key: "queue_size", Name: "queue_size", Type: models.MetricTypeGauge,
+			Metrics: []models.Metric{{Value: 5, Timestamp: t0.Add(-time.Minute)}},
+		},
+	}
+	require.NoError(t, e.Update(context.Background()))
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+	assert.Equal(t, `# HELP http_requests_total Requests.\nAll of them
+# TYPE http_requests_total counter
+http_requests_total{path="/a\"b"} 1
+http_requests_total{path="/a"} 3
+# HELP latency Latency.
+# TYPE latency histogram
+latency_bucket{le="0.5"} 1
+latency_bucket{le="+Inf"} 2
+latency_sum 0.7
+latency_count 2
+# TYPE temperature gauge
+temperature 21.5
+`, scrape(t, server.URL))
+
+	// The series whose latest sample is older than a minute are stale
+	wallTime = wallTime.Add(20 * time.Second)
+	prov.metricsCollection = nil
+	require.NoError(t, e.Update(context.Background()))
+	assert.Equal(t, `# TYPE temperature gauge
+temperature 21.5
+`, scrape(t, server.URL))
+}
+
+func TestExporter_Backfill(t *testing.T) {
+	wallTime := time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	nowFunc = func() time.Time {
+		return wallTime
+	}
+	defer func() { nowFunc = time.Now }()
+	prov := &backfillerMock{backfilled: []models.Metrics{
+		{Key: "foo", Name: "foo", Type: models.MetricTypeGauge, Metrics: []models.Metric{{Value: 1, Timestamp: wallTime.Add(-10 * time.Second)}}},
+	}}
+	e := New(prov, provider.NewRegexMetricsFilter(nil), time.Minute)
+	require.NoError(t, e.Backfill())
+	assert.Equal(t, wallTime.Add(-time.Minute), prov.since)
+	require.NoError(t, e.Update(context.Background()))
+	server := httptest.NewServer(e)
+	defer server.Close()
+	assert.Equal(t, "# TYPE foo gauge\nfoo 1\n", scrape(t, server.URL))
+}
+
+func TestExporter_providerClock(t *testing.T) {
+	recordingTime := time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	prov := &clockMock{now: recordingTime, providerMock: providerMock{metricsCollection: []models.Metrics{
+		{Key: "foo", Name: "foo", Type: models.MetricTypeGauge, Metrics: []models.Metric{{Value: 1, Timestamp: recordingTime.Add(-10 * time.Second)}}},
+	}}}
+	e := New(prov, provider.NewRegexMetricsFilter(nil), time.Minute)
+	require.NoError(t, e.Update(context.Background()))
+	server := httptest.NewServer(e)
+	defer server.Close()
+	assert.Equal(t, "# TYPE foo gauge\nfoo 1\n", scrape(t, server.URL))
+
+	prov.now = recordingTime.Add(2 * time.Minute)
+	prov.metricsCollection = nil
+	require.NoError(t, e.Update(context.Background()))
+	assert.Equal(t, "", scrape(t, server.URL))
+}
+
+func TestExporter_filter(t *testing.T) {
+	prov := &providerMock{metricsCollection: []models.Metrics{
+		{Key: "foo", Name: "foo", Type: models.MetricTypeGauge, Metrics: []models.Metric{{Value: 1}}},
+		{Key: "bar", Name: "bar", Type: models.MetricTypeGauge, Metrics: []models.Metric{{Value: 2}}},
+	}}
+	e := New(prov, func(metrics models.Metrics) bool {
+		return metrics.Name == "bar"
+	}, time.Minute)
+	require.NoError(t, e.Update(context.Background()))
+	server := httptest.NewServer(e)
+	defer server.Close()
+	assert.Equal(t, "# TYPE bar gauge\nbar 2\n", scrape(t, server.URL))
+}
+
+func scrape(t *testing.T, url string) string {
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header.Get("Content-Type"))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+type providerMock struct {
+	metricsCollection []models.Metrics
+}
+
+func (p *providerMock) Get(_ context.Context) ([]models.Metrics, error) {
+	return p.metricsCollection, nil
+}
+
+type backfillerMock struct {
+	providerMock
+	backfilled []models.Metrics
+	since      time.Time
+}
+
+func (p *backfillerMock) Backfill(since time.Time) ([]models.Metrics, error) {
+	p.since = since
+	return p.backfilled, nil
+}
+
+type clockMock struct {
+	providerMock
+	now time.Time
+}
+
+func (p *clockMock) Now() time.Time {
+	return p.now
+}
@@ -0,0 +1,307 @@
+package expression
+
+import (
+	"sort"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+// rangeFunc computes a single value from the points of a series within a range, or false if there are not enough points
+type rangeFunc func(points []models.Metric) (float64, bool)
+
+var functions = map[string]rangeFunc{
+	"rate": func(points []models.Metric) (float64, bool) {
+		if len(points) < 2 {
+			return 0, false
+		}
+		seconds := points[len(points)-1].Timestamp.Sub(points[0].Timestamp).Seconds()
+		if seconds <= 0 {
+			return 0, false
+		}
+		return increase(points) / seconds, true
+	},
+	"increase": func(points []models.Metric) (float64, bool) {
+		if len(points) < 2 {
+			return 0, false
+		}
+		return increase(points), true
+	},
+	"avg_over_time":   overTime(provider.AggregateAvg),
+	"min_over_time":   overTime(provider.AggregateMin),
+	"max_over_time":   overTime(provider.AggregateMax),
+	"sum_over_time":   overTime(provider.AggregateSum),
+	"count_over_time": overTime(provider.AggregateCount),
+}
+
+// increase returns the total increase of a counter, assuming a reset whenever the value drops
+func increase(points []models.Metric) float64 {
+	var total float64
+	for i := 1; i < len(points); i++ {
+		delta := points[i].Value - points[i-1].Value
+		if delta < 0 {
+			delta = points[i].Value
+		}
+		total += delta
+	}
+	return total
+}
+
+func overTime(f provider.AggregateFunc) rangeFunc {
+	return func(points []models.Metric) (float64, bool) {
+		if len(points) == 0 {
+			return 0, false
+		}
+		a := provider.NewAggregation()
+		for _, p := range points {
+			a.Add(p.Value)
+		}
+		return a.Value(f), true
+	}
+}
+
+// series is a single label set of a metric, with its points ordered by time
+type series struct {
+	labels map[string]string
+	points []models.Metric
+}
+
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// result is the value of a node at one evaluation time, scalar results have a nil vector
+type result struct {
+	scalar   float64
+	vector   []sample
+	isScalar bool
+}
+
+func (r result) samples() []sample {
+	if r.isScalar {
+		return []sample{{labels: map[string]string{}, value: r.scalar}}
+	}
+	return r.vector
+}
+
+type evaluator struct {
+	index    map[string][]*series
+	lookback time.Duration
+}
+
+// Evaluate evaluates the expression at every step from end back to start, over the given metrics.
+// A selector takes the latest value of each series within two steps before the evaluation time.
+// The result is a metrics series per label set, named after the expression.
+func (e *Expression) Evaluate(metricsCollection []models.Metrics, start, end time.Time, step time.Duration) []models.Metrics {
+	ev := evaluator{
+		index:    newSeriesIndex(metricsCollection),
+		lookback: 2 * step,
+	}
+	derived := models.Metrics{
+		Key:         e.Name,
+		Name:        e.Name,
+		Description: e.Source,
+		Type:        models.MetricTypeGauge,
+	}
+	var times []time.Time
+	for t := end; !t.Before(start); t = t.Add(-step) {
+		times = append(times, t)
+	}
+	for i := len(times) - 1; i >= 0; i-- {
+		for _, s := range ev.eval(e.root, times[i]).samples() {
+			derived.Metrics = append(derived.Metrics, models.Metric{
+				Value:     s.value,
+				Labels:    s.labels,
+				Timestamp: times[i],
+			})
+		}
+	}
+	if len(derived.Metrics) == 0 {
+		return nil
+	}
+	mapMetrics := provider.NewLabelsMetricsMapper(provider.StringSet{"NONE": struct{}{}}, ",", provider.AggregateSum)
+	return mapMetrics([]models.Metrics{derived})
+}
+
+// Latest returns the time of the newest point of the given metrics, or false if there are none
+func Latest(metricsCollection []models.Metrics) (time.Time, bool) {
+	var latest time.Time
+	for _, metrics := range metricsCollection {
+		for _, metric := range metrics.Metrics {
+			if metric.Timestamp.After(latest) {
+				latest = metric.Timestamp
+			}
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+func newSeriesIndex(metricsCollection []models.Metrics) map[string][]*series {
+	index := map[string][]*series{}
+	bySignature := map[string]*series{}
+	for _, metrics := range metricsCollection {
+		for _, metric := range metrics.Metrics {
+			signature := metrics.Key + models.LabelsSignature(metric.Labels)
+			s, found := bySignature[signature]
+			if !found {
+				s = &series{labels: metric.Labels}
+				bySignature[signature] = s
+				index[metrics.Key] = append(index[metrics.Key], s)
+			}
+			s.points = append(s.points, metric)
+		}
+	}
+	for _, s := range bySignature {
+		sort.SliceStable(s.points, func(i, j int) bool {
+			return s.points[i].Timestamp.Before(s.points[j].Timestamp)
+		})
+	}
+	return index
+}
+
+func (ev evaluator) eval(n node, t time.Time) result {
+	switch n := n.(type) {
+	case *numberLiteral:
+		return result{scalar: n.value, isScalar: true}
+	case *vectorSelector:
+		var vector []sample
+		for _, s := range ev.selectSeries(n) {
+			points := pointsInRange(s.points, t.Add(-ev.lookback), t)
+			if len(points) > 0 {
+				vector = append(vector, sample{labels: s.labels, value: points[len(points)-1].Value})
+			}
+		}
+		return result{vector: vector}
+	case *functionCall:
+		var vector []sample
+		for _, s := range ev.selectSeries(n.arg.vectorSelector) {
+			if v, ok := functions[n.name](pointsInRange(s.points, t.Add(-n.arg.rng), t)); ok {
+				vector = append(vector, sample{labels: s.labels, value: v})
+			}
+		}
+		return result{vector: vector}
+	case *aggregateExpr:
+		return ev.aggregate(n, ev.eval(n.expr, t).samples())
+	case *binaryExpr:
+		return binaryOp(n.op, ev.eval(n.left, t), ev.eval(n.right, t))
+	}
+	return result{}
+}
+
+func (ev evaluator) selectSeries(selector *vectorSelector) []*series {
+	var selected []*series
+	for _, s := range ev.index[selector.name] {
+		matches := true
+		for _, m := range selector.matchers {
+			if !m.Matches(s.labels) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			selected = append(selected, s)
+		}
+	}
+	return selected
+}
+
+// pointsInRange returns the points in the range (from, to]
+func pointsInRange(points []models.Metric, from, to time.Time) []models.Metric {
+	i := sort.Search(len(points), func(i int) bool {
+		return points[i].Timestamp.After(from)
+	})
+	j := sort.Search(len(points), func(i int) bool {
+		return points[i].Timestamp.After(to)
+	})
+	return points[i:j]
+}
+
+func (ev evaluator) aggregate(n *aggregateExpr, samples []sample) result {
+	type group struct {
+		labels      map[string]string
+		aggregation *provider.Aggregation
+	}
+	groups := map[string]*group{}
+	var order []string
+	for _, s := range samples {
+		labels := groupingLabels(s.labels, n.grouping, n.without)
+		signature := models.LabelsSignature(labels)
+		g, found := groups[signature]
+		if !found {
+			g = &group{labels: labels, aggregation: provider.NewAggregation()}
+			groups[signature] = g
+			order = append(order, signature)
+		}
+		g.aggregation.Add(s.value)
+	}
+	vector := make([]sample, 0, len(groups))
+	for _, signature := range order {
+		g := groups[signature]
+		vector = append(vector, sample{labels: g.labels, value: g.aggregation.Value(provider.SupportedAggregateFuncs[n.op])})
+	}
+	return result{vector: vector}
+}
+
+func groupingLabels(labels map[string]string, grouping []string, without bool) map[string]string {
+	grouped := map[string]string{}
+	if without {
+		for k, v := range labels {
+			grouped[k] = v
+		}
+		for _, k := range grouping {
+			delete(grouped, k)
+		}
+		return grouped
+	}
+	for _, k := range grouping {
+		if v, ok := labels[k]; ok {
+			grouped[k] = v
+		}
+	}
+	return grouped
+}
+
+// binaryOp applies the operator on scalars, on a vector and a scalar, or on vector samples with identical labels
+func binaryOp(op string, left, right result) result {
+	if left.isScalar && right.isScalar {
+		return result{scalar: apply(op, left.scalar, right.scalar), isScalar: true}
+	}
+	var vector []sample
+	switch {
+	case right.isScalar:
+		for _, s := range left.vector {
+			vector = append(vector, sample{labels: s.labels, value: apply(op, s.value, right.scalar)})
+		}
+	case left.isScalar:
+		for _, s := range right.vector {
+			vector = append(vector, sample{labels: s.labels, value: apply(op, left.scalar, s.value)})
+		}
+	default:
+		rightSamples := make(map[string]sample, len(right.vector))
+		for _, s := range right.vector {
+			rightSamples[models.LabelsSignature(s.labels)] = s
+		}
+		for _, s := range left.vector {
+			if r, found := rightSamples[models.LabelsSignature(s.labels)]; found {
+				vector = append(vector, sample{labels: s.labels, value: apply(op, s.value, r.value)})
+			}
+		}
+	}
+	return result{vector: vector}
+}
+
+func apply(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+// Package expression implements a small subset of PromQL for deriving metrics from other metrics.
+//
+// Supported are number literals, selectors with label matchers (foo{a="b",c=~"d.*"}),
+// arithmetic (+, -, *, /), range functions over selectors with a range (rate(foo[1m])),
+// and aggregations with optional grouping (sum by (a) (foo)).
+package expression
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Expression is a named expression, evaluated into new metrics with that name
+type Expression struct {
+	Name   string
+	Source string
+	root   node
+}
+
+func New(name, source string) (*Expression, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid expression name: '%s'", name)
+	}
+	root, err := parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expression %s; cause: %w", name, err)
+	}
+	return &Expression{
+		Name:   name,
+		Source: source,
+		root:   root,
+	}, nil
+}
+
+// Parse parses a named expression definition in the form: name=expression
+func Parse(definition string) (*Expression, error) {
+	parts := strings.SplitN(definition, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expression must be in the form name=expression; got: '%s'", definition)
+	}
+	return New(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+}
+
+// ParseList parses named expression definitions, skipping empty ones
+func ParseList(definitions []string) ([]*Expression, error) {
+	var expressions []*Expression
+	names := map[string]bool{}
+	for _, definition := range definitions {
+		if strings.TrimSpace(definition) == "" {
+			continue
+		}
+		e, err := Parse(definition)
+		if err != nil {
+			return nil, err
+		}
+		if names[e.Name] {
+			return nil, fmt.Errorf("duplicate expression name: %s", e.Name)
+		}
+		names[e.Name] = true
+		expressions = append(expressions, e)
+	}
+	return expressions, nil
+}
+
+// Range returns the longest range used by the expression selectors, which is how far back it needs data
+// in addition to the evaluation window
+func (e *Expression) Range() time.Duration {
+	var max time.Duration
+	walk(e.root, func(n node) {
+		if m, ok := n.(*matrixSelector); ok && m.rng > max {
+			max = m.rng
+		}
+	})
+	return max
+}
+
+func (e *Expression) String() string {
+	return fmt.Sprintf("%s=%s", e.Name, e.Source)
+}
+
+type node interface{}
+
+type numberLiteral struct {
+	value float64
+}
+
+type vectorSelector struct {
+	name     string
+	matchers []*provider.LabelMatcher
+}
+
+type matrixSelector struct {
+	*vectorSelector
+	rng time.Duration
+}
+
+type binaryExpr struct {
+	op    string
+	left  node
+	right node
+}
+
+type aggregateExpr struct {
+	op       string
+	expr     node
+	grouping []string
+	without  bool
+}
+
+type functionCall struct {
+	name string
+	arg  *matrixSelector
+}
+
+func walk(n node, f func(node)) {
+	f(n)
+	switch n := n.(type) {
+	case *binaryExpr:
+		walk(n.left, f)
+		walk(n.right, f)
+	case *aggregateExpr:
+		walk(n.expr, f)
+	case *functionCall:
+		walk(n.arg, f)
+	}
+}
@@ -0,0 +1,210 @@
+package expression
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name          string
+		definitions   []string
+		expectedNames []string
+		expectedErr   string
+	}{
+		{
+			name:          "single expression",
+			definitions:   []string{"heap_used=jfrt_runtime_heap_maxmemory_bytes - jfrt_runtime_heap_freememory_bytes"},
+			expectedNames: []string{"heap_used"},
+		},
+		{
+			name:          "multiple expressions",
+			definitions:   []string{`requests_rate=sum by (method) (rate(http_requests_total{status=~"2.."}[1m]))`, " avg_free = avg_over_time(free[5m])", ""},
+			expectedNames: []string{"requests_rate", "avg_free"},
+		},
+		{
+			name:          "semicolon in a label value",
+			definitions:   []string{`errors=sum(rate(requests_total{path="/a;b"}[1m]))`},
+			expectedNames: []string{"errors"},
+		},
+		{
+			name:        "missing name",
+			definitions: []string{"rate(foo[1m])"},
+			expectedErr: "expression must be in the form name=expression; got: 'rate(foo[1m])'",
+		},
+		{
+			name:        "invalid name",
+			definitions: []string{"foo-bar=foo"},
+			expectedErr: "invalid expression name: 'foo-bar'",
+		},
+		{
+			name:        "duplicate name",
+			definitions: []string{"foo=bar", "foo=baz"},
+			expectedErr: "duplicate expression name: foo",
+		},
+		{
+			name:        "range selector outside function",
+			definitions: []string{"foo=bar[1m]"},
+			expectedErr: "failed to parse expression foo; cause: range selector bar can only be used as a function argument, e.g. rate(bar[1m0s])",
+		},
+		{
+			name:        "function without range",
+			definitions: []string{"foo=rate(bar)"},
+			expectedErr: "failed to parse expression foo; cause: function rate expects a range selector, e.g. rate(foo[5m])",
+		},
+		{
+			name:        "unbalanced parentheses",
+			definitions: []string{"foo=(bar + 1"},
+			expectedErr: "failed to parse expression foo; cause: expected ')' but got end of expression at position 8",
+		},
+		{
+			name:        "invalid matcher",
+			definitions: []string{`foo=bar{a~"b"}`},
+			expectedErr: "failed to parse expression foo; cause: unexpected character '~' at position 5",
+		},
+		{
+			name:        "invalid regex",
+			definitions: []string{`foo=bar{a=~"("}`},
+			expectedErr: "failed to parse expression foo; cause: invalid regular expression for label a; cause: error parsing regexp: missing closing ): `^(?:()$`",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			expressions, err := ParseList(tc.definitions)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, e := range expressions {
+				names = append(names, e.Name)
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
+
+func TestExpression_Evaluate(t *testing.T) {
+	t0 := time.Date(2020, 11, 25, 22, 36, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return t0.Add(time.Duration(seconds) * time.Second)
+	}
+	data := []models.Metrics{
+		{
+			Key:  "free",
+			Name: "free",
+			Metrics: []models.Metric{
+				{Value: 25, Timestamp: at(0)},
+				{Value: 50, Timestamp: at(10)},
+			},
+		},
+		{
+			Key:  "max",
+			Name: "max",
+			Metrics: []models.Metric{
+				{Value: 100, Timestamp: at(0)},
+				{Value: 100, Timestamp: at(10)},
+			},
+		},
+		{
+			Key:  "requests_total",
+			Name: `requests_total{method="GET",status="200"}`,
+			Metrics: []models.Metric{
+				{Value: 10, Labels: map[string]string{"method": "GET", "status": "200"}, Timestamp: at(0)},
+				{Value: 30, Labels: map[string]string{"method": "GET", "status": "200"}, Timestamp: at(10)},
+			},
+		},
+		{
+			Key:  "requests_total",
+			Name: `requests_total{method="GET",status="500"}`,
+			Metrics: []models.Metric{
+				{Value: 5, Labels: map[string]string{"method": "GET", "status": "500"}, Timestamp: at(0)},
+				{Value: 2, Labels: map[string]string{"method": "GET", "status": "500"}, Timestamp: at(10)},
+			},
+		},
+		{
+			Key:  "requests_total",
+			Name: `requests_total{method="PUT",status="200"}`,
+			Metrics: []models.Metric{
+				{Value: 1, Labels: map[string]string{"method": "PUT", "status": "200"}, Timestamp: at(0)},
+				{Value: 3, Labels: map[string]string{"method": "PUT", "status": "200"}, Timestamp: at(10)},
+			},
+		},
+	}
+	tests := []struct {
+		name       string
+		definition string
+		expected   map[string][]float64
+	}{
+		{
+			name:       "arithmetic between series",
+			definition: "used_ratio=1 - free / max",
+			expected:   map[string][]float64{"used_ratio": {0.75, 0.5}},
+		},
+		{
+			name:       "scalar arithmetic and precedence",
+			definition: "scalar=-(1 + 2) * 3 / 0.5",
+			expected:   map[string][]float64{"scalar": {-18, -18}},
+		},
+		{
+			name:       "label matchers",
+			definition: `errors=requests_total{status!~"2.*",method="GET"}`,
+			expected:   map[string][]float64{`errors{method="GET",status="500"}`: {5, 2}},
+		},
+		{
+			name:       "rate with counter reset",
+			definition: `requests_rate=rate(requests_total{status="500"}[30s])`,
+			expected:   map[string][]float64{`requests_rate{method="GET",status="500"}`: {0.2}},
+		},
+		{
+			name:       "sum by label",
+			definition: "by_method=sum by (method) (requests_total)",
+			expected: map[string][]float64{
+				`by_method{method="GET"}`: {15, 32},
+				`by_method{method="PUT"}`: {1, 3},
+			},
+		},
+		{
+			name:       "count without labels, grouping after the expression",
+			definition: "series=count(requests_total) without (method, status)",
+			expected:   map[string][]float64{"series": {3, 3}},
+		},
+		{
+			name:       "avg over time",
+			definition: "avg_free=avg_over_time(free[1m])",
+			expected:   map[string][]float64{"avg_free": {25, 37.5}},
+		},
+		{
+			name:       "unknown metric",
+			definition: "nothing=foo + 1",
+			expected:   map[string][]float64{},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := Parse(tc.definition)
+			require.NoError(t, err)
+			result := e.Evaluate(data, at(0), at(10), 10*time.Second)
+			actual := map[string][]float64{}
+			for _, metrics := range result {
+				assert.Equal(t, e.Name, metrics.Key)
+				assert.Equal(t, e.Source, metrics.Description)
+				for _, metric := range metrics.Metrics {
+					actual[metrics.Name] = append(actual[metrics.Name], metric.Value)
+				}
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestExpression_Range(t *testing.T) {
+	e, err := Parse("foo=rate(a[1m]) + avg_over_time(b[5m]) * c")
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, e.Range())
+}
@@ -0,0 +1,400 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdentifier
+	tokenNumber
+	tokenString
+	tokenDuration
+	tokenOperator
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+func (t token) String() string {
+	if t.typ == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("'%s'", t.val)
+}
+
+// lex splits the input into tokens. Durations are only recognized inside brackets, e.g. "[5m]".
+func lex(input string) ([]token, error) {
+	var tokens []token
+	inBrackets := false
+	for pos := 0; pos < len(input); {
+		c := rune(input[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case inBrackets && unicode.IsDigit(c):
+			start := pos
+			for pos < len(input) && (unicode.IsDigit(rune(input[pos])) || unicode.IsLetter(rune(input[pos]))) {
+				pos++
+			}
+			tokens = append(tokens, token{typ: tokenDuration, val: input[start:pos], pos: start})
+		case unicode.IsDigit(c) || (c == '.' && pos+1 < len(input) && unicode.IsDigit(rune(input[pos+1]))):
+			start := pos
+			for pos < len(input) && (unicode.IsDigit(rune(input[pos])) || input[pos] == '.') {
+				pos++
+			}
+			if pos < len(input) && (input[pos] == 'e' || input[pos] == 'E') {
+				pos++
+				if pos < len(input) && (input[pos] == '+' || input[pos] == '-') {
+					pos++
+				}
+				for pos < len(input) && unicode.IsDigit(rune(input[pos])) {
+					pos++
+				}
+			}
+			tokens = append(tokens, token{typ: tokenNumber, val: input[start:pos], pos: start})
+		case unicode.IsLetter(c) || c == '_' || c == ':':
+			start := pos
+			for pos < len(input) && (unicode.IsLetter(rune(input[pos])) || unicode.IsDigit(rune(input[pos])) || input[pos] == '_' || input[pos] == ':') {
+				pos++
+			}
+			tokens = append(tokens, token{typ: tokenIdentifier, val: input[start:pos], pos: start})
+		case c == '"' || c == '\'':
+			start := pos
+			pos++
+			value := strings.Builder{}
+			for ; pos < len(input) && rune(input[pos]) != c; pos++ {
+				if input[pos] == '\\' && pos+1 < len(input) {
+					pos++
+				}
+				value.WriteByte(input[pos])
+			}
+			if pos >= len(input) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			pos++
+			tokens = append(tokens, token{typ: tokenString, val: value.String(), pos: start})
+		default:
+			op := string(c)
+			if pos+1 < len(input) {
+				switch two := input[pos : pos+2]; two {
+				case "!=", "=~", "!~":
+					op = two
+				}
+			}
+			if !operators[op] {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, pos)
+			}
+			switch op {
+			case "[":
+				inBrackets = true
+			case "]":
+				inBrackets = false
+			}
+			tokens = append(tokens, token{typ: tokenOperator, val: op, pos: pos})
+			pos += len(op)
+		}
+	}
+	tokens = append(tokens, token{typ: tokenEOF, pos: len(input)})
+	return tokens, nil
+}
+
+var operators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, ",": true,
+	"(": true, ")": true, "{": true, "}": true, "[": true, "]": true,
+	"=": true, "!=": true, "=~": true, "!~": true,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(input string) (node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	if err := checkRangeSelectors(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// checkRangeSelectors verifies that selectors with a range are only used as function arguments
+func checkRangeSelectors(n node) error {
+	switch n := n.(type) {
+	case *matrixSelector:
+		return fmt.Errorf("range selector %s can only be used as a function argument, e.g. rate(%s[%s])", n.name, n.name, n.rng)
+	case *binaryExpr:
+		if err := checkRangeSelectors(n.left); err != nil {
+			return err
+		}
+		return checkRangeSelectors(n.right)
+	case *aggregateExpr:
+		return checkRangeSelectors(n.expr)
+	}
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(values ...string) bool {
+	t := p.peek()
+	if t.typ != tokenOperator {
+		return false
+	}
+	for _, v := range values {
+		if t.val == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.isOperator(op) {
+		t := p.peek()
+		return fmt.Errorf("expected '%s' but got %s at position %d", op, t, t.pos)
+	}
+	p.next()
+	return nil
+}
+
+// parseExpr parses additive expressions, the lowest precedence
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		op := p.next().val
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseTerm parses multiplicative expressions
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/") {
+		op := p.next().val
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("-", "+") {
+		op := p.next().val
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			return operand, nil
+		}
+		return &binaryExpr{op: "*", left: &numberLiteral{value: -1}, right: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+	switch t.typ {
+	case tokenNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", t.val, t.pos)
+		}
+		return &numberLiteral{value: v}, nil
+	case tokenOperator:
+		if t.val == "(" {
+			p.next()
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		}
+	case tokenIdentifier:
+		// Aggregation and function names are not reserved, they can also be metric names
+		following := p.tokens[p.pos+1]
+		if _, ok := provider.SupportedAggregateFuncs[t.val]; ok && (following.val == "(" || following.val == "by" || following.val == "without") {
+			return p.parseAggregation()
+		}
+		if _, ok := functions[t.val]; ok && following.val == "(" {
+			return p.parseFunctionCall()
+		}
+		return p.parseSelector()
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+}
+
+// parseAggregation parses: op [by|without (labels)] (expr) [by|without (labels)]
+func (p *parser) parseAggregation() (node, error) {
+	agg := &aggregateExpr{op: p.next().val}
+	if err := p.parseGrouping(agg); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var err error
+	agg.expr, err = p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if agg.grouping == nil {
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+func (p *parser) parseGrouping(agg *aggregateExpr) error {
+	t := p.peek()
+	if t.typ != tokenIdentifier || (t.val != "by" && t.val != "without") {
+		return nil
+	}
+	p.next()
+	agg.without = t.val == "without"
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	agg.grouping = []string{}
+	for !p.isOperator(")") {
+		label := p.next()
+		if label.typ != tokenIdentifier {
+			return fmt.Errorf("expected label name but got %s at position %d", label, label.pos)
+		}
+		agg.grouping = append(agg.grouping, label.val)
+		if !p.isOperator(",") {
+			break
+		}
+		p.next()
+	}
+	return p.expect(")")
+}
+
+func (p *parser) parseFunctionCall() (node, error) {
+	call := &functionCall{name: p.next().val}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if _, ok := arg.(*matrixSelector); !ok {
+		return nil, fmt.Errorf("function %s expects a range selector, e.g. %s(foo[5m])", call.name, call.name)
+	}
+	call.arg = arg.(*matrixSelector)
+	return call, nil
+}
+
+// parseSelector parses: name[{matchers}][[range]]
+func (p *parser) parseSelector() (node, error) {
+	name := p.next()
+	selector := &vectorSelector{name: name.val}
+	if p.isOperator("{") {
+		p.next()
+		for !p.isOperator("}") {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			selector.matchers = append(selector.matchers, m)
+			if !p.isOperator(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+	}
+	if !p.isOperator("[") {
+		return selector, nil
+	}
+	p.next()
+	t := p.next()
+	if t.typ != tokenDuration {
+		return nil, fmt.Errorf("expected duration but got %s at position %d", t, t.pos)
+	}
+	d, err := time.ParseDuration(t.val)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid duration '%s' at position %d", t.val, t.pos)
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return &matrixSelector{vectorSelector: selector, rng: d}, nil
+}
+
+func (p *parser) parseMatcher() (*provider.LabelMatcher, error) {
+	label := p.next()
+	if label.typ != tokenIdentifier {
+		return nil, fmt.Errorf("expected label name but got %s at position %d", label, label.pos)
+	}
+	op := p.next()
+	if op.typ != tokenOperator || (op.val != "=" && op.val != "!=" && op.val != "=~" && op.val != "!~") {
+		return nil, fmt.Errorf("expected label matching operator but got %s at position %d", op, op.pos)
+	}
+	value := p.next()
+	if value.typ != tokenString {
+		return nil, fmt.Errorf("expected label value string but got %s at position %d", value, value.pos)
+	}
+	return provider.NewLabelMatcher(label.val, op.val, value.val)
+}
@@ -7,13 +7,18 @@ toolchain go1.24.4
 require (
 	github.com/buger/goterm v1.0.4
 	github.com/gdamore/tcell/v2 v2.8.1
+	github.com/golang/snappy v0.0.4
 	github.com/hpcloud/tail v1.0.0
 	github.com/jfrog/jfrog-cli-core/v2 v2.58.7
 	github.com/jfrog/jfrog-client-go v1.53.1
+	github.com/klauspost/compress v1.17.11
+	github.com/parquet-go/parquet-go v0.25.1
 	github.com/prometheus/client_model v0.6.2
 	github.com/prometheus/common v0.64.0
 	github.com/rivo/tview v0.0.0-20250501113434-0c592cd31026
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/term v0.32.0
+	google.golang.org/protobuf v1.36.6
 )
 
 require (
@@ -39,7 +44,6 @@ require (
 	github.com/go-git/go-git/v5 v5.14.0 // indirect
 	github.com/golang-jwt/jwt/v4 v4.5.2 // indirect
 	github.com/golang/groupcache v0.0.0-20241129210726-2c02b8208cf8 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/gookit/color v1.5.4 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
@@ -49,7 +53,6 @@ require (
 	github.com/jfrog/build-info-go v1.10.12 // indirect
 	github.com/jfrog/gofrog v1.7.6 // indirect
 	github.com/kevinburke/ssh_config v1.2.0 // indirect
-	github.com/klauspost/compress v1.17.11 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.9 // indirect
 	github.com/klauspost/pgzip v1.2.6 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
@@ -92,9 +95,7 @@ require (
 	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/sync v0.14.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
-	golang.org/x/term v0.32.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
-	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/fsnotify.v1 v1.4.7 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
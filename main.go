@@ -27,5 +27,8 @@ func getCommands() []components.Command {
 	return []components.Command{
 		commands.GetGraphCommand(),
 		commands.GetPrintCommand(),
+		commands.GetRecordCommand(),
+		commands.GetServeCommand(),
+		commands.GetExportCommand(),
 	}
 }
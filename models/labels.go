@@ -0,0 +1,30 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// LabelsSignature returns a string which identifies the labels, ignoring the given label names.
+// Equal labels have equal signatures whatever the order of the map.
+func LabelsSignature(labels map[string]string, ignored ...string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		ignore := false
+		for _, i := range ignored {
+			ignore = ignore || k == i
+		}
+		if !ignore {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	signature := strings.Builder{}
+	for _, k := range keys {
+		signature.WriteString("\xff")
+		signature.WriteString(k)
+		signature.WriteString("\xff")
+		signature.WriteString(labels[k])
+	}
+	return signature.String()
+}
@@ -1,11 +1,23 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type Metric struct {
 	Value     float64
 	Labels    map[string]string
 	Timestamp time.Time
+	Created   time.Time // zero if the source did not expose a "_created" series for this metric
+	Exemplar  *Exemplar // nil if the sample had no exemplar
+}
+
+// Exemplar is a reference to data outside the metric set (e.g. a trace ID), as defined by OpenMetrics
+type Exemplar struct {
+	Value     float64
+	Labels    map[string]string
+	Timestamp time.Time // zero if the exemplar had no timestamp
 }
 
 type Metrics struct {
@@ -13,4 +25,42 @@ type Metrics struct {
 	Key         string
 	Name        string
 	Description string
+	Type        MetricType
+	Unit        string
+}
+
+// FamilyName returns the name of the metric family of the series, e.g. "foo" for the "foo_bucket" series of a histogram
+func (m Metrics) FamilyName() string {
+	switch m.Type {
+	case MetricTypeHistogram:
+		return trimSuffixes(m.Key, "_bucket", "_sum", "_count")
+	case MetricTypeGaugeHistogram:
+		return trimSuffixes(m.Key, "_bucket", "_gsum", "_gcount")
+	case MetricTypeSummary:
+		return trimSuffixes(m.Key, "_sum", "_count")
+	}
+	return m.Key
+}
+
+func trimSuffixes(s string, suffixes ...string) string {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return strings.TrimSuffix(s, suffix)
+		}
+	}
+	return s
 }
+
+// MetricType is the type of metric family. OpenMetrics "unknown" families are mapped to MetricTypeUntyped.
+type MetricType string
+
+const (
+	MetricTypeUntyped        MetricType = "untyped"
+	MetricTypeGauge          MetricType = "gauge"
+	MetricTypeCounter        MetricType = "counter"
+	MetricTypeStateSet       MetricType = "stateset"
+	MetricTypeInfo           MetricType = "info"
+	MetricTypeHistogram      MetricType = "histogram"
+	MetricTypeGaugeHistogram MetricType = "gaugehistogram"
+	MetricTypeSummary        MetricType = "summary"
+)
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// labelPatterns caches the patterns matching a label in the labels of a sample line, by label name
+var labelPatterns sync.Map
+
+func labelPattern(name string) *regexp.Regexp {
+	if pattern, found := labelPatterns.Load(name); found {
+		return pattern.(*regexp.Regexp)
+	}
+	pattern, _ := labelPatterns.LoadOrStore(name, regexp.MustCompile(`(^|,)\s*`+regexp.QuoteMeta(name)+`\s*=\s*"(?:[^"\\]|\\.)*"\s*`))
+	return pattern.(*regexp.Regexp)
+}
+
+// SetLabel sets the label on all the samples of the metrics text, overriding any existing one.
+// Exemplars and comment lines are kept as is.
+func SetLabel(text string, name string, value string) string {
+	pattern := labelPattern(name)
+	label := fmt.Sprintf("%s=%q", name, value)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		nameEnd := strings.IndexAny(line, "{ \t")
+		switch {
+		case nameEnd < 0:
+			continue
+		case line[nameEnd] != '{':
+			lines[i] = line[:nameEnd] + "{" + label + "}" + line[nameEnd:]
+		default:
+			labelsEnd := labelsEnd(line, nameEnd)
+			if labelsEnd < 0 {
+				continue
+			}
+			labels := pattern.ReplaceAllString(line[nameEnd+1:labelsEnd], "")
+			labels = strings.Trim(strings.TrimSpace(labels), ",")
+			if labels != "" {
+				labels = label + "," + labels
+			} else {
+				labels = label
+			}
+			lines[i] = line[:nameEnd+1] + labels + line[labelsEnd:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// labelsEnd returns the index of the brace closing the labels which are opened at the given index of the sample line,
+// skipping braces in quoted label values, or -1 if the labels are not closed
+func labelsEnd(line string, open int) int {
+	quoted := false
+	for i := open + 1; i < len(line); i++ {
+		switch {
+		case quoted && line[i] == '\\':
+			i++
+		case line[i] == '"':
+			quoted = !quoted
+		case !quoted && line[i] == '}':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "no labels",
+			text:     "# TYPE foo gauge\nfoo 1\n# EOF\n",
+			expected: "# TYPE foo gauge\nfoo{product=\"xray\"} 1\n# EOF\n",
+		},
+		{
+			name:     "existing label is replaced",
+			text:     `foo{product="other",a="b",my_product="x"} 1`,
+			expected: `foo{product="xray",a="b",my_product="x"} 1`,
+		},
+		{
+			name:     "braces in label values",
+			text:     `foo{path="/a/{id}",product="{x}",b="\"}"} 1`,
+			expected: `foo{product="xray",path="/a/{id}",b="\"}"} 1`,
+		},
+		{
+			name:     "other labels are kept",
+			text:     `foo{instance="node1"} 1 # {trace_id="abc"} 0.5`,
+			expected: `foo{product="xray",instance="node1"} 1 # {trace_id="abc"} 0.5`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, SetLabel(tc.text, "product", "xray"))
+		})
+	}
+}
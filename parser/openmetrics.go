@@ -0,0 +1,419 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+)
+
+// ParseOpenMetrics parses data in the OpenMetrics 1.0 text format.
+// Parsing stops at the "# EOF" line; a missing "# EOF" is tolerated since metrics logs are read in chunks.
+// Unknown comment lines (such as Artifactory's "# UPDATED") are ignored.
+// Samples without a timestamp are stamped with the time of parsing.
+func ParseOpenMetrics(r io.Reader) ([]models.Metrics, error) {
+	return ParseOpenMetricsAt(r, time.Now())
+}
+
+// ParseOpenMetricsAt parses data in the OpenMetrics 1.0 text format, and stamps the samples without a timestamp with
+// the given time. A zero time leaves them without a timestamp.
+func ParseOpenMetricsAt(r io.Reader, defaultTimestamp time.Time) ([]models.Metrics, error) {
+	p := openMetricsParser{
+		families:         make(map[string]*openMetricsFamily),
+		series:           make(map[string]*models.Metrics),
+		created:          make(map[string]time.Time),
+		defaultTimestamp: defaultTimestamp,
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if line == "# EOF" {
+			break
+		}
+		var err error
+		if strings.HasPrefix(line, "#") {
+			err = p.parseDescriptor(line)
+		} else if strings.TrimSpace(line) != "" {
+			err = p.parseSample(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse open metrics line %d; cause: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metrics; cause: %w", err)
+	}
+	return p.result(), nil
+}
+
+type openMetricsFamily struct {
+	name       string
+	metricType models.MetricType
+	help       string
+	unit       string
+}
+
+type openMetricsParser struct {
+	families         map[string]*openMetricsFamily
+	series           map[string]*models.Metrics
+	created          map[string]time.Time // family name + labels signature -> created timestamp
+	defaultTimestamp time.Time            // of the samples without a timestamp
+}
+
+func (p *openMetricsParser) family(name string) *openMetricsFamily {
+	f, found := p.families[name]
+	if !found {
+		f = &openMetricsFamily{
+			name:       name,
+			metricType: models.MetricTypeUntyped,
+		}
+		p.families[name] = f
+	}
+	return f
+}
+
+func (p *openMetricsParser) parseDescriptor(line string) error {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 || fields[0] != "#" {
+		return nil
+	}
+	name := fields[2]
+	value := ""
+	if len(fields) == 4 {
+		value = fields[3]
+	}
+	switch fields[1] {
+	case "HELP":
+		f := p.family(name)
+		if f.help == "" {
+			f.help = unescapeHelp(value)
+		}
+	case "UNIT":
+		p.family(name).unit = value
+	case "TYPE":
+		metricType, ok := openMetricsTypes[value]
+		if !ok {
+			return fmt.Errorf("unsupported type '%s' for metric %s", value, name)
+		}
+		p.family(name).metricType = metricType
+	}
+	return nil
+}
+
+var openMetricsTypes = map[string]models.MetricType{
+	"unknown":        models.MetricTypeUntyped,
+	"untyped":        models.MetricTypeUntyped,
+	"gauge":          models.MetricTypeGauge,
+	"counter":        models.MetricTypeCounter,
+	"stateset":       models.MetricTypeStateSet,
+	"info":           models.MetricTypeInfo,
+	"histogram":      models.MetricTypeHistogram,
+	"gaugehistogram": models.MetricTypeGaugeHistogram,
+	"summary":        models.MetricTypeSummary,
+}
+
+// Sample name suffixes allowed per metric type, in the order they are resolved
+var openMetricsSuffixes = []struct {
+	metricType models.MetricType
+	suffixes   []string
+}{
+	{models.MetricTypeCounter, []string{"_total", "_created"}},
+	{models.MetricTypeInfo, []string{"_info"}},
+	{models.MetricTypeHistogram, []string{"_bucket", "_count", "_sum", "_created"}},
+	{models.MetricTypeGaugeHistogram, []string{"_bucket", "_gcount", "_gsum"}},
+	{models.MetricTypeSummary, []string{"_count", "_sum", "_created"}},
+}
+
+// resolveFamily finds the family a sample belongs to, by the sample name and its type specific suffix
+func (p *openMetricsParser) resolveFamily(sampleName string) *openMetricsFamily {
+	for _, typeSuffixes := range openMetricsSuffixes {
+		for _, suffix := range typeSuffixes.suffixes {
+			if !strings.HasSuffix(sampleName, suffix) {
+				continue
+			}
+			f, found := p.families[strings.TrimSuffix(sampleName, suffix)]
+			if found && f.metricType == typeSuffixes.metricType {
+				return f
+			}
+		}
+	}
+	return p.family(sampleName)
+}
+
+func (p *openMetricsParser) parseSample(line string) error {
+	c := &cursor{s: line}
+	name := c.readName()
+	if name == "" {
+		return fmt.Errorf("missing metric name")
+	}
+	labels := map[string]string{}
+	if c.peek() == '{' {
+		var err error
+		labels, err = c.readLabels()
+		if err != nil {
+			return err
+		}
+	}
+	if !c.skipSpaces() {
+		return fmt.Errorf("missing value for metric %s", name)
+	}
+	value, err := parseOpenMetricsFloat(c.readToken())
+	if err != nil {
+		return fmt.Errorf("invalid value for metric %s; cause: %w", name, err)
+	}
+	timestamp := time.Time{}
+	c.skipSpaces()
+	if !c.done() && c.peek() != '#' {
+		timestamp, err = parseOpenMetricsTimestamp(c.readToken())
+		if err != nil {
+			return fmt.Errorf("invalid timestamp for metric %s; cause: %w", name, err)
+		}
+		c.skipSpaces()
+	}
+	var exemplar *models.Exemplar
+	if !c.done() {
+		exemplar, err = c.readExemplar()
+		if err != nil {
+			return fmt.Errorf("invalid exemplar for metric %s; cause: %w", name, err)
+		}
+	}
+	if timestamp.IsZero() {
+		timestamp = p.defaultTimestamp
+	}
+
+	f := p.resolveFamily(name)
+	if strings.HasSuffix(name, "_created") && name != f.name {
+		p.created[f.name+models.LabelsSignature(labels)] = floatToTime(value)
+		return nil
+	}
+	metrics, found := p.series[name]
+	if !found {
+		metrics = &models.Metrics{
+			Key:  name,
+			Name: name,
+		}
+		p.series[name] = metrics
+	}
+	metrics.Metrics = append(metrics.Metrics, models.Metric{
+		Value:     value,
+		Labels:    labels,
+		Timestamp: timestamp,
+		Exemplar:  exemplar,
+	})
+	return nil
+}
+
+func (p *openMetricsParser) result() []models.Metrics {
+	metricsCollection := make([]models.Metrics, 0, len(p.series))
+	for name, series := range p.series {
+		metrics := *series
+		f := p.resolveFamily(name)
+		metrics.Description = f.help
+		metrics.Type = f.metricType
+		metrics.Unit = f.unit
+		for i, metric := range metrics.Metrics {
+			if created, found := p.created[f.name+models.LabelsSignature(metric.Labels, "le", "quantile")]; found {
+				metrics.Metrics[i].Created = created
+			}
+		}
+		// Sort the metric entries by timestamp
+		sort.SliceStable(metrics.Metrics, func(i, j int) bool {
+			return metrics.Metrics[i].Timestamp.Before(metrics.Metrics[j].Timestamp)
+		})
+		metricsCollection = append(metricsCollection, metrics)
+	}
+	return metricsCollection
+}
+
+func parseOpenMetricsFloat(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(+1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Timestamps from this magnitude on (the year 5138 in seconds) are taken as milliseconds
+const millisecondsTimestampThreshold = 1e11
+
+// parseOpenMetricsTimestamp parses a timestamp, which in OpenMetrics is in (possibly fractional) seconds.
+// Logs such as Artifactory's mix OpenMetrics descriptors with Prometheus millisecond timestamps, so the unit is
+// decided per timestamp by its magnitude.
+func parseOpenMetricsTimestamp(s string) (time.Time, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if math.Abs(v) >= millisecondsTimestampThreshold {
+		v /= 1000
+	}
+	return floatToTime(v), nil
+}
+
+func floatToTime(seconds float64) time.Time {
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e6))*int64(time.Microsecond))
+}
+
+func unescapeHelp(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`).Replace(s)
+}
+
+// cursor is a minimal scanner over a single sample line
+type cursor struct {
+	s   string
+	pos int
+}
+
+func (c *cursor) done() bool {
+	return c.pos >= len(c.s)
+}
+
+func (c *cursor) peek() byte {
+	if c.done() {
+		return 0
+	}
+	return c.s[c.pos]
+}
+
+// skipSpaces skips spaces and reports whether any were skipped
+func (c *cursor) skipSpaces() bool {
+	start := c.pos
+	for !c.done() && c.s[c.pos] == ' ' {
+		c.pos++
+	}
+	return c.pos > start
+}
+
+func (c *cursor) readName() string {
+	start := c.pos
+	for !c.done() {
+		b := c.s[c.pos]
+		if b == '_' || b == ':' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (c.pos > start && b >= '0' && b <= '9') {
+			c.pos++
+			continue
+		}
+		break
+	}
+	return c.s[start:c.pos]
+}
+
+func (c *cursor) readToken() string {
+	start := c.pos
+	for !c.done() && c.s[c.pos] != ' ' {
+		c.pos++
+	}
+	return c.s[start:c.pos]
+}
+
+func (c *cursor) readLabels() (map[string]string, error) {
+	labels := map[string]string{}
+	c.pos++ // '{'
+	for {
+		if c.peek() == '}' {
+			c.pos++
+			return labels, nil
+		}
+		name := c.readName()
+		if name == "" {
+			return nil, fmt.Errorf("invalid label name at position %d", c.pos)
+		}
+		if c.peek() != '=' {
+			return nil, fmt.Errorf("expected '=' after label %s", name)
+		}
+		c.pos++
+		value, err := c.readQuoted()
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for label %s; cause: %w", name, err)
+		}
+		labels[name] = value
+		switch c.peek() {
+		case ',':
+			c.pos++
+		case '}':
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' after label %s", name)
+		}
+	}
+}
+
+func (c *cursor) readQuoted() (string, error) {
+	if c.peek() != '"' {
+		return "", fmt.Errorf("expected '\"'")
+	}
+	c.pos++
+	value := bytes.Buffer{}
+	for !c.done() {
+		b := c.s[c.pos]
+		c.pos++
+		switch b {
+		case '"':
+			return value.String(), nil
+		case '\\':
+			if c.done() {
+				return "", fmt.Errorf("unterminated escape sequence")
+			}
+			switch esc := c.s[c.pos]; esc {
+			case 'n':
+				value.WriteByte('\n')
+			case '\\', '"':
+				value.WriteByte(esc)
+			default:
+				return "", fmt.Errorf("invalid escape sequence '\\%c'", esc)
+			}
+			c.pos++
+		default:
+			value.WriteByte(b)
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted string")
+}
+
+// readExemplar reads an exemplar in the form: # {labels} value [timestamp]
+func (c *cursor) readExemplar() (*models.Exemplar, error) {
+	if c.peek() != '#' {
+		return nil, fmt.Errorf("unexpected text: %s", c.s[c.pos:])
+	}
+	c.pos++
+	c.skipSpaces()
+	if c.peek() != '{' {
+		return nil, fmt.Errorf("missing exemplar labels")
+	}
+	labels, err := c.readLabels()
+	if err != nil {
+		return nil, err
+	}
+	c.skipSpaces()
+	exemplar := &models.Exemplar{
+		Labels: labels,
+	}
+	exemplar.Value, err = parseOpenMetricsFloat(c.readToken())
+	if err != nil {
+		return nil, err
+	}
+	c.skipSpaces()
+	if !c.done() {
+		exemplar.Timestamp, err = parseOpenMetricsTimestamp(c.readToken())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return exemplar, nil
+}
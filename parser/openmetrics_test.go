@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOpenMetrics(t *testing.T) {
+	metricsFile, err := os.Open("testdata/metrics-openmetrics.txt")
+	require.NoError(t, err, "could not open input file")
+	defer metricsFile.Close()
+	metrics, err := ParseMetrics(metricsFile)
+	require.NoError(t, err, "unexpected error while parsing metrics")
+
+	byName := make(map[string]models.Metrics)
+	var names []string
+	for _, m := range metrics {
+		byName[m.Name] = m
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{
+		"jfrt_build_info",
+		"jfrt_http_connections_available",
+		"jfrt_http_requests_total",
+		"jfrt_node_state",
+		"jfrt_queue_wait_seconds_bucket",
+		"jfrt_queue_wait_seconds_gcount",
+		"jfrt_queue_wait_seconds_gsum",
+	}, names, "metric names")
+
+	gauge := byName["jfrt_http_connections_available"]
+	assert.Equal(t, models.MetricTypeGauge, gauge.Type, "gauge type")
+	assert.Equal(t, "connections", gauge.Unit, "gauge unit")
+	assert.Equal(t, "Available HTTP connections", gauge.Description, "gauge description")
+	require.Len(t, gauge.Metrics, 1)
+	assert.Equal(t, time.Date(2020, 11, 25, 22, 36, 42, 324000000, time.UTC), gauge.Metrics[0].Timestamp.UTC(), "gauge timestamp")
+	assert.Equal(t, map[string]string{"pool": "default"}, gauge.Metrics[0].Labels, "gauge labels")
+
+	counter := byName["jfrt_http_requests_total"]
+	assert.Equal(t, models.MetricTypeCounter, counter.Type, "counter type")
+	require.Len(t, counter.Metrics, 1)
+	assert.Equal(t, 1027.0, counter.Metrics[0].Value, "counter value")
+	assert.Equal(t, time.Date(2020, 11, 25, 22, 23, 20, 500000000, time.UTC), counter.Metrics[0].Created.UTC(), "counter created")
+	if assert.NotNil(t, counter.Metrics[0].Exemplar, "counter exemplar") {
+		assert.Equal(t, map[string]string{"trace_id": "KOO5S4vxi0o"}, counter.Metrics[0].Exemplar.Labels, "exemplar labels")
+		assert.Equal(t, 1.0, counter.Metrics[0].Exemplar.Value, "exemplar value")
+		assert.Equal(t, time.Date(2020, 11, 25, 22, 36, 42, 100000000, time.UTC), counter.Metrics[0].Exemplar.Timestamp.UTC(), "exemplar timestamp")
+	}
+
+	assert.Equal(t, models.MetricTypeInfo, byName["jfrt_build_info"].Type, "info type")
+	assert.Equal(t, models.MetricTypeStateSet, byName["jfrt_node_state"].Type, "stateset type")
+	assert.Len(t, byName["jfrt_node_state"].Metrics, 2, "stateset states")
+
+	histogram := byName["jfrt_queue_wait_seconds_bucket"]
+	assert.Equal(t, models.MetricTypeGaugeHistogram, histogram.Type, "gaugehistogram type")
+	assert.Equal(t, "seconds", histogram.Unit, "gaugehistogram unit")
+	assert.Equal(t, "Time spent waiting in queue", byName["jfrt_queue_wait_seconds_gsum"].Description, "gaugehistogram description")
+}
+
+func TestParseOpenMetrics_millisecondTimestamps(t *testing.T) {
+	// An Artifactory metrics log with units and exemplars, but Prometheus millisecond timestamps
+	input := "# TYPE jfrt_queue_wait_seconds summary\n# UNIT jfrt_queue_wait_seconds seconds\n" +
+		"jfrt_queue_wait_seconds_count 3 1606343802324 # {trace_id=\"a\"} 0.5 1606343802100\n" +
+		"jfrt_queue_wait_seconds_sum 1.5 1606343802.324\n"
+	metrics, err := ParseMetrics(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	want := time.Date(2020, 11, 25, 22, 36, 42, 324000000, time.UTC)
+	for _, m := range metrics {
+		assert.Equal(t, models.MetricTypeSummary, m.Type, "%s type", m.Name)
+		require.Len(t, m.Metrics, 1)
+		assert.Equal(t, want, m.Metrics[0].Timestamp.UTC(), "%s timestamp", m.Name)
+	}
+	if assert.NotNil(t, metrics[0].Metrics[0].Exemplar, "exemplar") {
+		assert.Equal(t, time.Date(2020, 11, 25, 22, 36, 42, 100000000, time.UTC), metrics[0].Metrics[0].Exemplar.Timestamp.UTC(), "exemplar timestamp")
+	}
+}
+
+func TestParseOpenMetrics_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "bad value",
+			input:   "foo bar\n",
+			wantErr: "failed to parse open metrics line 1; cause: invalid value for metric foo; cause: strconv.ParseFloat: parsing \"bar\": invalid syntax",
+		},
+		{
+			name:    "unterminated label value",
+			input:   "# TYPE foo gauge\nfoo{a=\"b} 1\n",
+			wantErr: "failed to parse open metrics line 2; cause: invalid value for label a; cause: unterminated quoted string",
+		},
+		{
+			name:    "unknown type",
+			input:   "# TYPE foo bar\n",
+			wantErr: "failed to parse open metrics line 1; cause: unsupported type 'bar' for metric foo",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseOpenMetrics(strings.NewReader(tc.input))
+			require.NotNil(t, err, "error")
+			assert.Equal(t, tc.wantErr, err.Error(), "error")
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Format
+	}{
+		{
+			name:     "prometheus text",
+			input:    "# HELP foo Foo\n# TYPE foo gauge\nfoo 1 1606343802324\n",
+			expected: FormatText,
+		},
+		{
+			name:     "eof",
+			input:    "foo 1\n# EOF\n",
+			expected: FormatOpenMetrics,
+		},
+		{
+			name:     "unit",
+			input:    "# UNIT foo_seconds seconds\nfoo_seconds 1\n",
+			expected: FormatOpenMetrics,
+		},
+		{
+			name:     "info type",
+			input:    "# TYPE foo info\nfoo_info{a=\"b\"} 1\n",
+			expected: FormatOpenMetrics,
+		},
+		{
+			name:     "exemplar",
+			input:    "foo_total 1 # {trace_id=\"a\"} 1\n",
+			expected: FormatOpenMetrics,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, DetectFormat([]byte(tc.input)))
+		})
+	}
+}
+
+func TestFormatFromContentType(t *testing.T) {
+	assert.Equal(t, FormatOpenMetrics, FormatFromContentType("application/openmetrics-text; version=1.0.0; charset=utf-8"))
+	assert.Equal(t, FormatText, FormatFromContentType("text/plain; version=0.0.4; charset=utf-8"))
+	assert.Equal(t, FormatUnknown, FormatFromContentType(""))
+	assert.Equal(t, FormatUnknown, FormatFromContentType("application/json"))
+}
@@ -10,17 +10,111 @@ import (
 	"github.com/prometheus/common/expfmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Format is the text format of the parsed metrics
+type Format string
+
+const (
+	FormatUnknown     Format = ""
+	FormatText        Format = "text"        // Prometheus text exposition format 0.0.4
+	FormatOpenMetrics Format = "openmetrics" // OpenMetrics 1.0 text format
+)
+
+// FormatFromContentType returns the format matching an HTTP Content-Type header value,
+// or FormatUnknown if the content type is empty or not recognized.
+func FormatFromContentType(contentType string) Format {
+	if contentType == "" {
+		return FormatUnknown
+	}
+	switch expfmt.Format(contentType).FormatType() {
+	case expfmt.TypeOpenMetrics:
+		return FormatOpenMetrics
+	case expfmt.TypeTextPlain:
+		return FormatText
+	}
+	return FormatUnknown
+}
+
+// DetectFormat guesses the format from the metrics data itself.
+// Data is considered OpenMetrics if it has an "# EOF" or "# UNIT" line, an OpenMetrics only type, or exemplars.
+func DetectFormat(data []byte) Format {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "#") {
+			if strings.Contains(line, " # {") {
+				return FormatOpenMetrics
+			}
+			continue
+		}
+		if line == "# EOF" || strings.HasPrefix(line, "# UNIT ") {
+			return FormatOpenMetrics
+		}
+		if fields := strings.Fields(line); len(fields) == 4 && fields[1] == "TYPE" {
+			switch fields[3] {
+			case "unknown", "info", "stateset", "gaugehistogram":
+				return FormatOpenMetrics
+			}
+		}
+	}
+	return FormatText
+}
+
+// ParseMetrics parses metrics data, detecting the format from the data itself
 func ParseMetrics(r io.Reader) ([]models.Metrics, error) {
-	txtParser := expfmt.TextParser{}
+	return ParseMetricsWithFormat(r, FormatUnknown)
+}
+
+// ParseMetricsWithContentType parses metrics data, using the format matching the given Content-Type if known
+func ParseMetricsWithContentType(r io.Reader, contentType string) ([]models.Metrics, error) {
+	return ParseMetricsWithFormat(r, FormatFromContentType(contentType))
+}
+
+// ParseMetricsWithFormat parses metrics data in the given format, or detects the format if it is FormatUnknown.
+// Samples without a timestamp are stamped with the time of parsing.
+func ParseMetricsWithFormat(r io.Reader, format Format) ([]models.Metrics, error) {
+	return ParseMetricsWithFormatAt(r, format, time.Now())
+}
+
+// ParseMetricsAt parses metrics data, detecting the format from the data itself, and stamps the samples without a
+// timestamp with the given time, e.g. the time the data was scraped at. A zero time leaves them without a timestamp.
+func ParseMetricsAt(r io.Reader, defaultTimestamp time.Time) ([]models.Metrics, error) {
+	return ParseMetricsWithFormatAt(r, FormatUnknown, defaultTimestamp)
+}
+
+// ParseMetricsWithFormatAt parses metrics data in the given format, or detects the format if it is FormatUnknown,
+// and stamps the samples without a timestamp with the given time. A zero time leaves them without a timestamp.
+func ParseMetricsWithFormatAt(r io.Reader, format Format, defaultTimestamp time.Time) ([]models.Metrics, error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read metrics; cause: %w", err)
 	}
+	if format == FormatUnknown {
+		format = DetectFormat(data)
+	}
+	if format == FormatOpenMetrics {
+		metricsCollection, err := ParseOpenMetricsAt(bytes.NewReader(data), defaultTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		// Sort by name to make the order predictable
+		sort.SliceStable(metricsCollection, func(i, j int) bool {
+			return metricsCollection[i].Name < metricsCollection[j].Name
+		})
+		return metricsCollection, nil
+	}
+	return parseTextMetrics(data, defaultTimestamp)
+}
+
+func parseTextMetrics(data []byte, defaultTimestamp time.Time) ([]models.Metrics, error) {
+	txtParser := expfmt.TextParser{}
 	br := bytes.NewReader(data)
 	prometheusMetrics, err := txtParser.TextToMetricFamilies(br)
 	// Handle parsing errors due to bad comments, such as "second HELP line for metric"
@@ -54,40 +148,13 @@ func ParseMetrics(r io.Reader) ([]models.Metrics, error) {
 		case io_prometheus_client.MetricType_GAUGE:
 		case io_prometheus_client.MetricType_COUNTER:
 		case io_prometheus_client.MetricType_UNTYPED:
+		case io_prometheus_client.MetricType_HISTOGRAM:
+		case io_prometheus_client.MetricType_SUMMARY:
 		default:
 			//log.Warn(fmt.Sprintf("metric '%s' has unsupported type: %s", key, metricFamily.Type.String()))
 			continue
 		}
-		metrics := models.Metrics{
-			Key:  key,
-			Name: key,
-		}
-		if metricFamily.Help != nil {
-			metrics.Description = *metricFamily.Help
-		}
-		for _, promMetric := range metricFamily.Metric {
-			metric := models.Metric{}
-			if promMetric.TimestampMs != nil {
-				metric.Timestamp = time.Unix(0, promMetric.GetTimestampMs()*int64(1000000))
-			} else {
-				metric.Timestamp = time.Now()
-			}
-			metric.Labels = convertLabels(promMetric.Label)
-			switch *metricFamily.Type {
-			case io_prometheus_client.MetricType_COUNTER:
-				metric.Value = promMetric.Counter.GetValue()
-			case io_prometheus_client.MetricType_GAUGE:
-				metric.Value = promMetric.Gauge.GetValue()
-			case io_prometheus_client.MetricType_UNTYPED:
-				metric.Value = promMetric.Untyped.GetValue()
-			}
-			metrics.Metrics = append(metrics.Metrics, metric)
-		}
-		// Sort the metric entries by timestamp
-		sort.SliceStable(metrics.Metrics, func(i, j int) bool {
-			return metrics.Metrics[i].Timestamp.Before(metrics.Metrics[j].Timestamp)
-		})
-		metricsCollection = append(metricsCollection, metrics)
+		metricsCollection = append(metricsCollection, convertMetricFamily(key, metricFamily, defaultTimestamp)...)
 	}
 	// Sort by name to make the order predictable
 	sort.SliceStable(metricsCollection, func(i, j int) bool {
@@ -96,6 +163,28 @@ func ParseMetrics(r io.Reader) ([]models.Metrics, error) {
 	return metricsCollection, nil
 }
 
+var metricTypes = map[io_prometheus_client.MetricType]models.MetricType{
+	io_prometheus_client.MetricType_COUNTER:   models.MetricTypeCounter,
+	io_prometheus_client.MetricType_GAUGE:     models.MetricTypeGauge,
+	io_prometheus_client.MetricType_UNTYPED:   models.MetricTypeUntyped,
+	io_prometheus_client.MetricType_HISTOGRAM: models.MetricTypeHistogram,
+	io_prometheus_client.MetricType_SUMMARY:   models.MetricTypeSummary,
+}
+
+// Base units by metric name suffix, following the Prometheus naming conventions
+var unitSuffixes = []string{"seconds", "bytes", "ratio", "percent", "celsius", "volts", "amperes", "joules", "grams", "meters"}
+
+// unitFromName derives the unit of a metric from its name, since the Prometheus text format has no unit metadata
+func unitFromName(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+	for _, unit := range unitSuffixes {
+		if strings.HasSuffix(name, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
 func convertLabels(labels []*io_prometheus_client.LabelPair) map[string]string {
 	result := make(map[string]string, 0)
 	for _, label := range labels {
@@ -103,3 +192,99 @@ func convertLabels(labels []*io_prometheus_client.LabelPair) map[string]string {
 	}
 	return result
 }
+
+// formatFloat formats bucket bounds and quantiles the same way Prometheus does in the exposition format
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// convertMetricFamily converts a single metric family into one or more metrics collections.
+// Histograms are expanded into their "_bucket" (with an "le" label), "_sum" and "_count" series,
+// and summaries into their quantile series (with a "quantile" label), "_sum" and "_count" series.
+func convertMetricFamily(key string, metricFamily *io_prometheus_client.MetricFamily, defaultTimestamp time.Time) []models.Metrics {
+	series := make(map[string]*models.Metrics)
+	var keys []string
+	add := func(seriesKey string, timestamp time.Time, labels map[string]string, value float64) {
+		metrics, found := series[seriesKey]
+		if !found {
+			metrics = &models.Metrics{
+				Key:         seriesKey,
+				Name:        seriesKey,
+				Description: metricFamily.GetHelp(),
+				Type:        metricTypes[metricFamily.GetType()],
+				Unit:        unitFromName(key),
+			}
+			series[seriesKey] = metrics
+			keys = append(keys, seriesKey)
+		}
+		metrics.Metrics = append(metrics.Metrics, models.Metric{
+			Value:     value,
+			Labels:    labels,
+			Timestamp: timestamp,
+		})
+	}
+	for _, promMetric := range metricFamily.Metric {
+		timestamp := defaultTimestamp
+		if promMetric.TimestampMs != nil {
+			timestamp = time.Unix(0, promMetric.GetTimestampMs()*int64(1000000))
+		}
+		switch metricFamily.GetType() {
+		case io_prometheus_client.MetricType_COUNTER:
+			add(key, timestamp, convertLabels(promMetric.Label), promMetric.Counter.GetValue())
+		case io_prometheus_client.MetricType_GAUGE:
+			add(key, timestamp, convertLabels(promMetric.Label), promMetric.Gauge.GetValue())
+		case io_prometheus_client.MetricType_UNTYPED:
+			add(key, timestamp, convertLabels(promMetric.Label), promMetric.Untyped.GetValue())
+		case io_prometheus_client.MetricType_HISTOGRAM:
+			histogram := promMetric.GetHistogram()
+			hasInfBucket := false
+			for _, bucket := range histogram.GetBucket() {
+				labels := convertLabels(promMetric.Label)
+				labels["le"] = formatFloat(bucket.GetUpperBound())
+				hasInfBucket = hasInfBucket || math.IsInf(bucket.GetUpperBound(), +1)
+				add(key+"_bucket", timestamp, labels, float64(bucket.GetCumulativeCount()))
+			}
+			if !hasInfBucket && histogram.SampleCount != nil {
+				// The "+Inf" bucket may be implicit in the parsed histogram, it always equals the count
+				labels := convertLabels(promMetric.Label)
+				labels["le"] = formatFloat(math.Inf(+1))
+				add(key+"_bucket", timestamp, labels, float64(histogram.GetSampleCount()))
+			}
+			if histogram.SampleSum != nil {
+				add(key+"_sum", timestamp, convertLabels(promMetric.Label), histogram.GetSampleSum())
+			}
+			if histogram.SampleCount != nil {
+				add(key+"_count", timestamp, convertLabels(promMetric.Label), float64(histogram.GetSampleCount()))
+			}
+		case io_prometheus_client.MetricType_SUMMARY:
+			summary := promMetric.GetSummary()
+			for _, quantile := range summary.GetQuantile() {
+				labels := convertLabels(promMetric.Label)
+				labels["quantile"] = formatFloat(quantile.GetQuantile())
+				add(key, timestamp, labels, quantile.GetValue())
+			}
+			if summary.SampleSum != nil {
+				add(key+"_sum", timestamp, convertLabels(promMetric.Label), summary.GetSampleSum())
+			}
+			if summary.SampleCount != nil {
+				add(key+"_count", timestamp, convertLabels(promMetric.Label), float64(summary.GetSampleCount()))
+			}
+		}
+	}
+	result := make([]models.Metrics, 0, len(keys))
+	for _, k := range keys {
+		metrics := *series[k]
+		// Sort the metric entries by timestamp
+		sort.SliceStable(metrics.Metrics, func(i, j int) bool {
+			return metrics.Metrics[i].Timestamp.Before(metrics.Metrics[j].Timestamp)
+		})
+		result = append(result, metrics)
+	}
+	return result
+}
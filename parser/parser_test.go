@@ -9,6 +9,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseMetrics(t *testing.T) {
@@ -27,6 +28,11 @@ func TestParseMetrics(t *testing.T) {
 			inputFile:    "testdata/metrics-gauge-multi.log",
 			expectedFile: "testdata/metrics-gauge-multi-expected.txt",
 		},
+		{
+			name:         "histogram and summary metrics",
+			inputFile:    "testdata/metrics-histogram-summary.log",
+			expectedFile: "testdata/metrics-histogram-summary-expected.txt",
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -43,6 +49,27 @@ func TestParseMetrics(t *testing.T) {
 	}
 }
 
+func TestParseMetrics_typeAndUnit(t *testing.T) {
+	metricsFile, err := os.Open("testdata/metrics-histogram-summary.log")
+	require.NoError(t, err, "could not open input file")
+	defer metricsFile.Close()
+	metrics, err := ParseMetrics(metricsFile)
+	require.NoError(t, err, "unexpected error while parsing metrics")
+	actual := make(map[string]string)
+	for _, m := range metrics {
+		actual[m.Name] = fmt.Sprintf("%s/%s", m.Type, m.Unit)
+	}
+	assert.Equal(t, map[string]string{
+		"jfrt_gc_pause_seconds":                     "summary/seconds",
+		"jfrt_gc_pause_seconds_count":               "summary/seconds",
+		"jfrt_gc_pause_seconds_sum":                 "summary/seconds",
+		"jfrt_http_request_duration_seconds_bucket": "histogram/seconds",
+		"jfrt_http_request_duration_seconds_count":  "histogram/seconds",
+		"jfrt_http_request_duration_seconds_sum":    "histogram/seconds",
+		"jfrt_runtime_heap_freememory_bytes":        "gauge/bytes",
+	}, actual)
+}
+
 func metricsToString(metricsCollection []models.Metrics) string {
 	s := strings.Builder{}
 	for _, metrics := range metricsCollection {
@@ -53,3 +80,63 @@ func metricsToString(metricsCollection []models.Metrics) string {
 	}
 	return s.String()
 }
+
+func TestParseMetrics_histogramAndSummaryLabels(t *testing.T) {
+	metricsFile, err := os.Open("testdata/metrics-histogram-summary.log")
+	require.NoError(t, err, "could not open input file")
+	defer metricsFile.Close()
+	metrics, err := ParseMetrics(metricsFile)
+	require.NoError(t, err, "unexpected error while parsing metrics")
+	labelsByName := make(map[string][]map[string]string)
+	for _, m := range metrics {
+		for _, metric := range m.Metrics {
+			labelsByName[m.Name] = append(labelsByName[m.Name], metric.Labels)
+		}
+	}
+	assert.Equal(t, []map[string]string{
+		{"method": "GET", "le": "0.1"},
+		{"method": "GET", "le": "1"},
+		{"method": "GET", "le": "+Inf"},
+	}, labelsByName["jfrt_http_request_duration_seconds_bucket"], "histogram buckets")
+	assert.Equal(t, []map[string]string{{"method": "GET"}}, labelsByName["jfrt_http_request_duration_seconds_sum"], "histogram sum")
+	assert.Equal(t, []map[string]string{{"method": "GET"}}, labelsByName["jfrt_http_request_duration_seconds_count"], "histogram count")
+	assert.Equal(t, []map[string]string{
+		{"quantile": "0.5"},
+		{"quantile": "0.99"},
+	}, labelsByName["jfrt_gc_pause_seconds"], "summary quantiles")
+}
+
+func TestParseMetricsAt(t *testing.T) {
+	recorded := time.UnixMilli(1606343802324)
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "prometheus format",
+			data: "foo 1\nbar 2 1606343813456\n",
+		},
+		{
+			name: "open metrics format",
+			data: "# TYPE foo gauge\nfoo 1\n# TYPE bar gauge\nbar 2 1606343813.456\n# EOF\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			metricsCollection, err := ParseMetricsAt(strings.NewReader(tc.data), recorded)
+			require.NoError(t, err)
+			timestamps := map[string]time.Time{}
+			for _, metrics := range metricsCollection {
+				timestamps[metrics.Name] = metrics.Metrics[0].Timestamp
+			}
+			assert.True(t, recorded.Equal(timestamps["foo"]), "untimed sample: %s", timestamps["foo"])
+			assert.True(t, time.UnixMilli(1606343813456).Equal(timestamps["bar"]), "timed sample: %s", timestamps["bar"])
+
+			metricsCollection, err = ParseMetricsAt(strings.NewReader(tc.data), time.Time{})
+			require.NoError(t, err)
+			for _, metrics := range metricsCollection {
+				assert.Equal(t, metrics.Name == "foo", metrics.Metrics[0].Timestamp.IsZero(), metrics.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetDefaultTimestamp stamps the samples of the metrics text which have no timestamp with the given time, in the
+// timestamp unit of the format, so they keep it when parsed later, e.g. when replayed. The format is detected from
+// the text if it is FormatUnknown.
+func SetDefaultTimestamp(text string, defaultTimestamp time.Time, format Format) string {
+	if format == FormatUnknown {
+		format = DetectFormat([]byte(text))
+	}
+	timestamp := strconv.FormatInt(defaultTimestamp.UnixMilli(), 10)
+	if format == FormatOpenMetrics {
+		timestamp = strconv.FormatFloat(float64(defaultTimestamp.UnixMilli())/1000, 'f', -1, 64)
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		valueStart := strings.IndexAny(line, "{ \t")
+		if valueStart < 0 {
+			continue
+		}
+		if line[valueStart] == '{' {
+			end := labelsEnd(line, valueStart)
+			if end < 0 {
+				continue
+			}
+			valueStart = end + 1
+		}
+		sample, exemplar := line[valueStart:], ""
+		if j := strings.Index(sample, " # "); j >= 0 {
+			sample, exemplar = sample[:j], sample[j:]
+		}
+		if len(strings.Fields(sample)) == 1 {
+			lines[i] = line[:valueStart] + strings.TrimRight(sample, " \t") + " " + timestamp + exemplar
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDefaultTimestamp(t *testing.T) {
+	ts := time.UnixMilli(1606343802324)
+	tests := []struct {
+		name     string
+		text     string
+		format   Format
+		expected string
+	}{
+		{
+			name:     "prometheus format",
+			text:     "# TYPE foo gauge\nfoo 1\nfoo{a=\"}\"} 2 \nbar 3 1606343813456\n",
+			format:   FormatText,
+			expected: "# TYPE foo gauge\nfoo 1 1606343802324\nfoo{a=\"}\"} 2 1606343802324\nbar 3 1606343813456\n",
+		},
+		{
+			name:     "open metrics format",
+			text:     "foo_bucket{le=\"1\"} 1 # {trace_id=\"abc\"} 0.5\nbar 3 1606343813.456\n# EOF\n",
+			format:   FormatOpenMetrics,
+			expected: "foo_bucket{le=\"1\"} 1 1606343802.324 # {trace_id=\"abc\"} 0.5\nbar 3 1606343813.456\n# EOF\n",
+		},
+		{
+			name:     "detected format",
+			text:     "# UNIT foo bytes\nfoo 1\n",
+			expected: "# UNIT foo bytes\nfoo 1 1606343802.324\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, SetDefaultTimestamp(tc.text, ts, tc.format))
+		})
+	}
+}
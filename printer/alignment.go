@@ -0,0 +1,60 @@
+package printer
+
+import (
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+// exactGroupDelay is how long a group of samples of an exact timestamp is buffered for more samples of it
+const exactGroupDelay = 50 * time.Millisecond
+
+// inAlignmentWindow returns whether the timestamp belongs to the group of samples starting at the first timestamp, i.e.
+// is less than half of the alignment away from it, so a scrape arriving slightly early or late is not grouped with the
+// previous one. Without alignment, only the exact first timestamp belongs to the group.
+func inAlignmentWindow(first time.Time, ts time.Time, align time.Duration) bool {
+	if align <= 0 {
+		return first.Equal(ts)
+	}
+	d := ts.Sub(first)
+	return d > -align/2 && d < align/2
+}
+
+// groupDelay returns how long a group of samples is buffered after its last sample before it is printed, unless a sample
+// outside its window arrives first. Samples of a live scrape arrive well within half of the alignment.
+func groupDelay(align time.Duration) time.Duration {
+	if align <= 0 {
+		return exactGroupDelay
+	}
+	return align / 2
+}
+
+// windowValues holds the latest sample of each series collapsed into the same printed value, e.g. by ignoring labels,
+// within an alignment window. A series sampled again within the window replaces its previous sample, so only the values
+// of different series are aggregated, never the values of a series over time.
+type windowValues struct {
+	samples map[string]models.Metric // by the labels signature of the series
+}
+
+func newWindowValues() *windowValues {
+	return &windowValues{samples: map[string]models.Metric{}}
+}
+
+// Set sets the sample of its series, unless a later sample of the series was already set
+func (w *windowValues) Set(m models.Metric) {
+	signature := models.LabelsSignature(m.Labels)
+	if prev, found := w.samples[signature]; found && m.Timestamp.Before(prev.Timestamp) {
+		return
+	}
+	w.samples[signature] = m
+}
+
+// Value aggregates the values of the series using the aggregate function
+func (w *windowValues) Value(aggregate provider.AggregateFunc) float64 {
+	a := provider.NewAggregation()
+	for _, m := range w.samples {
+		a.Add(m.Value)
+	}
+	return a.Value(aggregate)
+}
@@ -0,0 +1,58 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Named timestamp formats of the csv records. Any other timestamp format is a Go time layout.
+const (
+	DefaultTimestampFormat     = "2006-01-02T15:04:05.000"
+	RFC3339TimestampFormat     = "rfc3339"
+	EpochTimestampFormat       = "epoch"
+	EpochMillisTimestampFormat = "epoch-ms"
+)
+
+const defaultFloatFormat = "%f"
+
+// csvFormat formats the timestamps and values of the csv records
+type csvFormat struct {
+	timestampFormat string
+	location        *time.Location
+	floatFormat     string
+}
+
+func newCSVFormat(conf Config) csvFormat {
+	f := csvFormat{
+		timestampFormat: conf.TimestampFormat(),
+		location:        conf.TimeZone(),
+		floatFormat:     conf.FloatFormat(),
+	}
+	if f.timestampFormat == "" {
+		f.timestampFormat = DefaultTimestampFormat
+	}
+	if f.location == nil {
+		f.location = time.UTC
+	}
+	if f.floatFormat == "" {
+		f.floatFormat = defaultFloatFormat
+	}
+	return f
+}
+
+func (f csvFormat) Timestamp(ts time.Time) string {
+	switch f.timestampFormat {
+	case RFC3339TimestampFormat:
+		return ts.In(f.location).Format(jsonTimestampLayout)
+	case EpochTimestampFormat:
+		return strconv.FormatInt(ts.Unix(), 10)
+	case EpochMillisTimestampFormat:
+		return strconv.FormatInt(ts.UnixMilli(), 10)
+	}
+	return ts.In(f.location).Format(f.timestampFormat)
+}
+
+func (f csvFormat) Value(v float64) string {
+	return fmt.Sprintf(f.floatFormat, v)
+}
@@ -1,33 +1,96 @@
 package printer
 
 import (
+	"bytes"
 	"encoding/csv"
 	"fmt"
+	"github.com/eldada/metrics-viewer/models"
 	"github.com/eldada/metrics-viewer/parser"
 	"github.com/eldada/metrics-viewer/provider"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io"
+	"math"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+const defaultDiscoverScrapes = 3
+
 func newCSVPrinter(conf Config) *csvPrinter {
 	metrics := make(map[string]int)
 	for i, m := range conf.Metrics() {
 		metrics[m] = i
 	}
-	return &csvPrinter{
-		writer:     csv.NewWriter(conf.Writer()),
-		metrics:    metrics,
-		mapMetrics: provider.NewLabelsMetricsMapper(conf.AggregateIgnoreLabels(), ","),
-		noHeader:   conf.NoHeader(),
+	p := &csvPrinter{
+		writer:        newCSVWriter(conf.Writer(), conf.Delimiter()),
+		format:        newCSVFormat(conf),
+		metrics:       metrics,
+		ignoredLabels: conf.AggregateIgnoreLabels(),
+		aggregate:     conf.AggregateFunc(),
+		noHeader:      conf.NoHeader(),
+		typeHeader:    conf.TypeHeader(),
+		columnTypes:   make([]models.MetricType, len(metrics)),
+		columnUnits:   make([]string, len(metrics)),
+		align:         conf.Align(),
+		fillPolicy:    conf.FillPolicy(),
+	}
+	if len(metrics) == 0 {
+		// Without --metrics, the columns are discovered from the metrics which pass the filter
+		p.dynamic = true
+		p.discoverScrapes = conf.DiscoverScrapes()
+		if p.discoverScrapes <= 0 {
+			p.discoverScrapes = defaultDiscoverScrapes
+		}
+		p.schemaFile = conf.SchemaFile()
+		p.shouldKeepMetrics = provider.NewRegexMetricsFilter(conf.Filter())
+		if conf.Selector() != nil {
+			p.shouldKeepMetrics = provider.NewSelectorMetricsFilter(conf.Selector())
+		}
 	}
+	return p
 }
 
+func newCSVWriter(w io.Writer, delimiter rune) *csv.Writer {
+	writer := csv.NewWriter(w)
+	if delimiter != 0 {
+		writer.Comma = delimiter
+	}
+	return writer
+}
+
+// csvPrinter prints a record per timestamp, with a column per metric.
+// Samples within the alignment window of the first sample of a record are grouped into the same record,
+// which is printed once a sample outside the window arrives, once its window closed without more samples,
+// or when the printer is closed. The latest samples of the series collapsed into a column (see windowValues)
+// are aggregated when the record is printed. Missing values are filled according to the fill policy.
+//
+// The columns are either the given metrics, or discovered dynamically. Discovered columns are sorted by name once
+// the first scrapes were buffered, so the header is stable. Columns of series which appear later are appended,
+// and the header is printed again, or written to the schema file if set.
 type csvPrinter struct {
-	writer     *csv.Writer
-	metrics    map[string]int
-	mapMetrics provider.MetricsMapperFunc
-	noHeader   bool
+	writer        *csv.Writer
+	format        csvFormat
+	metrics       map[string]int
+	ignoredLabels provider.StringSet
+	aggregate     provider.AggregateFunc
+	noHeader      bool
+	typeHeader    bool
+	columnTypes   []models.MetricType
+	columnUnits   []string
+
+	dynamic           bool
+	discoverScrapes   int
+	schemaFile        string
+	shouldKeepMetrics provider.MetricsFilterFunc
+	pendingRecords    []*csvRecord // records buffered until the columns were discovered
+	headerColumns     int          // the number of columns in the last printed header, 0 if not printed yet
+
+	align      time.Duration
+	fillPolicy FillPolicy
+	lastValues []*float64 // the last printed value of each column, for filling missing values
 
 	printHeaderOnce sync.Once
 	record          *csvRecord
@@ -38,90 +101,272 @@ type csvPrinter struct {
 func (p *csvPrinter) Print(entry string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.printHeaderOnce.Do(p.printHeader)
 	metricsCollection, err := parser.ParseMetrics(strings.NewReader(entry))
 	if err != nil {
 		return err
 	}
-	metricsCollection = p.mapMetrics(metricsCollection)
-	for _, metrics := range metricsCollection {
-		i, found := p.metrics[metrics.Name]
-		if !found {
-			continue
-		}
-		for _, m := range metrics.Metrics {
-			if p.recordTimer != nil {
-				p.recordTimer.Stop()
-				p.recordTimer = nil
+	if p.recordTimer != nil {
+		p.recordTimer.Stop()
+		p.recordTimer = nil
+	}
+	for _, family := range metricsCollection {
+		for _, m := range family.Metrics {
+			metrics := family
+			metrics.Name = provider.SeriesName(p.ignoredLabels, ",", family.Key, m.Labels)
+			metrics.Metrics = []models.Metric{m}
+			if !p.hasColumn(metrics) {
+				continue
+			}
+			// The previous record is printed before looking up the column, as printing may sort the discovered
+			// columns, and a column added now must not be part of the previous record
+			if p.record != nil && !p.record.Includes(m.Timestamp, p.align) {
+				p.printAndClearLastRecord()
+			}
+			i := p.column(metrics)
+			if p.columnTypes[i] == "" {
+				p.columnTypes[i] = metrics.Type
 			}
-			if p.record != nil && (p.record.ts != m.Timestamp || p.record.IsFull() || p.record.values[i] != nil) {
-				p.record.Print(p.writer)
-				p.writer.Flush()
-				p.record = nil
+			if p.columnUnits[i] == "" {
+				p.columnUnits[i] = metrics.Unit
 			}
 			if p.record == nil {
 				p.record = &csvRecord{
-					ts:     m.Timestamp,
-					values: make([]*float64, len(p.metrics)),
+					ts:        m.Timestamp,
+					values:    make([]*windowValues, len(p.metrics)),
+					aggregate: p.aggregate,
 				}
 			}
-			p.record.values[i] = &m.Value
-			p.recordTimer = time.AfterFunc(50*time.Millisecond, func() {
-				p.printAndClearLastRecord()
-			})
+			if i >= len(p.record.values) {
+				p.record.values = append(p.record.values, make([]*windowValues, i+1-len(p.record.values))...)
+			}
+			if p.record.values[i] == nil {
+				p.record.values[i] = newWindowValues()
+			}
+			p.record.values[i].Set(m)
 		}
 	}
+	if p.record != nil {
+		p.recordTimer = time.AfterFunc(groupDelay(p.align), p.flushLastRecord)
+	}
 	return nil
 }
 
+// hasColumn returns whether the metrics are printed, either in a known column or in a newly discovered one
+func (p *csvPrinter) hasColumn(metrics models.Metrics) bool {
+	if _, found := p.metrics[metrics.Name]; found {
+		return true
+	}
+	return p.dynamic && p.shouldKeepMetrics(metrics)
+}
+
+// column returns the column of the metrics, adding a column for newly discovered metrics
+func (p *csvPrinter) column(metrics models.Metrics) int {
+	if i, found := p.metrics[metrics.Name]; found {
+		return i
+	}
+	i := len(p.metrics)
+	p.metrics[metrics.Name] = i
+	p.columnTypes = append(p.columnTypes, "")
+	p.columnUnits = append(p.columnUnits, "")
+	return i
+}
+
 func (p *csvPrinter) printAndClearLastRecord() {
 	r := p.record
 	p.record = nil
-	r.Print(p.writer)
+	p.printRecord(r)
+}
+
+// printRecord prints the record, preceded by the header if this is the first one.
+// The header is deferred until then, so it can include the types and units of the metrics seen so far.
+func (p *csvPrinter) printRecord(r *csvRecord) {
+	if p.dynamic {
+		p.printDiscoveredRecord(r, false)
+		return
+	}
+	p.printHeaderOnce.Do(p.printHeader)
+	r.Print(p.writer, p.fill(r), p.format)
+	p.writer.Flush()
+}
+
+// printDiscoveredRecord buffers the records until the columns of the first scrapes were discovered, or until flushed.
+// The header is printed again whenever columns were added since it was printed.
+func (p *csvPrinter) printDiscoveredRecord(r *csvRecord, flush bool) {
+	if r != nil {
+		p.pendingRecords = append(p.pendingRecords, r)
+	}
+	if p.headerColumns == 0 {
+		if len(p.pendingRecords) == 0 || (len(p.pendingRecords) < p.discoverScrapes && !flush) {
+			return
+		}
+		p.sortColumns()
+	}
+	for _, pending := range p.pendingRecords {
+		if p.headerColumns != len(p.metrics) {
+			p.printHeader()
+			p.headerColumns = len(p.metrics)
+		}
+		pending.Print(p.writer, p.fill(pending), p.format)
+	}
+	p.pendingRecords = nil
 	p.writer.Flush()
 }
 
+// sortColumns sorts the discovered columns by name, reordering the values of the buffered records
+func (p *csvPrinter) sortColumns() {
+	names := make([]string, len(p.metrics))
+	for name, i := range p.metrics {
+		names[i] = name
+	}
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	newIndex := make([]int, len(names))
+	columnTypes := make([]models.MetricType, len(names))
+	columnUnits := make([]string, len(names))
+	for i, name := range sorted {
+		oldIndex := p.metrics[name]
+		newIndex[oldIndex] = i
+		columnTypes[i] = p.columnTypes[oldIndex]
+		columnUnits[i] = p.columnUnits[oldIndex]
+		p.metrics[name] = i
+	}
+	p.columnTypes = columnTypes
+	p.columnUnits = columnUnits
+	for _, r := range p.pendingRecords {
+		values := make([]*windowValues, len(names))
+		for oldIndex, v := range r.values {
+			values[newIndex[oldIndex]] = v
+		}
+		r.values = values
+	}
+}
+
+// fill returns the aggregated values of the record for all the columns, with the missing values filled according to the
+// fill policy (nil if left empty), and remembers the last values
+func (p *csvPrinter) fill(r *csvRecord) []*float64 {
+	if len(p.lastValues) < len(p.metrics) {
+		p.lastValues = append(p.lastValues, make([]*float64, len(p.metrics)-len(p.lastValues))...)
+	}
+	values := make([]*float64, len(p.metrics))
+	for i := range values {
+		if i < len(r.values) && r.values[i] != nil {
+			v := r.values[i].Value(r.aggregate)
+			values[i] = &v
+			p.lastValues[i] = &v
+			continue
+		}
+		switch p.fillPolicy {
+		case FillPrevious:
+			values[i] = p.lastValues[i]
+		case FillNaN:
+			nan := math.NaN()
+			values[i] = &nan
+		}
+	}
+	return values
+}
+
+// flushLastRecord prints the last record once its window closed
 func (p *csvPrinter) flushLastRecord() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.recordTimer.Stop()
-	p.printAndClearLastRecord()
+	p.recordTimer = nil
+	if p.record != nil {
+		p.printAndClearLastRecord()
+	}
 }
 
-func (p *csvPrinter) printHeader() {
-	if p.noHeader {
-		return
+// Close prints the last record, and the buffered ones
+func (p *csvPrinter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.recordTimer != nil {
+		p.recordTimer.Stop()
+		p.recordTimer = nil
 	}
+	if p.record != nil {
+		p.printAndClearLastRecord()
+	}
+	if p.dynamic {
+		// Print the buffered records, even if fewer scrapes than needed for discovering the columns were printed
+		p.printDiscoveredRecord(nil, true)
+	}
+	return nil
+}
+
+// printHeader prints the names of the columns, followed by their types and units if the type header is enabled
+func (p *csvPrinter) printHeader() {
 	header := make([]string, len(p.metrics)+1)
 	header[0] = "timestamp"
 	for m, i := range p.metrics {
 		header[i+1] = m
 	}
-	p.writer.Write(header)
+	rows := [][]string{header}
+	if p.typeHeader {
+		types := make([]string, len(p.metrics)+1)
+		types[0] = "type"
+		for i := range p.columnTypes {
+			types[i+1] = columnType(p.columnTypes[i], p.columnUnits[i])
+		}
+		rows = append(rows, types)
+	}
+	if p.schemaFile != "" {
+		p.writeSchemaFile(rows)
+		return
+	}
+	if p.noHeader {
+		return
+	}
+	for _, row := range rows {
+		p.writer.Write(row)
+	}
 }
 
-type csvRecord struct {
-	ts     time.Time
-	values []*float64
+// writeSchemaFile replaces the schema file with the header, so readers never see a partially written one
+func (p *csvPrinter) writeSchemaFile(header [][]string) {
+	b := bytes.Buffer{}
+	w := newCSVWriter(&b, p.writer.Comma)
+	_ = w.WriteAll(header)
+	tmp := p.schemaFile + ".tmp"
+	err := os.WriteFile(tmp, b.Bytes(), 0644)
+	if err == nil {
+		err = os.Rename(tmp, p.schemaFile)
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to write the schema file %s; cause: %s", p.schemaFile, err))
+	}
 }
 
-func (r csvRecord) Print(w *csv.Writer) {
-	record := make([]string, len(r.values)+1)
-	record[0] = fmt.Sprintf("%s", r.ts.UTC().Format("2006-01-02T15:04:05.000"))
-	for i, v := range r.values {
-		record[i+1] = ""
-		if v != nil {
-			record[i+1] = fmt.Sprintf("%f", *v)
-		}
+// columnType returns the type of the metric of a column, followed by its unit when known, e.g. "gauge (bytes)"
+func columnType(metricType models.MetricType, unit string) string {
+	if metricType == "" {
+		metricType = models.MetricTypeUntyped
 	}
-	w.Write(record)
+	if unit == "" {
+		return string(metricType)
+	}
+	return fmt.Sprintf("%s (%s)", metricType, unit)
+}
+
+type csvRecord struct {
+	ts        time.Time
+	values    []*windowValues // by column, nil if the column has no samples
+	aggregate provider.AggregateFunc
+}
+
+// Includes returns whether the timestamp is within the alignment window of the record timestamp (see inAlignmentWindow)
+func (r csvRecord) Includes(ts time.Time, align time.Duration) bool {
+	return inAlignmentWindow(r.ts, ts, align)
 }
 
-func (r csvRecord) IsFull() bool {
-	for _, v := range r.values {
-		if v == nil {
-			return false
+// Print prints the record with the given values of the columns (see csvPrinter.fill)
+func (r csvRecord) Print(w *csv.Writer, values []*float64, format csvFormat) {
+	record := make([]string, len(values)+1)
+	record[0] = format.Timestamp(r.ts)
+	for i, v := range values {
+		if v != nil {
+			record[i+1] = format.Value(*v)
 		}
 	}
-	return true
+	w.Write(record)
 }
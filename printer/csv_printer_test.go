@@ -1,12 +1,18 @@
 package printer
 
 import (
+	"github.com/eldada/metrics-viewer/expression"
 	"github.com/eldada/metrics-viewer/provider"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io"
+	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_csvPrinter_Print(t *testing.T) {
@@ -90,6 +96,240 @@ func Test_csvPrinter_Print(t *testing.T) {
 2020-11-25T22:36:53.456,264581400.000000,2234534000.000000,412343.430000
 2020-11-25T22:37:14.567,235681400.000000,1147484000.000000,512343.430000
 2020-11-25T22:37:25.678,223481400.000000,3147484000.000000,612343.430000
+`,
+		},
+		{
+			name: "metrics aggregated by ignored label",
+			entries: []string{
+				`foo{bar="hello",bla="123"} 10 1606343802324`,
+				`foo{bar="hello",bla="234"} 30 1606343802324`,
+				`foo{bar="hello",bla="123"} 20 1606343813456`,
+				`foo{bar="hello",bla="234"} 40 1606343813456`,
+			},
+			config: configMock{
+				metrics: []string{`foo{bar="hello"}`},
+				aggregateIgnoreLabels: provider.StringSet{
+					"bla": struct{}{},
+				},
+				aggregateFunc: provider.AggregateAvg,
+			},
+			expected: `timestamp,"foo{bar=""hello""}"
+2020-11-25T22:36:42.324,20.000000
+2020-11-25T22:36:53.456,30.000000
+`,
+		},
+		{
+			name: "series counted by ignored label",
+			entries: []string{
+				"foo{bla=\"1\"} 10 1606343802324\nfoo{bla=\"2\"} 20 1606343802324\nfoo{bla=\"3\"} 30 1606343802324\n",
+			},
+			config: configMock{
+				metrics:               []string{"foo"},
+				aggregateIgnoreLabels: provider.StringSet{"bla": {}},
+				aggregateFunc:         provider.AggregateCount,
+			},
+			expected: `timestamp,foo
+2020-11-25T22:36:42.324,3.000000
+`,
+		},
+		{
+			name: "series of several sources aggregated within the alignment window",
+			entries: []string{
+				"foo{instance=\"a\",bla=\"1\"} 1 1606343802324\nfoo{instance=\"a\",bla=\"2\"} 2 1606343802324\n",
+				"foo{instance=\"b\",bla=\"1\"} 6 1606343802791\n",
+			},
+			config: configMock{
+				metrics:               []string{"foo"},
+				aggregateIgnoreLabels: provider.StringSet{"instance": {}, "bla": {}},
+				aggregateFunc:         provider.AggregateAvg,
+				align:                 10 * time.Second,
+			},
+			expected: `timestamp,foo
+2020-11-25T22:36:42.324,3.000000
+`,
+		},
+		{
+			name: "metrics with type and unit",
+			entries: []string{
+				"# TYPE jfrt_runtime_heap_freememory_bytes gauge\njfrt_runtime_heap_freememory_bytes 2.319814e+08 1606343802324\n",
+				"# TYPE jfrt_http_connections_max_total counter\njfrt_http_connections_max_total 50 1606343802324\n",
+				"# TYPE jfrt_http_connections_available gauge\n# UNIT jfrt_http_connections_available connections\njfrt_http_connections_available 12 1606343802.324\n",
+			},
+			config: configMock{
+				metrics: []string{
+					"jfrt_runtime_heap_freememory_bytes",
+					"jfrt_http_connections_max_total",
+					"jfrt_http_connections_available",
+				},
+			},
+			expected: `timestamp,jfrt_runtime_heap_freememory_bytes,jfrt_http_connections_max_total,jfrt_http_connections_available
+2020-11-25T22:36:42.324,231981400.000000,50.000000,12.000000
+`,
+		},
+		{
+			name: "metrics with type and unit, type header",
+			entries: []string{
+				"# TYPE jfrt_runtime_heap_freememory_bytes gauge\njfrt_runtime_heap_freememory_bytes 2.319814e+08 1606343802324\n",
+				"# TYPE jfrt_http_connections_max_total counter\njfrt_http_connections_max_total 50 1606343802324\n",
+				"# TYPE jfrt_http_connections_available gauge\n# UNIT jfrt_http_connections_available connections\njfrt_http_connections_available 12 1606343802.324\n",
+				"foo 1 1606343802324\n",
+			},
+			config: configMock{
+				metrics: []string{
+					"jfrt_runtime_heap_freememory_bytes",
+					"jfrt_http_connections_max_total",
+					"jfrt_http_connections_available",
+					"foo",
+				},
+				typeHeader: true,
+			},
+			expected: `timestamp,jfrt_runtime_heap_freememory_bytes,jfrt_http_connections_max_total,jfrt_http_connections_available,foo
+type,gauge (bytes),counter,gauge (connections),untyped
+2020-11-25T22:36:42.324,231981400.000000,50.000000,12.000000,1.000000
+`,
+		},
+		{
+			name: "samples within the alignment window",
+			entries: []string{
+				"foo 1 1606343802324",
+				"bar 2 1606343802331",
+				"foo 3 1606343813456",
+				"bar 4 1606343813460",
+				"foo 5 1606343834567",
+			},
+			config: configMock{
+				metrics: []string{"foo", "bar"},
+				align:   10 * time.Second,
+			},
+			expected: `timestamp,foo,bar
+2020-11-25T22:36:42.324,1.000000,2.000000
+2020-11-25T22:36:53.456,3.000000,4.000000
+2020-11-25T22:37:14.567,5.000000,
+`,
+		},
+		{
+			name: "repeated samples of a series within the alignment window",
+			entries: []string{
+				"foo 10 1606343802324",
+				"foo 20 1606343803324",
+				"foo 30 1606343804324",
+				"foo 40 1606343813456",
+			},
+			config: configMock{
+				metrics: []string{"foo"},
+				align:   10 * time.Second,
+			},
+			expected: `timestamp,foo
+2020-11-25T22:36:42.324,30.000000
+2020-11-25T22:36:53.456,40.000000
+`,
+		},
+		{
+			name: "early scrape in its own window",
+			entries: []string{
+				"foo 1 1606343802324",
+				"foo 2 1606343808324",
+				"foo 3 1606343818324",
+			},
+			config: configMock{
+				metrics: []string{"foo"},
+				align:   10 * time.Second,
+			},
+			expected: `timestamp,foo
+2020-11-25T22:36:42.324,1.000000
+2020-11-25T22:36:48.324,2.000000
+2020-11-25T22:36:58.324,3.000000
+`,
+		},
+		{
+			name: "missing values filled with previous values",
+			entries: []string{
+				"foo 1 1606343802324",
+				"bar 2 1606343802331",
+				"foo 3 1606343813456",
+				"bar 4 1606343834567",
+			},
+			config: configMock{
+				metrics:    []string{"foo", "bar"},
+				align:      10 * time.Second,
+				fillPolicy: FillPrevious,
+			},
+			expected: `timestamp,foo,bar
+2020-11-25T22:36:42.324,1.000000,2.000000
+2020-11-25T22:36:53.456,3.000000,2.000000
+2020-11-25T22:37:14.567,3.000000,4.000000
+`,
+		},
+		{
+			name: "missing values filled with NaN",
+			entries: []string{
+				"foo 1 1606343802324",
+				"bar 2 1606343813456",
+			},
+			config: configMock{
+				metrics:    []string{"foo", "bar"},
+				align:      10 * time.Second,
+				fillPolicy: FillNaN,
+			},
+			expected: `timestamp,foo,bar
+2020-11-25T22:36:42.324,1.000000,NaN
+2020-11-25T22:36:53.456,NaN,2.000000
+`,
+		},
+		{
+			name: "epoch millis timestamps, scientific values and semicolon delimiter",
+			entries: []string{
+				"jfrt_runtime_heap_freememory_bytes 2.319814e+08 1606343802324\njfrt_runtime_heap_maxmemory_bytes 2.147484e+09 1606343802324\n",
+			},
+			config: configMock{
+				metrics:         []string{"jfrt_runtime_heap_freememory_bytes", "jfrt_runtime_heap_maxmemory_bytes"},
+				timestampFormat: EpochMillisTimestampFormat,
+				floatFormat:     "%.3e",
+				delimiter:       ';',
+			},
+			expected: `timestamp;jfrt_runtime_heap_freememory_bytes;jfrt_runtime_heap_maxmemory_bytes
+1606343802324;2.320e+08;2.147e+09
+`,
+		},
+		{
+			name: "epoch timestamps and tab delimiter",
+			entries: []string{
+				"jfrt_runtime_heap_freememory_bytes 2.319814e+08 1606343802324",
+			},
+			config: configMock{
+				metrics:         []string{"jfrt_runtime_heap_freememory_bytes"},
+				timestampFormat: EpochTimestampFormat,
+				floatFormat:     "%g",
+				delimiter:       '\t',
+			},
+			expected: "timestamp\tjfrt_runtime_heap_freememory_bytes\n1606343802\t2.319814e+08\n",
+		},
+		{
+			name: "rfc3339 timestamps in a time zone",
+			entries: []string{
+				"jfrt_runtime_heap_freememory_bytes 2.319814e+08 1606343802324",
+			},
+			config: configMock{
+				metrics:         []string{"jfrt_runtime_heap_freememory_bytes"},
+				timestampFormat: RFC3339TimestampFormat,
+				timeZone:        time.FixedZone("UTC+2", 2*60*60),
+				floatFormat:     "%.0f",
+			},
+			expected: `timestamp,jfrt_runtime_heap_freememory_bytes
+2020-11-26T00:36:42.324+02:00,231981400
+`,
+		},
+		{
+			name: "custom timestamp layout",
+			entries: []string{
+				"jfrt_runtime_heap_freememory_bytes 2.319814e+08 1606343802324",
+			},
+			config: configMock{
+				metrics:         []string{"jfrt_runtime_heap_freememory_bytes"},
+				timestampFormat: "02/01/2006 15:04:05",
+			},
+			expected: `timestamp,jfrt_runtime_heap_freememory_bytes
+25/11/2020 22:36:42,231981400.000000
 `,
 		},
 	}
@@ -101,29 +341,157 @@ func Test_csvPrinter_Print(t *testing.T) {
 			for _, entry := range tc.entries {
 				p.Print(entry)
 			}
-			p.flushLastRecord()
+			require.NoError(t, p.Close())
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func Test_csvPrinter_flushTimer(t *testing.T) {
+	out := strings.Builder{}
+	p := newCSVPrinter(configMock{
+		metrics: []string{"foo"},
+		align:   20 * time.Millisecond,
+		writer:  &out,
+	})
+	defer p.Close()
+	require.NoError(t, p.Print("foo 1 1606343802324"))
+	assert.Eventually(t, func() bool {
+		// the record is written while holding the lock of the printer
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return out.String() == "timestamp,foo\n2020-11-25T22:36:42.324,1.000000\n"
+	}, time.Second, 5*time.Millisecond, "the record is printed once its window closed")
+}
+
+func Test_csvPrinter_discoveredColumns(t *testing.T) {
+	entries := []string{
+		"b 1 1606343802324\na 2 1606343802324\n",
+		"b 3 1606343813456\nc 4 1606343813456\n",
+		"a 5 1606343834567\n",
+		"d 6 1606343845678\nb 7 1606343845678\n",
+		"skipped 8 1606343845678\n",
+	}
+	tests := []struct {
+		name           string
+		config         configMock
+		expected       string
+		expectedSchema string
+	}{
+		{
+			name: "header printed again for new columns",
+			config: configMock{
+				discoverScrapes: 2,
+				filter:          regexp.MustCompile("^[a-d]$"),
+			},
+			expected: `timestamp,a,b,c
+2020-11-25T22:36:42.324,2.000000,1.000000,
+2020-11-25T22:36:53.456,,3.000000,4.000000
+2020-11-25T22:37:14.567,5.000000,,
+timestamp,a,b,c,d
+2020-11-25T22:37:25.678,,7.000000,,6.000000
+`,
+		},
+		{
+			name: "flushed before all the scrapes were discovered",
+			config: configMock{
+				discoverScrapes: 10,
+				filter:          regexp.MustCompile("^[a-d]$"),
+			},
+			expected: `timestamp,a,b,c,d
+2020-11-25T22:36:42.324,2.000000,1.000000,,
+2020-11-25T22:36:53.456,,3.000000,4.000000,
+2020-11-25T22:37:14.567,5.000000,,,
+2020-11-25T22:37:25.678,,7.000000,,6.000000
+`,
+		},
+		{
+			name: "header in schema file",
+			config: configMock{
+				discoverScrapes: 1,
+				filter:          regexp.MustCompile("^[ab]$"),
+				schemaFile:      filepath.Join(t.TempDir(), "schema.csv"),
+			},
+			expected: `2020-11-25T22:36:42.324,2.000000,1.000000
+2020-11-25T22:36:53.456,,3.000000
+2020-11-25T22:37:14.567,5.000000,
+2020-11-25T22:37:25.678,,7.000000
+`,
+			expectedSchema: "timestamp,a,b\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out := strings.Builder{}
+			tc.config.writer = &out
+			p := newCSVPrinter(tc.config)
+			for _, entry := range entries {
+				require.NoError(t, p.Print(entry))
+			}
+			require.NoError(t, p.Close())
 			assert.Equal(t, tc.expected, out.String())
+			if tc.config.schemaFile != "" {
+				schema, err := os.ReadFile(tc.config.schemaFile)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedSchema, string(schema))
+			}
 		})
 	}
 }
 
 type configMock struct {
 	filter                *regexp.Regexp
+	selector              *provider.Selector
 	aggregateIgnoreLabels provider.StringSet
+	aggregateFunc         provider.AggregateFunc
+	interval              time.Duration
+	expressions           []*expression.Expression
 	format                OutputFormat
 	writer                io.Writer
 	metrics               []string
 	noHeader              bool
+	typeHeader            bool
+	remoteWriteURL        string
+	remoteWriteBatchSize  int
+	retryPolicy           provider.RetryPolicy
+	httpClient            *http.Client
+	authenticator         provider.Authenticator
+	discoverScrapes       int
+	schemaFile            string
+	timestampFormat       string
+	timeZone              *time.Location
+	floatFormat           string
+	delimiter             rune
+	align                 time.Duration
+	fillPolicy            FillPolicy
+	parquetRowGroupSize   int
+	parquetDir            string
 }
 
 func (c configMock) Filter() *regexp.Regexp {
 	return c.filter
 }
 
+func (c configMock) Selector() *provider.Selector {
+	return c.selector
+}
+
 func (c configMock) AggregateIgnoreLabels() provider.StringSet {
 	return c.aggregateIgnoreLabels
 }
 
+func (c configMock) AggregateFunc() provider.AggregateFunc {
+	return c.aggregateFunc
+}
+
+func (c configMock) Interval() time.Duration {
+	return c.interval
+}
+
+func (c configMock) Expressions() []*expression.Expression {
+	return c.expressions
+}
+
 func (c configMock) Format() OutputFormat {
 	return c.format
 }
@@ -139,3 +507,67 @@ func (c configMock) Metrics() []string {
 func (c configMock) NoHeader() bool {
 	return c.noHeader
 }
+
+func (c configMock) TypeHeader() bool {
+	return c.typeHeader
+}
+
+func (c configMock) TimestampFormat() string {
+	return c.timestampFormat
+}
+
+func (c configMock) TimeZone() *time.Location {
+	return c.timeZone
+}
+
+func (c configMock) FloatFormat() string {
+	return c.floatFormat
+}
+
+func (c configMock) Delimiter() rune {
+	return c.delimiter
+}
+
+func (c configMock) Align() time.Duration {
+	return c.align
+}
+
+func (c configMock) FillPolicy() FillPolicy {
+	return c.fillPolicy
+}
+
+func (c configMock) ParquetRowGroupSize() int {
+	return c.parquetRowGroupSize
+}
+
+func (c configMock) ParquetDir() string {
+	return c.parquetDir
+}
+
+func (c configMock) RemoteWriteURL() string {
+	return c.remoteWriteURL
+}
+
+func (c configMock) RemoteWriteBatchSize() int {
+	return c.remoteWriteBatchSize
+}
+
+func (c configMock) RetryPolicy() provider.RetryPolicy {
+	return c.retryPolicy
+}
+
+func (c configMock) DiscoverScrapes() int {
+	return c.discoverScrapes
+}
+
+func (c configMock) SchemaFile() string {
+	return c.schemaFile
+}
+
+func (c configMock) HttpClient() *http.Client {
+	return c.httpClient
+}
+
+func (c configMock) Authenticator() provider.Authenticator {
+	return c.authenticator
+}
@@ -0,0 +1,125 @@
+package printer
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eldada/metrics-viewer/expression"
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/parser"
+)
+
+func NewExpressionEvaluator(conf Config) *ExpressionEvaluator {
+	var maxRange time.Duration
+	for _, e := range conf.Expressions() {
+		if e.Range() > maxRange {
+			maxRange = e.Range()
+		}
+	}
+	return &ExpressionEvaluator{
+		expressions: conf.Expressions(),
+		interval:    conf.Interval(),
+		window:      maxRange + 2*conf.Interval(),
+	}
+}
+
+// ExpressionEvaluator derives entries of the configured expressions from the observed entries.
+// Expressions see the metrics with all their labels, they can aggregate them using "sum by (...)" etc.
+// The entries of one scrape are expected to have close timestamps, so the expressions are evaluated
+// for a scrape once an entry of a later scrape (more than half an interval later) is observed, or when flushed.
+type ExpressionEvaluator struct {
+	expressions []*expression.Expression
+	interval    time.Duration
+	window      time.Duration
+	series      map[string]*models.Metrics // by metric key and labels signature, with the points in timestamp order
+	latest      time.Time
+	pending     bool // whether the latest scrape was not evaluated yet
+}
+
+// Observe adds the entry to the evaluated data, and returns the entries of the expressions if a scrape was completed
+func (e *ExpressionEvaluator) Observe(entry string) []string {
+	if len(e.expressions) == 0 {
+		return nil
+	}
+	metricsCollection, err := parser.ParseMetrics(strings.NewReader(entry))
+	if err != nil {
+		return nil
+	}
+	latest, ok := expression.Latest(metricsCollection)
+	if !ok {
+		return nil
+	}
+	var entries []string
+	if !e.latest.IsZero() && latest.Sub(e.latest) > e.interval/2 {
+		entries = e.Flush()
+		e.trim(latest)
+	}
+	if latest.After(e.latest) {
+		e.latest = latest
+	}
+	e.add(metricsCollection)
+	e.pending = true
+	return entries
+}
+
+// Flush returns the entries of the expressions for the latest scrape if it was not evaluated yet,
+// e.g. once the observed entries ended
+func (e *ExpressionEvaluator) Flush() []string {
+	if !e.pending {
+		return nil
+	}
+	e.pending = false
+	metricsCollection := make([]models.Metrics, 0, len(e.series))
+	for _, metrics := range e.series {
+		metricsCollection = append(metricsCollection, *metrics)
+	}
+	var entries []string
+	for _, exp := range e.expressions {
+		for _, metrics := range exp.Evaluate(metricsCollection, e.latest, e.latest, e.interval) {
+			for _, metric := range metrics.Metrics {
+				entries = append(entries, fmt.Sprintf("%s %s %d", metrics.Name,
+					strconv.FormatFloat(metric.Value, 'g', -1, 64), metric.Timestamp.UnixNano()/int64(time.Millisecond)))
+			}
+		}
+	}
+	return entries
+}
+
+// add appends the points of the metrics to their series
+func (e *ExpressionEvaluator) add(metricsCollection []models.Metrics) {
+	if e.series == nil {
+		e.series = map[string]*models.Metrics{}
+	}
+	for _, metrics := range metricsCollection {
+		for _, metric := range metrics.Metrics {
+			signature := metrics.Key + models.LabelsSignature(metric.Labels)
+			s, found := e.series[signature]
+			if !found {
+				s = &models.Metrics{Key: metrics.Key, Name: metrics.Name, Description: metrics.Description, Type: metrics.Type}
+				e.series[signature] = s
+			}
+			i := len(s.Metrics)
+			if i > 0 && metric.Timestamp.Before(s.Metrics[i-1].Timestamp) {
+				i = sort.Search(len(s.Metrics), func(j int) bool { return s.Metrics[j].Timestamp.After(metric.Timestamp) })
+			}
+			s.Metrics = slices.Insert(s.Metrics, i, metric)
+		}
+	}
+}
+
+// trim drops the points which are too old to be used by any of the expressions at the given time, once per scrape
+func (e *ExpressionEvaluator) trim(latest time.Time) {
+	startFrom := latest.Add(-e.window)
+	for signature, s := range e.series {
+		i := sort.Search(len(s.Metrics), func(j int) bool { return s.Metrics[j].Timestamp.After(startFrom) })
+		if i == len(s.Metrics) {
+			delete(e.series, signature)
+		} else if i > 0 {
+			s.Metrics = slices.Clone(s.Metrics[i:])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package printer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/expression"
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpressionEvaluator_Observe(t *testing.T) {
+	expressions, err := expression.ParseList([]string{
+		`heap_used=jfrt_runtime_heap_maxmemory_bytes - jfrt_runtime_heap_freememory_bytes`,
+		`requests_rate=sum by (method) (rate(requests_total[30s]))`,
+	})
+	require.NoError(t, err)
+	evaluator := NewExpressionEvaluator(configMock{
+		interval:              10 * time.Second,
+		expressions:           expressions,
+		aggregateIgnoreLabels: provider.StringSet{"status": {}},
+	})
+
+	assert.Empty(t, evaluator.Observe("jfrt_runtime_heap_freememory_bytes 200 1606343800000"))
+	assert.Empty(t, evaluator.Observe("jfrt_runtime_heap_maxmemory_bytes 1000 1606343800001"))
+	assert.Empty(t, evaluator.Observe(`requests_total{method="GET",status="200"} 10 1606343800002`))
+	assert.Empty(t, evaluator.Observe(`requests_total{method="GET",status="500"} 5 1606343800002`))
+
+	assert.Equal(t, []string{"heap_used 800 1606343800002"},
+		evaluator.Observe("jfrt_runtime_heap_freememory_bytes 300 1606343810000"))
+	assert.Empty(t, evaluator.Observe("jfrt_runtime_heap_maxmemory_bytes 1000 1606343810001"))
+	assert.Empty(t, evaluator.Observe(`requests_total{method="GET",status="200"} 30 1606343810002`))
+	assert.Empty(t, evaluator.Observe(`requests_total{method="GET",status="500"} 15 1606343810002`))
+
+	assert.Equal(t, []string{"heap_used 700 1606343810002", `requests_rate{method="GET"} 3 1606343810002`},
+		evaluator.Observe("jfrt_runtime_heap_freememory_bytes 300 1606343820000"))
+
+	assert.Equal(t, []string{"heap_used 700 1606343820000", `requests_rate{method="GET"} 3 1606343820000`}, evaluator.Flush(), "the last scrape")
+	assert.Empty(t, evaluator.Flush(), "already flushed")
+}
+
+func TestExpressionEvaluator_ObserveDropsOldPoints(t *testing.T) {
+	expressions, err := expression.ParseList([]string{`foo_rate=rate(foo[20s])`})
+	require.NoError(t, err)
+	evaluator := NewExpressionEvaluator(configMock{interval: 10 * time.Second, expressions: expressions})
+
+	assert.Empty(t, evaluator.Observe(`foo{a="1"} 0 1606343800000`))
+	assert.Empty(t, evaluator.Observe(`foo{a="1"} 10 1606343810000`))
+	assert.Equal(t, []string{`foo_rate{a="1"} 1 1606343810000`}, evaluator.Observe(`foo{a="1"} 30 1606343820000`))
+	assert.Equal(t, []string{`foo_rate{a="1"} 2 1606343820000`}, evaluator.Observe(`foo{a="2"} 0 1606343900000`))
+	require.Len(t, evaluator.series, 1, "the series without recent points are dropped")
+	for _, s := range evaluator.series {
+		assert.Equal(t, map[string]string{"a": "2"}, s.Metrics[0].Labels)
+		assert.Len(t, s.Metrics, 1)
+	}
+}
+
+func TestExpressionEvaluator_ObserveWithoutExpressions(t *testing.T) {
+	evaluator := NewExpressionEvaluator(configMock{interval: time.Second})
+	assert.Empty(t, evaluator.Observe("foo 1 1606343800000"))
+	assert.Empty(t, evaluator.Observe("foo 2 1606343810000"))
+}
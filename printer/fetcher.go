@@ -9,29 +9,42 @@ import (
 )
 
 type FetcherConfig interface {
-	UrlMetricsFetcher() provider.UrlMetricsFetcher
-	File() string
+	Sources() []provider.Source
 	Interval() time.Duration
 }
 
 func NewFetcher(conf FetcherConfig) (MetricEntryFetcher, error) {
-	if conf.File() != "" {
-		return newFileOpenMetricEntryFetcher(conf.File())
-	}
-	if conf.UrlMetricsFetcher() != nil {
-		return newUrlOpenMetricsEntryFetcher(conf.UrlMetricsFetcher(), conf.Interval())
-	}
-	return nil, fmt.Errorf("illegal state, could not create fetcher - file or url are mandatory")
+	return NewFetcherWithContext(context.Background(), conf)
 }
 
+// NewFetcherWithContext creates a fetcher of the configured sources. Entries of multiple sources are labeled with the source name.
 func NewFetcherWithContext(ctx context.Context, conf FetcherConfig) (MetricEntryFetcher, error) {
-	if conf.File() != "" {
-		return newFileOpenMetricEntryFetcherWithContext(ctx, conf.File())
+	switch len(conf.Sources()) {
+	case 0:
+		return nil, fmt.Errorf("illegal state, could not create fetcher - file or url are mandatory")
+	case 1:
+		return newSourceFetcherWithContext(ctx, conf.Sources()[0], conf.Interval())
+	}
+	return newMultiEntryFetcherWithContext(ctx, conf.Sources(), conf.Interval())
+}
+
+func newSourceFetcherWithContext(ctx context.Context, source provider.Source, interval time.Duration) (MetricEntryFetcher, error) {
+	if source.Replay != "" {
+		return newReplayEntryFetcherWithContext(ctx, source.Replay, source.ReplaySpeed)
+	}
+	if len(source.Archives) > 0 {
+		return newRotatedFileFetcherWithContext(ctx, source)
 	}
-	if conf.UrlMetricsFetcher() != nil {
-		return newUrlOpenMetricsEntryFetcherWithContext(ctx, conf.UrlMetricsFetcher(), conf.Interval())
+	if source.File != "" && source.NoFollow {
+		return newFileEntryReaderWithContext(ctx, source.File)
 	}
-	return nil, fmt.Errorf("illegal state, could not create fetcher - file or url are mandatory")
+	if source.File != "" {
+		return newFileOpenMetricEntryFetcherWithContext(ctx, source.File)
+	}
+	if source.UrlMetricsFetcher != nil {
+		return newUrlOpenMetricsEntryFetcherWithContext(ctx, source.UrlMetricsFetcher, interval)
+	}
+	return nil, fmt.Errorf("illegal state, could not create fetcher for source %s - file, url or replay are mandatory", source.Name)
 }
 
 type MetricEntryFetcher interface {
@@ -39,6 +52,14 @@ type MetricEntryFetcher interface {
 	Close() error
 }
 
+// FetchErr returns the error which stopped the fetcher before all the entries were fetched, for fetchers which end
+func FetchErr(fetcher MetricEntryFetcher) error {
+	if f, ok := fetcher.(interface{ Err() error }); ok {
+		return f.Err()
+	}
+	return nil
+}
+
 var sleepFunc = time.Sleep
 
 func sleep(d time.Duration) {
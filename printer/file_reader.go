@@ -0,0 +1,79 @@
+package printer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+// newFileEntryReaderWithContext reads the entries of a file, or of a gzip archive, from its start to its end instead
+// of tailing it. The entries are closed once the whole file was read, or if reading it failed (see Err).
+func newFileEntryReaderWithContext(ctx context.Context, filename string) (*fileEntryReader, error) {
+	f, err := provider.OpenLogFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	reader := fileEntryReader{
+		filename: filename,
+		file:     f,
+		entries:  make(chan string),
+		ctx:      ctx,
+	}
+	go reader.fetch()
+	return &reader, nil
+}
+
+type fileEntryReader struct {
+	filename string
+	file     io.ReadCloser
+	entries  chan string
+	err      error
+	ctx      context.Context
+}
+
+func (f *fileEntryReader) fetch() {
+	defer close(f.entries)
+	r := bufio.NewReader(f.file)
+	entry := strings.Builder{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			f.err = fmt.Errorf("failed to read %s; cause: %w", f.filename, err)
+			return
+		}
+		if line == "" && err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		entry.WriteString(line)
+		entry.WriteRune('\n')
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		select {
+		case <-f.ctx.Done():
+			f.err = f.ctx.Err()
+			return
+		case f.entries <- entry.String():
+			entry.Reset()
+		}
+	}
+}
+
+func (f *fileEntryReader) Entries() <-chan string {
+	return f.entries
+}
+
+// Err returns the error which stopped reading the file before its end, once the entries are closed
+func (f *fileEntryReader) Err() error {
+	return f.err
+}
+
+func (f *fileEntryReader) Close() error {
+	return f.file.Close()
+}
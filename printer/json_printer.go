@@ -0,0 +1,250 @@
+package printer
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/parser"
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+const jsonTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// jsonSample is a sample of a metric, as printed by the json and ndjson printers
+type jsonSample struct {
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     jsonValue         `json:"value"`
+	Timestamp string            `json:"timestamp,omitempty"`
+	Type      models.MetricType `json:"type,omitempty"`
+	Help      string            `json:"help,omitempty"`
+	Unit      string            `json:"unit,omitempty"`
+
+	series string // the name of the mapped metrics, including the labels
+	ts     time.Time
+	metric models.Metric // the sample, with all its labels
+}
+
+// jsonValue is encoded as a number, or as a string if it has no JSON representation (NaN and Inf)
+type jsonValue float64
+
+func (v jsonValue) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+// sampleSelector selects the samples of the entries by --metrics, mapped into series the same as by the csv printer.
+// All the metrics are selected if --metrics is not set. A metric is selected either by its name, or by its name and labels.
+type sampleSelector struct {
+	metrics       provider.StringSet
+	ignoredLabels provider.StringSet
+	aggregate     provider.AggregateFunc
+	families      map[string]models.Metrics // by key, the type, help and unit seen so far
+}
+
+func newSampleSelector(conf Config) *sampleSelector {
+	metrics := provider.StringSet{}
+	metrics.Add(conf.Metrics()...)
+	return &sampleSelector{
+		metrics:       metrics,
+		ignoredLabels: conf.AggregateIgnoreLabels(),
+		aggregate:     conf.AggregateFunc(),
+		families:      map[string]models.Metrics{},
+	}
+}
+
+// family returns the metrics with the type, help and unit of previous entries if they are missing,
+// since only the first entry of a metric family includes its metadata
+func (s *sampleSelector) family(metrics models.Metrics) models.Metrics {
+	family := s.families[metrics.Key]
+	if metrics.Type != "" && metrics.Type != models.MetricTypeUntyped {
+		family.Type = metrics.Type
+	}
+	if metrics.Description != "" {
+		family.Description = metrics.Description
+	}
+	if metrics.Unit != "" {
+		family.Unit = metrics.Unit
+	}
+	s.families[metrics.Key] = family
+	if family.Type == "" {
+		family.Type = metrics.Type
+	}
+	return family
+}
+
+// Samples returns the samples of the series, aggregating the samples of the series collapsed into each of them
+// by timestamp. The samples are sorted by series and timestamp.
+func (s *sampleSelector) Samples(entry string) ([]jsonSample, error) {
+	rawSamples, err := s.RawSamples(entry)
+	if err != nil {
+		return nil, err
+	}
+	var samples []jsonSample
+	var values []*windowValues
+	for _, sample := range rawSamples {
+		last := len(samples) - 1
+		if last < 0 || samples[last].series != sample.series || !samples[last].ts.Equal(sample.ts) {
+			samples = append(samples, sample)
+			values = append(values, newWindowValues())
+			last++
+		}
+		values[last].Set(sample.metric)
+	}
+	for i := range samples {
+		samples[i].Value = jsonValue(values[i].Value(s.aggregate))
+	}
+	return samples, nil
+}
+
+// RawSamples returns the samples of the entry as they were parsed, with the name and labels of the series they are
+// collapsed into, which are aggregated by the caller. The samples are sorted by series and timestamp.
+func (s *sampleSelector) RawSamples(entry string) ([]jsonSample, error) {
+	metricsCollection, err := parser.ParseMetrics(strings.NewReader(entry))
+	if err != nil {
+		return nil, err
+	}
+	var samples []jsonSample
+	for _, metrics := range metricsCollection {
+		family := s.family(metrics)
+		for _, m := range metrics.Metrics {
+			series := provider.SeriesName(s.ignoredLabels, ",", metrics.Key, m.Labels)
+			if s.metrics.Len() > 0 && !s.metrics.Contains(series) && !s.metrics.Contains(metrics.Key) {
+				continue
+			}
+			samples = append(samples, jsonSample{
+				Name:   metrics.Key,
+				Labels: provider.FilterLabels(s.ignoredLabels, m.Labels),
+				Value:  jsonValue(m.Value),
+				Type:   family.Type,
+				Help:   family.Description,
+				Unit:   family.Unit,
+				series: series,
+				ts:     m.Timestamp,
+				metric: m,
+			})
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		if samples[i].series != samples[j].series {
+			return samples[i].series < samples[j].series
+		}
+		return samples[i].ts.Before(samples[j].ts)
+	})
+	return samples, nil
+}
+
+func newJSONPrinter(conf Config) *jsonPrinter {
+	return &jsonPrinter{
+		encoder:   json.NewEncoder(conf.Writer()),
+		selector:  newSampleSelector(conf),
+		aggregate: conf.AggregateFunc(),
+		align:     conf.Align(),
+	}
+}
+
+// jsonPrinter prints a JSON document per scrape, with all the selected samples within the alignment window of its first
+// sample. The latest samples of the series collapsed into each printed sample (see windowValues) are aggregated when the
+// document is printed. The document is printed once a sample outside the window arrives, once no sample arrived for half
+// of the window, or when the printer is closed.
+type jsonPrinter struct {
+	encoder   *json.Encoder
+	selector  *sampleSelector
+	aggregate provider.AggregateFunc
+	align     time.Duration
+
+	document      *jsonDocument
+	documentTimer *time.Timer
+	mu            sync.Mutex
+}
+
+type jsonDocument struct {
+	Timestamp string       `json:"timestamp"`
+	Metrics   []jsonSample `json:"metrics"`
+
+	ts     time.Time
+	values []*windowValues
+	index  map[string]int // by series
+}
+
+func (p *jsonPrinter) Print(entry string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	samples, err := p.selector.RawSamples(entry)
+	if err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		if p.documentTimer != nil {
+			p.documentTimer.Stop()
+			p.documentTimer = nil
+		}
+		if p.document != nil && !inAlignmentWindow(p.document.ts, sample.ts, p.align) {
+			if err := p.printDocument(p.document); err != nil {
+				return err
+			}
+			p.document = nil
+		}
+		if p.document == nil {
+			p.document = &jsonDocument{
+				Timestamp: sample.ts.UTC().Format(jsonTimestampLayout),
+				ts:        sample.ts,
+				index:     map[string]int{},
+			}
+		}
+		i, found := p.document.index[sample.series]
+		if !found {
+			i = len(p.document.Metrics)
+			p.document.index[sample.series] = i
+			p.document.Metrics = append(p.document.Metrics, sample)
+			p.document.values = append(p.document.values, newWindowValues())
+		}
+		p.document.values[i].Set(sample.metric)
+		p.documentTimer = time.AfterFunc(groupDelay(p.align), func() {
+			p.flushLastDocument()
+		})
+	}
+	return nil
+}
+
+func (p *jsonPrinter) printDocument(d *jsonDocument) error {
+	for i := range d.Metrics {
+		d.Metrics[i].Value = jsonValue(d.values[i].Value(p.aggregate))
+	}
+	return p.encoder.Encode(d)
+}
+
+func (p *jsonPrinter) flushLastDocument() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.printLastDocument()
+}
+
+func (p *jsonPrinter) printLastDocument() error {
+	if p.documentTimer != nil {
+		p.documentTimer.Stop()
+		p.documentTimer = nil
+	}
+	if p.document == nil {
+		return nil
+	}
+	d := p.document
+	p.document = nil
+	return p.printDocument(d)
+}
+
+// Close prints the last document
+func (p *jsonPrinter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.printLastDocument()
+}
@@ -0,0 +1,117 @@
+package printer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_jsonPrinter_Print(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		config   configMock
+		expected string
+	}{
+		{
+			name: "document per scrape",
+			entries: []string{
+				"# HELP foo_bytes Foo.\n# TYPE foo_bytes gauge\nfoo_bytes{a=\"1\"} 1 1606343802324\nfoo_bytes{a=\"2\"} 2 1606343802324\n",
+				"bar 3 1606343802324\n",
+				"foo_bytes{a=\"1\"} 4 1606343813456\n",
+			},
+			config: configMock{},
+			expected: `{"timestamp":"2020-11-25T22:36:42.324Z","metrics":[` +
+				`{"name":"foo_bytes","labels":{"a":"1"},"value":1,"type":"gauge","help":"Foo.","unit":"bytes"},` +
+				`{"name":"foo_bytes","labels":{"a":"2"},"value":2,"type":"gauge","help":"Foo.","unit":"bytes"},` +
+				`{"name":"bar","value":3,"type":"untyped"}]}
+{"timestamp":"2020-11-25T22:36:53.456Z","metrics":[{"name":"foo_bytes","labels":{"a":"1"},"value":4,"type":"gauge","help":"Foo.","unit":"bytes"}]}
+`,
+		},
+		{
+			name: "document per alignment window",
+			entries: []string{
+				"foo 1 1606343802324\n",
+				"bar 2 1606343802391\n",
+				"foo 3 1606343807300\n",
+				"bar 4 1606343807302\n",
+			},
+			config: configMock{align: 5 * time.Second},
+			expected: `{"timestamp":"2020-11-25T22:36:42.324Z","metrics":[{"name":"foo","value":1,"type":"untyped"},{"name":"bar","value":2,"type":"untyped"}]}
+{"timestamp":"2020-11-25T22:36:47.300Z","metrics":[{"name":"foo","value":3,"type":"untyped"},{"name":"bar","value":4,"type":"untyped"}]}
+`,
+		},
+		{
+			name: "repeated samples of a series within the alignment window",
+			entries: []string{
+				"foo 10 1606343802324\n",
+				"foo 20 1606343803324\n",
+				"foo 30 1606343804324\n",
+			},
+			config: configMock{align: 10 * time.Second},
+			expected: `{"timestamp":"2020-11-25T22:36:42.324Z","metrics":[{"name":"foo","value":30,"type":"untyped"}]}
+`,
+		},
+		{
+			name: "selected and aggregated metrics",
+			entries: []string{
+				"foo{a=\"1\",b=\"x\"} 1 1606343802324\nfoo{a=\"1\",b=\"y\"} 2 1606343802324\nfoo{a=\"2\",b=\"x\"} 3 1606343802324\n",
+				"foo{a=\"1\",b=\"z\"} 4 1606343802324\n",
+				"bar 3 1606343802324\n",
+				"baz NaN 1606343802324\n",
+			},
+			config: configMock{
+				metrics:               []string{`foo{a="1"}`, "baz"},
+				aggregateIgnoreLabels: provider.StringSet{"b": {}},
+				aggregateFunc:         provider.AggregateMax,
+			},
+			expected: `{"timestamp":"2020-11-25T22:36:42.324Z","metrics":[` +
+				`{"name":"foo","labels":{"a":"1"},"value":4,"type":"untyped"},{"name":"baz","value":"NaN","type":"untyped"}]}
+`,
+		},
+		{
+			name: "series of several sources aggregated within the alignment window",
+			entries: []string{
+				"foo{instance=\"a\",bla=\"1\"} 1 1606343802324\nfoo{instance=\"a\",bla=\"2\"} 2 1606343802324\n",
+				"foo{instance=\"b\",bla=\"1\"} 6 1606343802791\n",
+			},
+			config: configMock{
+				aggregateIgnoreLabels: provider.StringSet{"instance": {}, "bla": {}},
+				aggregateFunc:         provider.AggregateCount,
+				align:                 10 * time.Second,
+			},
+			expected: `{"timestamp":"2020-11-25T22:36:42.324Z","metrics":[{"name":"foo","value":3,"type":"untyped"}]}
+`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out := strings.Builder{}
+			tc.config.writer = &out
+			p := newJSONPrinter(tc.config)
+			for _, entry := range tc.entries {
+				require.NoError(t, p.Print(entry))
+			}
+			require.NoError(t, p.Close())
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+}
+
+func Test_ndjsonPrinter_Print(t *testing.T) {
+	out := strings.Builder{}
+	p := newNDJSONPrinter(configMock{
+		writer:  &out,
+		metrics: []string{"foo_seconds_total"},
+	})
+	require.NoError(t, p.Print("# HELP foo_seconds Foo.\n# TYPE foo_seconds counter\n# UNIT foo_seconds seconds\n"+
+		"foo_seconds_total{a=\"1\"} 1 1606343802.324\nfoo_seconds_total{a=\"2\"} +Inf 1606343802.324\n"))
+	require.NoError(t, p.Print("bar 3 1606343802324\n"))
+	assert.Equal(t, `{"name":"foo_seconds_total","labels":{"a":"1"},"value":1,"timestamp":"2020-11-25T22:36:42.324Z","type":"counter","help":"Foo.","unit":"seconds"}
+{"name":"foo_seconds_total","labels":{"a":"2"},"value":"+Inf","timestamp":"2020-11-25T22:36:42.324Z","type":"counter","help":"Foo.","unit":"seconds"}
+`, out.String())
+}
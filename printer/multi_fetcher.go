@@ -0,0 +1,91 @@
+package printer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eldada/metrics-viewer/parser"
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+func newMultiEntryFetcherWithContext(ctx context.Context, sources []provider.Source, interval time.Duration) (*multiEntryFetcher, error) {
+	fetcher := multiEntryFetcher{
+		entries: make(chan string),
+		ctx:     ctx,
+	}
+	for _, source := range sources {
+		f, err := newSourceFetcherWithContext(ctx, source, interval)
+		if err != nil {
+			_ = fetcher.Close()
+			return nil, err
+		}
+		fetcher.names = append(fetcher.names, source.Name)
+		fetcher.fetchers = append(fetcher.fetchers, f)
+	}
+	go fetcher.fetch()
+	return &fetcher, nil
+}
+
+// multiEntryFetcher merges the entries of all the sources, labeling each entry with its source name
+type multiEntryFetcher struct {
+	names    []string
+	fetchers []MetricEntryFetcher
+	entries  chan string
+	ctx      context.Context
+}
+
+func (f *multiEntryFetcher) fetch() {
+	defer close(f.entries)
+	wg := sync.WaitGroup{}
+	for i, fetcher := range f.fetchers {
+		wg.Add(1)
+		go func(name string, fetcher MetricEntryFetcher) {
+			defer wg.Done()
+			for entry := range fetcher.Entries() {
+				select {
+				case <-f.ctx.Done():
+					return
+				case f.entries <- withInstanceLabel(entry, name):
+				}
+			}
+		}(f.names[i], fetcher)
+	}
+	wg.Wait()
+}
+
+func (f *multiEntryFetcher) Entries() <-chan string {
+	return f.entries
+}
+
+// Err returns the errors which stopped any of the fetchers
+func (f *multiEntryFetcher) Err() error {
+	var errs []error
+	for _, fetcher := range f.fetchers {
+		if err := FetchErr(fetcher); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *multiEntryFetcher) Close() error {
+	var errs []string
+	for _, fetcher := range f.fetchers {
+		if err := fetcher.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close fetchers: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// withInstanceLabel sets the instance label on all the samples of the entry, overriding any existing one
+func withInstanceLabel(entry string, instance string) string {
+	return parser.SetLabel(entry, provider.InstanceLabel, instance)
+}
@@ -0,0 +1,75 @@
+package printer
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_withInstanceLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    string
+		expected string
+	}{
+		{
+			name:     "no labels",
+			entry:    "# HELP foo Foo\n# TYPE foo gauge\nfoo 1 1606343802324\n",
+			expected: "# HELP foo Foo\n# TYPE foo gauge\nfoo{instance=\"node1\"} 1 1606343802324\n",
+		},
+		{
+			name:     "empty labels",
+			entry:    "foo{} 1\n",
+			expected: "foo{instance=\"node1\"} 1\n",
+		},
+		{
+			name:     "with labels",
+			entry:    `foo{a="b",c="d"} 1`,
+			expected: `foo{instance="node1",a="b",c="d"} 1`,
+		},
+		{
+			name:     "existing instance label is replaced",
+			entry:    `foo{a="b",instance="other",my_instance="x"} 1`,
+			expected: `foo{instance="node1",a="b",my_instance="x"} 1`,
+		},
+		{
+			name:     "exemplar labels are kept",
+			entry:    `foo_bucket{le="1"} 1 # {trace_id="abc"} 0.5`,
+			expected: `foo_bucket{instance="node1",le="1"} 1 # {trace_id="abc"} 0.5`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, withInstanceLabel(tc.entry, "node1"))
+		})
+	}
+}
+
+func Test_multiEntryFetcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f, err := newMultiEntryFetcherWithContext(ctx, []provider.Source{
+		{Name: "node1", UrlMetricsFetcher: &metricsFetcherMock{}},
+		{Name: "node2", UrlMetricsFetcher: &metricsFetcherMock{}},
+	}, time.Millisecond)
+	require.NoError(t, err)
+	defer f.Close()
+
+	instances := map[string]bool{}
+	for len(instances) < 2 {
+		select {
+		case entry := <-f.Entries():
+			match := regexp.MustCompile(`instance="([^"]+)"`).FindStringSubmatch(entry)
+			require.NotNil(t, match, "entry without instance label: %s", entry)
+			instances[match[1]] = true
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for entries")
+		}
+	}
+	assert.Equal(t, map[string]bool{"node1": true, "node2": true}, instances)
+}
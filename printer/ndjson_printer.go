@@ -0,0 +1,40 @@
+package printer
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+func newNDJSONPrinter(conf Config) *ndjsonPrinter {
+	return &ndjsonPrinter{
+		encoder:  json.NewEncoder(conf.Writer()),
+		selector: newSampleSelector(conf),
+	}
+}
+
+// ndjsonPrinter prints a JSON line per selected sample
+type ndjsonPrinter struct {
+	encoder  *json.Encoder
+	selector *sampleSelector
+	mu       sync.Mutex
+}
+
+func (p *ndjsonPrinter) Print(entry string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	samples, err := p.selector.Samples(entry)
+	if err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		sample.Timestamp = sample.ts.UTC().Format(jsonTimestampLayout)
+		if err := p.encoder.Encode(sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ndjsonPrinter) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const defaultParquetRowGroupSize = 10000
+
+// parquetRow is a row of the long-format table written by the parquet printer, a sample per row
+type parquetRow struct {
+	Timestamp time.Time         `parquet:"timestamp,timestamp(millisecond)"`
+	Name      string            `parquet:"name,dict"`
+	Labels    map[string]string `parquet:"labels"`
+	Value     float64           `parquet:"value"`
+	Type      string            `parquet:"type,dict"`
+}
+
+func newParquetPrinter(conf Config) *parquetPrinter {
+	p := &parquetPrinter{
+		selector:     newSampleSelector(conf),
+		rowGroupSize: conf.ParquetRowGroupSize(),
+		dir:          conf.ParquetDir(),
+	}
+	if p.rowGroupSize <= 0 {
+		p.rowGroupSize = defaultParquetRowGroupSize
+	}
+	if p.dir == "" {
+		p.writer = newParquetWriter(conf.Writer())
+	}
+	return p
+}
+
+func newParquetWriter(w io.Writer) *parquet.GenericWriter[parquetRow] {
+	return parquet.NewGenericWriter[parquetRow](w, parquet.Compression(&parquet.Snappy))
+}
+
+// parquetPrinter writes the selected samples as a parquet file, with a row per sample.
+// A row group is flushed every configured number of rows, so the rows of a long-running tail are not all kept in memory.
+// A single file is only readable once the printer is closed, which writes its footer. With a directory, each row group
+// is written as a complete file instead, named by the timestamp of its first row, which appears once it is complete.
+type parquetPrinter struct {
+	writer       *parquet.GenericWriter[parquetRow] // nil until the first row with a directory
+	selector     *sampleSelector
+	rowGroupSize int
+	rows         int // in the current row group
+	dir          string
+	file         *os.File  // the temporary file of the current row group with a directory
+	firstRow     time.Time // of the current file with a directory
+	files        int       // written to the directory
+	closed       bool
+	mu           sync.Mutex
+}
+
+func (p *parquetPrinter) Print(entry string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	samples, err := p.selector.Samples(entry)
+	if err != nil {
+		return err
+	}
+	rows := make([]parquetRow, 0, len(samples))
+	for _, sample := range samples {
+		rows = append(rows, parquetRow{
+			Timestamp: sample.ts.UTC(),
+			Name:      sample.Name,
+			Labels:    sample.Labels,
+			Value:     float64(sample.Value),
+			Type:      string(sample.Type),
+		})
+	}
+	for len(rows) > 0 {
+		if p.writer == nil {
+			if err := p.createFile(rows[0].Timestamp); err != nil {
+				return err
+			}
+		}
+		n := min(len(rows), p.rowGroupSize-p.rows)
+		if _, err := p.writer.Write(rows[:n]); err != nil {
+			return err
+		}
+		rows = rows[n:]
+		p.rows += n
+		if p.rows >= p.rowGroupSize {
+			if err := p.flushRowGroup(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createFile creates the temporary file of the next row group in the directory
+func (p *parquetPrinter) createFile(firstRow time.Time) error {
+	f, err := os.CreateTemp(p.dir, ".metrics-*.parquet.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create a parquet file in %s; cause: %w", p.dir, err)
+	}
+	p.file = f
+	p.firstRow = firstRow
+	p.writer = newParquetWriter(f)
+	return nil
+}
+
+// flushRowGroup flushes the current row group, completing its file with a directory
+func (p *parquetPrinter) flushRowGroup() error {
+	p.rows = 0
+	if p.dir == "" {
+		return p.writer.Flush()
+	}
+	return p.completeFile()
+}
+
+// completeFile writes the footer of the current file, and renames it so readers never see a partially written one
+func (p *parquetPrinter) completeFile() error {
+	f := p.file
+	err := p.writer.Close()
+	p.writer = nil
+	p.file = nil
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		p.files++
+		name := fmt.Sprintf("metrics-%s-%d.parquet", p.firstRow.Format("20060102T150405.000Z"), p.files)
+		err = os.Rename(f.Name(), filepath.Join(p.dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("failed to write a parquet file in %s; cause: %w", p.dir, err)
+	}
+	return nil
+}
+
+// Close writes the pending rows and the footer of the file
+func (p *parquetPrinter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.dir == "" {
+		return p.writer.Close()
+	}
+	if p.writer == nil {
+		return nil
+	}
+	return p.completeFile()
+}
@@ -0,0 +1,85 @@
+package printer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parquetPrinter(t *testing.T) {
+	out := bytes.Buffer{}
+	p := newParquetPrinter(configMock{
+		writer:              &out,
+		metrics:             []string{"jfrt_http_requests_total", "jfrt_runtime_heap_freememory_bytes"},
+		parquetRowGroupSize: 2,
+	})
+	entries := []string{
+		"# TYPE jfrt_http_requests_total counter\njfrt_http_requests_total{method=\"GET\"} 10 1606343802324\n",
+		"jfrt_http_requests_total{method=\"PUT\"} 2 1606343802324\n",
+		"jfrt_runtime_heap_freememory_bytes 2.319814e+08 1606343802324\n",
+		"skipped 1 1606343802324\n",
+		"jfrt_http_requests_total{method=\"GET\"} 15 1606343813456\n",
+	}
+	for _, entry := range entries {
+		require.NoError(t, p.Print(entry))
+	}
+	require.NoError(t, p.Close())
+
+	f, err := parquet.OpenFile(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	assert.Len(t, f.RowGroups(), 2, "row groups")
+	rows, err := parquet.Read[parquetRow](bytes.NewReader(out.Bytes()), int64(out.Len()))
+	require.NoError(t, err)
+	t0 := time.Date(2020, 11, 25, 22, 36, 42, 324000000, time.UTC)
+	assert.Equal(t, []parquetRow{
+		{Timestamp: t0, Name: "jfrt_http_requests_total", Labels: map[string]string{"method": "GET"}, Value: 10, Type: "counter"},
+		{Timestamp: t0, Name: "jfrt_http_requests_total", Labels: map[string]string{"method": "PUT"}, Value: 2, Type: "counter"},
+		{Timestamp: t0, Name: "jfrt_runtime_heap_freememory_bytes", Labels: map[string]string{}, Value: 2.319814e+08, Type: "untyped"},
+		{Timestamp: t0.Add(11132 * time.Millisecond), Name: "jfrt_http_requests_total", Labels: map[string]string{"method": "GET"}, Value: 15, Type: "counter"},
+	}, rows)
+}
+
+func Test_parquetPrinter_dir(t *testing.T) {
+	dir := t.TempDir()
+	p := newParquetPrinter(configMock{
+		parquetDir:          dir,
+		parquetRowGroupSize: 2,
+	})
+	readDir := func() [][]parquetRow {
+		files, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+		require.NoError(t, err)
+		sort.Strings(files)
+		var rows [][]parquetRow
+		for _, file := range files {
+			b, err := os.ReadFile(file)
+			require.NoError(t, err)
+			fileRows, err := parquet.Read[parquetRow](bytes.NewReader(b), int64(len(b)))
+			require.NoError(t, err, file)
+			rows = append(rows, fileRows)
+		}
+		return rows
+	}
+	require.NoError(t, p.Print("foo 1 1606343802324\nbar 2 1606343802324\n"))
+	require.NoError(t, p.Print("foo 3 1606343813456\n"))
+	// The first row group is readable before the printer is closed
+	files := readDir()
+	require.Len(t, files, 1)
+	assert.Len(t, files[0], 2)
+
+	require.NoError(t, p.Close())
+	files = readDir()
+	require.Len(t, files, 2)
+	assert.Equal(t, []parquetRow{
+		{Timestamp: time.Date(2020, 11, 25, 22, 36, 53, 456000000, time.UTC), Name: "foo", Labels: map[string]string{}, Value: 3, Type: "untyped"},
+	}, files[1])
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary files are left")
+}
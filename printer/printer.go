@@ -2,18 +2,41 @@ package printer
 
 import (
 	"fmt"
+	"github.com/eldada/metrics-viewer/expression"
 	"github.com/eldada/metrics-viewer/provider"
 	"io"
+	"net/http"
 	"regexp"
+	"time"
 )
 
 type Config interface {
 	Filter() *regexp.Regexp
+	Selector() *provider.Selector
 	AggregateIgnoreLabels() provider.StringSet
+	AggregateFunc() provider.AggregateFunc
+	Interval() time.Duration
+	Expressions() []*expression.Expression
 	Format() OutputFormat
 	Writer() io.Writer
 	Metrics() []string
 	NoHeader() bool
+	TypeHeader() bool
+	DiscoverScrapes() int
+	SchemaFile() string
+	TimestampFormat() string
+	TimeZone() *time.Location
+	FloatFormat() string
+	Delimiter() rune
+	Align() time.Duration
+	FillPolicy() FillPolicy
+	ParquetRowGroupSize() int
+	ParquetDir() string
+	RemoteWriteURL() string
+	RemoteWriteBatchSize() int
+	RetryPolicy() provider.RetryPolicy
+	HttpClient() *http.Client
+	Authenticator() provider.Authenticator
 }
 
 type OutputFormat string
@@ -21,11 +44,34 @@ type OutputFormat string
 const (
 	OpenMetricsFormat OutputFormat = "open-metrics"
 	CSVFormat         OutputFormat = "csv"
+	JSONFormat        OutputFormat = "json"
+	NDJSONFormat      OutputFormat = "ndjson"
+	RemoteWriteFormat OutputFormat = "remote-write"
+	ParquetFormat     OutputFormat = "parquet"
 )
 
 var SupportedOutputFormats = map[string]OutputFormat{
 	string(OpenMetricsFormat): OpenMetricsFormat,
 	string(CSVFormat):         CSVFormat,
+	string(JSONFormat):        JSONFormat,
+	string(NDJSONFormat):      NDJSONFormat,
+	string(RemoteWriteFormat): RemoteWriteFormat,
+	string(ParquetFormat):     ParquetFormat,
+}
+
+// FillPolicy is how missing values of csv records are filled
+type FillPolicy string
+
+const (
+	FillEmpty    FillPolicy = "empty"
+	FillPrevious FillPolicy = "previous"
+	FillNaN      FillPolicy = "nan"
+)
+
+var SupportedFillPolicies = map[string]FillPolicy{
+	string(FillEmpty):    FillEmpty,
+	string(FillPrevious): FillPrevious,
+	string(FillNaN):      FillNaN,
 }
 
 func NewPrinter(conf Config) (Printer, error) {
@@ -34,10 +80,20 @@ func NewPrinter(conf Config) (Printer, error) {
 		return &openMetricsPrinter{writer: conf.Writer()}, nil
 	case CSVFormat:
 		return newCSVPrinter(conf), nil
+	case JSONFormat:
+		return newJSONPrinter(conf), nil
+	case NDJSONFormat:
+		return newNDJSONPrinter(conf), nil
+	case RemoteWriteFormat:
+		return newRemoteWritePrinter(conf), nil
+	case ParquetFormat:
+		return newParquetPrinter(conf), nil
 	}
 	return nil, fmt.Errorf("unexpected output format: %s", conf.Format())
 }
 
+// Printer prints the metric entries. Printers may buffer entries, so Close must be called on exit to print them.
 type Printer interface {
 	Print(entry string) error
+	io.Closer
 }
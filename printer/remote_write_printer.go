@@ -0,0 +1,338 @@
+package printer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/parser"
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/golang/snappy"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const defaultRemoteWriteBatchSize = 500
+const defaultRemoteWriteFlushInterval = 5 * time.Second
+
+// remoteWriteMaxPendingBatches is the number of batches waiting to be sent before printing blocks
+const remoteWriteMaxPendingBatches = 10
+
+// remoteWriteBatchDeadline is how long a batch is retried before it is dropped, so an unavailable endpoint does not
+// block printing for long
+const remoteWriteBatchDeadline = time.Minute
+
+// remoteWriteCloseTimeout is how long closing waits for the pending batches to be sent before dropping them
+var remoteWriteCloseTimeout = 30 * time.Second
+
+func newRemoteWritePrinter(conf Config) *remoteWritePrinter {
+	metrics := provider.StringSet{}
+	metrics.Add(conf.Metrics()...)
+	client := conf.HttpClient()
+	if client == nil {
+		client = &http.Client{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &remoteWritePrinter{
+		url:           conf.RemoteWriteURL(),
+		client:        client,
+		authenticator: conf.Authenticator(),
+		retryPolicy:   conf.RetryPolicy(),
+		metrics:       metrics,
+		batchSize:     conf.RemoteWriteBatchSize(),
+		flushInterval: conf.Interval(),
+		batches:       make(chan *remoteWriteBatch, remoteWriteMaxPendingBatches),
+		done:          make(chan struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+		families:      map[string]remoteWriteMetadata{},
+	}
+	if p.batchSize <= 0 {
+		p.batchSize = defaultRemoteWriteBatchSize
+	}
+	if p.flushInterval <= 0 {
+		p.flushInterval = defaultRemoteWriteFlushInterval
+	}
+	go p.send()
+	return p
+}
+
+// remoteWritePrinter pushes the samples to a Prometheus remote write endpoint, as snappy compressed protobuf WriteRequests.
+// Samples are sent in batches of the configured size, or when the flush interval passed since the first pending sample.
+// Each request is bounded by the timeout of the retry policy, and failed requests are retried as the policy allows,
+// unless the endpoint rejected the batch (4xx other than 429), or the batch deadline passed.
+// The requests use the TLS options and the authentication of the url sources.
+// The samples keep all their labels, and are selected by --metrics if set.
+type remoteWritePrinter struct {
+	url           string
+	client        *http.Client
+	authenticator provider.Authenticator
+	retryPolicy   provider.RetryPolicy
+	metrics       provider.StringSet
+	batchSize     int
+	flushInterval time.Duration
+
+	batch      *remoteWriteBatch
+	flushTimer *time.Timer
+	families   map[string]remoteWriteMetadata // by family name, the metadata seen so far
+	batches    chan *remoteWriteBatch
+	done       chan struct{}
+	ctx        context.Context // canceled by Close, once the pending batches were sent or the close timeout passed
+	cancel     context.CancelFunc
+	closeOnce  sync.Once
+	mu         sync.Mutex
+}
+
+func (p *remoteWritePrinter) Print(entry string) error {
+	metricsCollection, err := parser.ParseMetrics(strings.NewReader(entry))
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, metrics := range metricsCollection {
+		if p.metrics.Len() > 0 && !p.metrics.Contains(metrics.Key) {
+			continue
+		}
+		family := p.addMetadata(metrics)
+		for _, m := range metrics.Metrics {
+			if p.batch == nil {
+				p.batch = newRemoteWriteBatch()
+				p.flushTimer = time.AfterFunc(p.flushInterval, p.flush)
+			}
+			p.batch.Add(metrics.Key, family, m)
+			if p.batch.samples >= p.batchSize {
+				p.flushLocked()
+			}
+		}
+	}
+	return nil
+}
+
+// addMetadata updates the metadata of the family of the metrics, e.g. of the histogram of a "_bucket" series, and returns its name
+func (p *remoteWritePrinter) addMetadata(metrics models.Metrics) string {
+	family := metrics.FamilyName()
+	metadata := p.families[family]
+	if metrics.Type != "" && metrics.Type != models.MetricTypeUntyped {
+		metadata.metricType = metrics.Type
+	}
+	if metrics.Description != "" {
+		metadata.help = metrics.Description
+	}
+	if metrics.Unit != "" {
+		metadata.unit = metrics.Unit
+	}
+	metadata.name = family
+	p.families[family] = metadata
+	return family
+}
+
+func (p *remoteWritePrinter) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flushLocked()
+}
+
+// flushLocked hands the pending batch to the sender, blocking if too many batches are pending
+func (p *remoteWritePrinter) flushLocked() {
+	if p.flushTimer != nil {
+		p.flushTimer.Stop()
+		p.flushTimer = nil
+	}
+	if p.batch == nil {
+		return
+	}
+	for _, name := range p.batch.families {
+		p.batch.metadata = append(p.batch.metadata, p.families[name])
+	}
+	p.batches <- p.batch
+	p.batch = nil
+}
+
+func (p *remoteWritePrinter) send() {
+	defer close(p.done)
+	for batch := range p.batches {
+		body := snappy.Encode(nil, batch.Encode())
+		ctx, cancel := context.WithTimeout(p.ctx, remoteWriteBatchDeadline)
+		_, err := p.retryPolicy.Do(ctx, func(ctx context.Context) ([]byte, error) {
+			return nil, p.post(ctx, body)
+		})
+		cancel()
+		if err != nil {
+			log.Error(fmt.Sprintf("dropped %d samples, failed to send them to %s; cause: %s", batch.samples, p.url, err))
+		}
+	}
+}
+
+// post sends the compressed request. A rejected request fails with a provider.StatusError, so it is not retried.
+func (p *remoteWritePrinter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "metrics-viewer")
+	res, err := provider.DoAuthorized(p.client, p.authenticator, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("%w: %s", &provider.StatusError{Status: res.Status, StatusCode: res.StatusCode}, strings.TrimSpace(string(msg)))
+}
+
+// Close sends the pending samples, and waits until all the batches were sent, or drops the remaining ones once the
+// close timeout passed
+func (p *remoteWritePrinter) Close() error {
+	p.closeOnce.Do(func() {
+		p.flush()
+		close(p.batches)
+	})
+	timer := time.NewTimer(remoteWriteCloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.done:
+	case <-timer.C:
+		p.cancel()
+		<-p.done
+	}
+	p.cancel()
+	return nil
+}
+
+type remoteWriteMetadata struct {
+	name       string
+	metricType models.MetricType
+	help       string
+	unit       string
+}
+
+type remoteWriteSeries struct {
+	labels  [][2]string // including __name__, sorted by name
+	samples []models.Metric
+}
+
+// remoteWriteBatch holds the samples of a WriteRequest, grouped by series
+type remoteWriteBatch struct {
+	series   []*remoteWriteSeries
+	index    map[string]*remoteWriteSeries // by labels signature
+	families []string
+	metadata []remoteWriteMetadata
+	samples  int
+}
+
+func newRemoteWriteBatch() *remoteWriteBatch {
+	return &remoteWriteBatch{
+		index: map[string]*remoteWriteSeries{},
+	}
+}
+
+func (b *remoteWriteBatch) Add(name string, family string, m models.Metric) {
+	labels := make([][2]string, 0, len(m.Labels)+1)
+	labels = append(labels, [2]string{"__name__", name})
+	for k, v := range m.Labels {
+		labels = append(labels, [2]string{k, v})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i][0] < labels[j][0]
+	})
+	signature := fmt.Sprint(labels)
+	series, found := b.index[signature]
+	if !found {
+		series = &remoteWriteSeries{labels: labels}
+		b.index[signature] = series
+		b.series = append(b.series, series)
+		b.addFamily(family)
+	}
+	series.samples = append(series.samples, m)
+	b.samples++
+}
+
+func (b *remoteWriteBatch) addFamily(name string) {
+	for _, family := range b.families {
+		if family == name {
+			return
+		}
+	}
+	b.families = append(b.families, name)
+}
+
+// remoteWriteMetricTypes are the values of the MetricMetadata.MetricType enum
+var remoteWriteMetricTypes = map[models.MetricType]uint64{
+	models.MetricTypeCounter:        1,
+	models.MetricTypeGauge:          2,
+	models.MetricTypeHistogram:      3,
+	models.MetricTypeGaugeHistogram: 4,
+	models.MetricTypeSummary:        5,
+	models.MetricTypeInfo:           6,
+	models.MetricTypeStateSet:       7,
+}
+
+// Encode returns the batch as a protobuf WriteRequest:
+//
+//	WriteRequest   { repeated TimeSeries timeseries = 1; repeated MetricMetadata metadata = 3; }
+//	TimeSeries     { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label          { string name = 1; string value = 2; }
+//	Sample         { double value = 1; int64 timestamp = 2; }
+//	MetricMetadata { MetricType type = 1; string metric_family_name = 2; string help = 4; string unit = 5; }
+func (b *remoteWriteBatch) Encode() []byte {
+	var request []byte
+	for _, series := range b.series {
+		sort.SliceStable(series.samples, func(i, j int) bool {
+			return series.samples[i].Timestamp.Before(series.samples[j].Timestamp)
+		})
+		var ts []byte
+		for _, label := range series.labels {
+			var l []byte
+			l = protowire.AppendTag(l, 1, protowire.BytesType)
+			l = protowire.AppendString(l, label[0])
+			l = protowire.AppendTag(l, 2, protowire.BytesType)
+			l = protowire.AppendString(l, label[1])
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		for _, sample := range series.samples {
+			var s []byte
+			s = protowire.AppendTag(s, 1, protowire.Fixed64Type)
+			s = protowire.AppendFixed64(s, math.Float64bits(sample.Value))
+			s = protowire.AppendTag(s, 2, protowire.VarintType)
+			s = protowire.AppendVarint(s, uint64(sample.Timestamp.UnixNano()/int64(time.Millisecond)))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, s)
+		}
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, ts)
+	}
+	for _, metadata := range b.metadata {
+		var m []byte
+		m = protowire.AppendTag(m, 1, protowire.VarintType)
+		m = protowire.AppendVarint(m, remoteWriteMetricTypes[metadata.metricType])
+		m = protowire.AppendTag(m, 2, protowire.BytesType)
+		m = protowire.AppendString(m, metadata.name)
+		if metadata.help != "" {
+			m = protowire.AppendTag(m, 4, protowire.BytesType)
+			m = protowire.AppendString(m, metadata.help)
+		}
+		if metadata.unit != "" {
+			m = protowire.AppendTag(m, 5, protowire.BytesType)
+			m = protowire.AppendString(m, metadata.unit)
+		}
+		request = protowire.AppendTag(request, 3, protowire.BytesType)
+		request = protowire.AppendBytes(request, m)
+	}
+	return request
+}
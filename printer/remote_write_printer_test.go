@@ -0,0 +1,266 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func Test_remoteWritePrinter(t *testing.T) {
+	receiver := newRemoteWriteReceiver(t)
+	defer receiver.Close()
+	// The first request fails, and is retried
+	receiver.statuses = []int{http.StatusServiceUnavailable}
+
+	p := newRemoteWritePrinter(configMock{
+		remoteWriteURL:       receiver.URL,
+		remoteWriteBatchSize: 3,
+		interval:             time.Hour,
+		metrics:              []string{"foo", "bar"},
+		retryPolicy:          provider.RetryPolicy{Retries: 1, RetryWait: time.Millisecond},
+	})
+	require.NoError(t, p.Print("# HELP foo Foo.\n# TYPE foo gauge\nfoo{a=\"1\"} 1 1606343802324\nfoo{a=\"2\"} 2 1606343802324\n"))
+	require.NoError(t, p.Print("baz 3 1606343802324\n"))
+	require.NoError(t, p.Print("foo{a=\"1\"} 4 1606343813456\n"))
+	require.NoError(t, p.Print("bar NaN 1606343813456\n"))
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, 3, receiver.attempts, "attempts")
+	assert.Equal(t, []string{
+		"foo{__name__=foo,a=1} 1@1606343802324 4@1606343813456\n" +
+			"foo{__name__=foo,a=2} 2@1606343802324\n" +
+			"metadata foo type=2 help=Foo.\n",
+		"bar{__name__=bar} NaN@1606343813456\n" +
+			"metadata bar type=0 help=\n",
+	}, receiver.requests)
+}
+
+func Test_remoteWritePrinter_rejected(t *testing.T) {
+	receiver := newRemoteWriteReceiver(t)
+	defer receiver.Close()
+	receiver.statuses = []int{http.StatusBadRequest}
+
+	p := newRemoteWritePrinter(configMock{
+		remoteWriteURL: receiver.URL,
+		retryPolicy:    provider.RetryPolicy{Retries: 1, RetryWait: time.Millisecond},
+	})
+	require.NoError(t, p.Print("foo 1 1606343802324\n"))
+	require.NoError(t, p.Close())
+	assert.Equal(t, 1, receiver.attempts, "rejected requests are not retried")
+	assert.Empty(t, receiver.requests)
+}
+
+func Test_remoteWritePrinter_histogram(t *testing.T) {
+	receiver := newRemoteWriteReceiver(t)
+	defer receiver.Close()
+
+	p := newRemoteWritePrinter(configMock{remoteWriteURL: receiver.URL, interval: time.Hour})
+	require.NoError(t, p.Print("# HELP latency Latency.\n# TYPE latency histogram\n"+
+		"latency_bucket{le=\"+Inf\"} 2 1606343802324\nlatency_sum 0.7 1606343802324\nlatency_count 2 1606343802324\n"))
+	require.NoError(t, p.Close())
+	assert.Equal(t, []string{
+		"latency_bucket{__name__=latency_bucket,le=+Inf} 2@1606343802324\n" +
+			"latency_count{__name__=latency_count} 2@1606343802324\n" +
+			"latency_sum{__name__=latency_sum} 0.7@1606343802324\n" +
+			"metadata latency type=3 help=Latency.\n",
+	}, receiver.requests, "the metadata is of the family, not of its series")
+}
+
+func Test_remoteWritePrinter_timeout(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	p := newRemoteWritePrinter(configMock{
+		remoteWriteURL: server.URL,
+		retryPolicy:    provider.RetryPolicy{Timeout: 10 * time.Millisecond},
+	})
+	require.NoError(t, p.Print("foo 1 1606343802324\n"))
+	closed := make(chan error)
+	go func() {
+		closed <- p.Close()
+	}()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the request was not bounded by the timeout")
+	}
+}
+
+func Test_remoteWritePrinter_tlsAndAuthorization(t *testing.T) {
+	receiver := newRemoteWriteReceiver(t)
+	defer receiver.Close()
+	server := httptest.NewTLSServer(receiver.Config.Handler)
+	defer server.Close()
+
+	p := newRemoteWritePrinter(configMock{
+		remoteWriteURL: server.URL,
+		httpClient:     server.Client(),
+		authenticator:  provider.AccessTokenAuthenticator{Token: provider.StaticSecret("abc")},
+	})
+	require.NoError(t, p.Print("foo 1 1606343802324\n"))
+	require.NoError(t, p.Close())
+	assert.Equal(t, []string{"Bearer abc"}, receiver.authorizations)
+	assert.Len(t, receiver.requests, 1)
+}
+
+func Test_remoteWritePrinter_closeTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { remoteWriteCloseTimeout = timeout }(remoteWriteCloseTimeout)
+	remoteWriteCloseTimeout = 10 * time.Millisecond
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	p := newRemoteWritePrinter(configMock{
+		remoteWriteURL: server.URL,
+		retryPolicy:    provider.RetryPolicy{Timeout: time.Hour},
+	})
+	require.NoError(t, p.Print("foo 1 1606343802324\n"))
+	closed := make(chan error)
+	go func() {
+		closed <- p.Close()
+	}()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "closing did not cancel the pending request")
+	}
+}
+
+// remoteWriteReceiver records the decoded requests it accepted, as text
+type remoteWriteReceiver struct {
+	*httptest.Server
+	statuses       []int // statuses to respond with before accepting requests
+	attempts       int
+	requests       []string
+	authorizations []string // the Authorization headers of the accepted requests
+	mu             sync.Mutex
+}
+
+func newRemoteWriteReceiver(t *testing.T) *remoteWriteReceiver {
+	r := &remoteWriteReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.attempts++
+		assert.Equal(t, "snappy", req.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", req.Header.Get("Content-Type"))
+		if len(r.statuses) > 0 {
+			w.WriteHeader(r.statuses[0])
+			r.statuses = r.statuses[1:]
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		request, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		r.requests = append(r.requests, decodeWriteRequest(t, request))
+		r.authorizations = append(r.authorizations, req.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return r
+}
+
+func decodeWriteRequest(t *testing.T, b []byte) string {
+	out := strings.Builder{}
+	forEachField(t, b, func(num protowire.Number, v []byte, _ uint64) {
+		switch num {
+		case 1:
+			var labels, samples []string
+			name := ""
+			forEachField(t, v, func(num protowire.Number, v []byte, _ uint64) {
+				switch num {
+				case 1:
+					var pair [2]string
+					forEachField(t, v, func(num protowire.Number, v []byte, _ uint64) {
+						pair[num-1] = string(v)
+					})
+					if pair[0] == "__name__" {
+						name = pair[1]
+					}
+					labels = append(labels, pair[0]+"="+pair[1])
+				case 2:
+					var value float64
+					var ts uint64
+					forEachField(t, v, func(num protowire.Number, _ []byte, n uint64) {
+						if num == 1 {
+							value = math.Float64frombits(n)
+						} else {
+							ts = n
+						}
+					})
+					samples = append(samples, fmt.Sprintf("%g@%d", value, ts))
+				}
+			})
+			sort.Strings(labels)
+			out.WriteString(fmt.Sprintf("%s{%s} %s\n", name, strings.Join(labels, ","), strings.Join(samples, " ")))
+		case 3:
+			var metricType uint64
+			var name, help string
+			forEachField(t, v, func(num protowire.Number, v []byte, n uint64) {
+				switch num {
+				case 1:
+					metricType = n
+				case 2:
+					name = string(v)
+				case 4:
+					help = string(v)
+				}
+			})
+			out.WriteString(fmt.Sprintf("metadata %s type=%d help=%s\n", name, metricType, help))
+		}
+	})
+	return out.String()
+}
+
+// forEachField calls the handler with the bytes of length-delimited fields, or the value of numeric fields
+func forEachField(t *testing.T, b []byte, handle func(num protowire.Number, v []byte, n uint64)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0, "tag")
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			require.GreaterOrEqual(t, n, 0, "bytes")
+			handle(num, v, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			require.GreaterOrEqual(t, n, 0, "varint")
+			handle(num, nil, v)
+			b = b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			require.GreaterOrEqual(t, n, 0, "fixed64")
+			handle(num, nil, v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+}
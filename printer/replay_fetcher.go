@@ -0,0 +1,90 @@
+package printer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/eldada/metrics-viewer/parser"
+	"github.com/eldada/metrics-viewer/provider"
+)
+
+// newReplayEntryFetcherWithContext replays the payloads of a recording made by the record command, at the given speed
+// relative to the recording. The entries are closed once all the payloads were replayed.
+func newReplayEntryFetcherWithContext(ctx context.Context, filename string, speed float64) (*replayEntryFetcher, error) {
+	records, err := provider.ReadRecords(filename)
+	if err != nil {
+		return nil, err
+	}
+	fetcher := replayEntryFetcher{
+		records:  records,
+		speed:    speed,
+		labelled: provider.HasMultipleSources(records),
+		entries:  make(chan string),
+		ctx:      ctx,
+	}
+	go fetcher.fetch()
+	return &fetcher, nil
+}
+
+type replayEntryFetcher struct {
+	records  []provider.Record
+	speed    float64
+	labelled bool // whether the entries are labeled with the recorded source name
+	entries  chan string
+	closed   bool
+	ctx      context.Context
+}
+
+func (f *replayEntryFetcher) fetch() {
+	defer close(f.entries)
+	start := time.Now()
+	entry := strings.Builder{}
+	for _, record := range f.records {
+		if f.closed {
+			return
+		}
+		sinceStart := time.Duration(float64(record.Time.Sub(f.records[0].Time)) / f.speed)
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-time.After(time.Until(start.Add(sinceStart))):
+		}
+		entry.Reset()
+		format := parser.FormatFromContentType(record.ContentType)
+		if format == parser.FormatUnknown {
+			format = parser.DetectFormat(record.Payload)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(record.Payload))
+		for scanner.Scan() {
+			txt := scanner.Text()
+			entry.WriteString(txt)
+			entry.WriteRune('\n')
+			if txt == "" || strings.HasPrefix(txt, "#") {
+				continue
+			}
+			// The samples keep the time they were recorded at, rather than being stamped when printed
+			value := parser.SetDefaultTimestamp(entry.String(), record.Time, format)
+			if f.labelled {
+				value = withInstanceLabel(value, record.Source)
+			}
+			select {
+			case <-f.ctx.Done():
+				return
+			case f.entries <- value:
+				entry.Reset()
+			}
+		}
+	}
+}
+
+func (f *replayEntryFetcher) Entries() <-chan string {
+	return f.entries
+}
+
+func (f *replayEntryFetcher) Close() error {
+	f.closed = true
+	return nil
+}
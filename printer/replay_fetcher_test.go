@@ -0,0 +1,49 @@
+package printer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_replayEntryFetcher(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "recording.gz")
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	w, err := provider.NewRecordWriter(f)
+	require.NoError(t, err)
+	t0 := time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	require.NoError(t, w.Write(provider.Record{Time: t0, Source: "node1", Payload: []byte("# TYPE foo gauge\nfoo 1\n")}))
+	require.NoError(t, w.Write(provider.Record{Time: t0.Add(time.Second), Source: "node2", Payload: []byte("foo 2\n")}))
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	fetcher, err := newReplayEntryFetcherWithContext(context.Background(), filename, 100)
+	require.NoError(t, err)
+	defer fetcher.Close()
+	var entries []string
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case entry, ok := <-fetcher.Entries():
+			if !ok {
+				done = true
+				break
+			}
+			entries = append(entries, entry)
+		case <-timeout:
+			t.Fatal("timed out waiting for the replay to end")
+		}
+	}
+	// The samples without a timestamp are stamped with the time they were recorded at
+	assert.Equal(t, []string{
+		"# TYPE foo gauge\nfoo{instance=\"node1\"} 1 1606343810000\n",
+		"foo{instance=\"node2\"} 2 1606343811000\n",
+	}, entries)
+}
@@ -0,0 +1,114 @@
+package printer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// newRotatedFileFetcherWithContext reads the entries of the archives in order, and then of the live file if set,
+// which is either followed or read to its end (see provider.Source NoFollow)
+func newRotatedFileFetcherWithContext(ctx context.Context, source provider.Source) (*rotatedFileFetcher, error) {
+	fetcher := rotatedFileFetcher{
+		entries: make(chan string),
+		ctx:     ctx,
+	}
+	for _, archive := range source.Archives {
+		fetcher.files = append(fetcher.files, func() (MetricEntryFetcher, error) {
+			return newFileEntryReaderWithContext(ctx, archive)
+		})
+	}
+	if source.File != "" {
+		fetcher.files = append(fetcher.files, func() (MetricEntryFetcher, error) {
+			if source.NoFollow {
+				return newFileEntryReaderWithContext(ctx, source.File)
+			}
+			return newFileOpenMetricEntryFetcherWithContext(ctx, source.File)
+		})
+	}
+	go fetcher.fetch()
+	return &fetcher, nil
+}
+
+type rotatedFileFetcher struct {
+	files   []func() (MetricEntryFetcher, error)
+	current MetricEntryFetcher
+	entries chan string
+	err     error // the first error which stopped reading any of the files
+	closed  bool
+	ctx     context.Context
+	mu      sync.Mutex
+}
+
+func (f *rotatedFileFetcher) fetch() {
+	defer close(f.entries)
+	for _, open := range f.files {
+		fetcher, err := f.open(open)
+		if err != nil {
+			f.fail(err)
+			continue
+		}
+		if fetcher == nil {
+			return
+		}
+		for entry := range fetcher.Entries() {
+			select {
+			case <-f.ctx.Done():
+				return
+			case f.entries <- entry:
+			}
+		}
+		if err := FetchErr(fetcher); err != nil {
+			f.fail(err)
+		}
+		_ = fetcher.Close()
+	}
+}
+
+// open opens the next file, unless the fetcher is closed
+func (f *rotatedFileFetcher) open(open func() (MetricEntryFetcher, error)) (MetricEntryFetcher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, nil
+	}
+	fetcher, err := open()
+	if err != nil {
+		return nil, err
+	}
+	f.current = fetcher
+	return fetcher, nil
+}
+
+// fail logs the error of a file, which does not stop reading the next files
+func (f *rotatedFileFetcher) fail(err error) {
+	log.Warn(err.Error())
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *rotatedFileFetcher) Entries() <-chan string {
+	return f.entries
+}
+
+// Err returns the first error which stopped reading any of the files
+func (f *rotatedFileFetcher) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *rotatedFileFetcher) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.current == nil {
+		return nil
+	}
+	return f.current.Close()
+}
@@ -0,0 +1,44 @@
+package printer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eldada/metrics-viewer/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rotatedFileFetcher(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "artifactory-metrics.1.log.gz")
+	b := bytes.Buffer{}
+	gz := gzip.NewWriter(&b)
+	_, _ = gz.Write([]byte("# TYPE foo gauge\nfoo 1 1606343802324\n"))
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(archive, b.Bytes(), 0644))
+	corrupt := filepath.Join(dir, "artifactory-metrics.2.log.gz")
+	require.NoError(t, os.WriteFile(corrupt, b.Bytes()[:b.Len()-10], 0644))
+	live := filepath.Join(dir, "artifactory-metrics.log")
+	require.NoError(t, os.WriteFile(live, []byte("foo 2 1606343813456\n"), 0644))
+
+	f, err := newRotatedFileFetcherWithContext(context.Background(), provider.Source{
+		File:     live,
+		Archives: []string{archive, corrupt},
+		NoFollow: true,
+	})
+	require.NoError(t, err)
+	defer f.Close()
+	s := strings.Builder{}
+	for entry := range f.Entries() {
+		s.WriteString(entry)
+	}
+	// The lines of the corrupt archive before the corruption are read as well
+	assert.Equal(t, "# TYPE foo gauge\nfoo 1 1606343802324\n# TYPE foo gauge\nfoo 1 1606343802324\nfoo 2 1606343813456\n", s.String())
+	assert.EqualError(t, FetchErr(f), "failed to read "+corrupt+"; cause: unexpected EOF")
+}
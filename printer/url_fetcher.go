@@ -48,7 +48,7 @@ func (f *urlOpenMetricsEntryFetcher) fetch() {
 			if f.closed {
 				return
 			}
-			data, err := f.urlMetricsFetcher.Get()
+			data, err := f.urlMetricsFetcher.Get(f.ctx)
 			if err != nil {
 				log.Error(err)
 				continue
@@ -1,6 +1,7 @@
 package printer
 
 import (
+	"context"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -53,7 +54,7 @@ type metricsFetcherMock struct {
 	counter int
 }
 
-func (f *metricsFetcherMock) Get() ([]byte, error) {
+func (f *metricsFetcherMock) Get(_ context.Context) ([]byte, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.counter++
@@ -0,0 +1,63 @@
+package provider
+
+import "math"
+
+// AggregateFunc defines how values of series collapsed into one (by ignoring labels) are combined per timestamp
+type AggregateFunc string
+
+const (
+	AggregateSum   AggregateFunc = "sum"
+	AggregateAvg   AggregateFunc = "avg"
+	AggregateMin   AggregateFunc = "min"
+	AggregateMax   AggregateFunc = "max"
+	AggregateCount AggregateFunc = "count"
+)
+
+var SupportedAggregateFuncs = map[string]AggregateFunc{
+	string(AggregateSum):   AggregateSum,
+	string(AggregateAvg):   AggregateAvg,
+	string(AggregateMin):   AggregateMin,
+	string(AggregateMax):   AggregateMax,
+	string(AggregateCount): AggregateCount,
+}
+
+// Aggregation accumulates values, to be combined using an AggregateFunc
+type Aggregation struct {
+	sum   float64
+	min   float64
+	max   float64
+	count int
+}
+
+func NewAggregation(values ...float64) *Aggregation {
+	a := &Aggregation{
+		min: math.Inf(+1),
+		max: math.Inf(-1),
+	}
+	for _, v := range values {
+		a.Add(v)
+	}
+	return a
+}
+
+func (a *Aggregation) Add(v float64) {
+	a.sum += v
+	a.min = math.Min(a.min, v)
+	a.max = math.Max(a.max, v)
+	a.count++
+}
+
+// Value returns the aggregated value using the given function, sum is used if the function is not set
+func (a *Aggregation) Value(f AggregateFunc) float64 {
+	switch f {
+	case AggregateAvg:
+		return a.sum / float64(a.count)
+	case AggregateMin:
+		return a.min
+	case AggregateMax:
+		return a.max
+	case AggregateCount:
+		return float64(a.count)
+	}
+	return a.sum
+}
@@ -0,0 +1,255 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Secret is a password or a token, which may change while running
+type Secret interface {
+	Value() (string, error)
+}
+
+// StaticSecret is a secret given on startup, e.g. by a flag or an environment variable
+type StaticSecret string
+
+func (s StaticSecret) Value() (string, error) {
+	return string(s), nil
+}
+
+// NewFileSecret creates a secret read from the file, which is read again whenever it is modified,
+// so a rotated secret is used without restarting
+func NewFileSecret(file string) *FileSecret {
+	return &FileSecret{file: file}
+}
+
+type FileSecret struct {
+	file    string
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+func (s *FileSecret) Value() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat, err := os.Stat(s.file)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret file %s; cause: %w", s.file, err)
+	}
+	if stat.ModTime().Equal(s.modTime) && stat.Size() == s.size {
+		return s.value, nil
+	}
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return "", fmt.Errorf("could not read secret file %s; cause: %w", s.file, err)
+	}
+	s.value = strings.TrimSpace(string(data))
+	s.modTime = stat.ModTime()
+	s.size = stat.Size()
+	return s.value, nil
+}
+
+// HeadersAuthenticator adds the headers to the requests, e.g. an api key required by a proxy
+type HeadersAuthenticator struct {
+	Headers http.Header
+}
+
+func (a HeadersAuthenticator) Authorize(req *http.Request) error {
+	for name, values := range a.Headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return nil
+}
+
+func (a HeadersAuthenticator) String() string {
+	names := make([]string, 0, len(a.Headers))
+	for name := range a.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("headers: %s", strings.Join(names, ","))
+}
+
+// Authenticators authorizes the requests by all the authenticators, in order
+type Authenticators []Authenticator
+
+func (a Authenticators) Authorize(req *http.Request) error {
+	for _, authenticator := range a {
+		if err := authenticator.Authorize(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a Authenticators) String() string {
+	s := make([]string, 0, len(a))
+	for _, authenticator := range a {
+		s = append(s, fmt.Sprint(authenticator))
+	}
+	return strings.Join(s, ", ")
+}
+
+// TokenRejecter is implemented by the authenticators which cache an access token, so a token which is rejected before
+// it expires, e.g. when it was revoked, is dropped and a new one is used
+type TokenRejecter interface {
+	// RejectToken drops the token the request was authorized with, and returns whether the request can be retried
+	RejectToken(req *http.Request) bool
+}
+
+func (a Authenticators) RejectToken(req *http.Request) bool {
+	rejected := false
+	for _, authenticator := range a {
+		if rejecter, ok := authenticator.(TokenRejecter); ok && rejecter.RejectToken(req) {
+			rejected = true
+		}
+	}
+	return rejected
+}
+
+// DoAuthorized sends the request authorized by the authenticator, if any. A request which is rejected as unauthorized
+// is sent once more if the authenticator dropped its token, and the body of the request can be sent again.
+func DoAuthorized(client *http.Client, authenticator Authenticator, req *http.Request) (*http.Response, error) {
+	if authenticator == nil {
+		return client.Do(req)
+	}
+	retry := req.Clone(req.Context())
+	if err := authenticator.Authorize(req); err != nil {
+		return nil, fmt.Errorf("failed to authorize the request; cause: %w", err)
+	}
+	res, err := client.Do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	rejecter, ok := authenticator.(TokenRejecter)
+	if !ok || (req.Body != nil && req.GetBody == nil) || !rejecter.RejectToken(req) {
+		return res, nil
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	if err := authenticator.Authorize(retry); err != nil {
+		return nil, fmt.Errorf("failed to authorize the request; cause: %w", err)
+	}
+	return client.Do(retry)
+}
+
+// oauth2ExpiryMargin is the time before the expiry of an access token at which it is refreshed,
+// so it does not expire while a request is sent. It is at most half of the lifetime of the token.
+const oauth2ExpiryMargin = 30 * time.Second
+
+// NewOAuth2Authenticator creates an authenticator getting access tokens from the token url using the OAuth2
+// client credentials grant. A token is reused until it is about to expire, and then a new one is requested.
+func NewOAuth2Authenticator(tokenUrl string, clientId string, clientSecret Secret, scopes []string, client *http.Client) *OAuth2Authenticator {
+	return &OAuth2Authenticator{
+		tokenUrl:     tokenUrl,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		client:       client,
+	}
+}
+
+type OAuth2Authenticator struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret Secret
+	scopes       []string
+	client       *http.Client
+	mu           sync.Mutex
+	token        string
+	expiry       time.Time // zero if the token does not expire
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (a *OAuth2Authenticator) Authorize(req *http.Request) error {
+	token, err := a.accessToken(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return nil
+}
+
+// accessToken returns the current token, requesting a new one within the context of the request if it expired
+func (a *OAuth2Authenticator) accessToken(req *http.Request) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && (a.expiry.IsZero() || now().Before(a.expiry)) {
+		return a.token, nil
+	}
+	clientSecret, err := a.clientSecret.Value()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.scopes) > 0 {
+		form.Set("scope", strings.Join(a.scopes, " "))
+	}
+	tokenReq, err := http.NewRequestWithContext(req.Context(), http.MethodPost, a.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tokenReq.SetBasicAuth(url.QueryEscape(a.clientId), url.QueryEscape(clientSecret))
+	requested := now()
+	res, err := a.client.Do(tokenReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to get an OAuth2 access token; cause: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get an OAuth2 access token; cause: %w", &StatusError{Status: res.Status, StatusCode: res.StatusCode})
+	}
+	var tokenRes oauth2TokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&tokenRes); err != nil {
+		return "", fmt.Errorf("failed to parse the OAuth2 token response; cause: %w", err)
+	}
+	if tokenRes.AccessToken == "" {
+		return "", fmt.Errorf("the OAuth2 token response has no access token")
+	}
+	a.token = tokenRes.AccessToken
+	a.expiry = time.Time{}
+	if tokenRes.ExpiresIn > 0 {
+		expiresIn := time.Duration(tokenRes.ExpiresIn) * time.Second
+		a.expiry = requested.Add(expiresIn - min(oauth2ExpiryMargin, expiresIn/2))
+	}
+	return a.token, nil
+}
+
+// RejectToken drops the current token if the request was authorized with it, so a new one is requested.
+// A request authorized with an older token can be retried with the current one.
+func (a *OAuth2Authenticator) RejectToken(req *http.Request) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && req.Header.Get("Authorization") == fmt.Sprintf("Bearer %s", a.token) {
+		a.token = ""
+	}
+	return true
+}
+
+func (a *OAuth2Authenticator) String() string {
+	return fmt.Sprintf("oauth2-client: %s", a.clientId)
+}
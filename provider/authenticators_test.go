@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(file, []byte("first\n"), 0600))
+	s := NewFileSecret(file)
+	value, err := s.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "first", value)
+
+	require.NoError(t, os.WriteFile(file, []byte("second-token\n"), 0600))
+	value, err = s.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "second-token", value, "reloaded")
+
+	require.NoError(t, os.Remove(file))
+	_, err = s.Value()
+	assert.EqualError(t, err, "could not read secret file "+file+"; cause: stat "+file+": no such file or directory")
+}
+
+func TestAuthenticators(t *testing.T) {
+	a := Authenticators{
+		HeadersAuthenticator{Headers: http.Header{"X-Api-Key": {"abc"}, "Authorization": {"overridden"}}},
+		AccessTokenAuthenticator{Token: StaticSecret("token")},
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+	require.NoError(t, err)
+	require.NoError(t, a.Authorize(req))
+	assert.Equal(t, "abc", req.Header.Get("X-Api-Key"))
+	assert.Equal(t, []string{"Bearer token"}, req.Header.Values("Authorization"))
+	assert.Equal(t, "headers: Authorization,X-Api-Key, token: *****", a.String())
+}
+
+func TestOAuth2Authenticator(t *testing.T) {
+	issued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok || clientId != "viewer" || clientSecret != "secret" || r.PostFormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "metrics read", r.PostFormValue("scope"), "scope")
+		issued++
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(oauth2TokenResponse{
+			AccessToken: []string{"", "token-1", "token-2"}[issued],
+			TokenType:   "Bearer",
+			ExpiresIn:   60,
+		})
+	}))
+	defer tokenServer.Close()
+	clock := time.Now()
+	nowFunc = func() time.Time { return clock }
+	defer func() { nowFunc = time.Now }()
+
+	authorization := func(a *OAuth2Authenticator) (string, error) {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+		require.NoError(t, err)
+		err = a.Authorize(req)
+		return req.Header.Get("Authorization"), err
+	}
+	a := NewOAuth2Authenticator(tokenServer.URL, "viewer", StaticSecret("secret"), []string{"metrics", "read"}, tokenServer.Client())
+	got, err := authorization(a)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-1", got)
+
+	// The token is reused until it is about to expire
+	clock = clock.Add(20 * time.Second)
+	got, err = authorization(a)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-1", got, "reused")
+	clock = clock.Add(20 * time.Second)
+	got, err = authorization(a)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token-2", got, "refreshed")
+	assert.Equal(t, 2, issued, "issued tokens")
+
+	a = NewOAuth2Authenticator(tokenServer.URL, "viewer", StaticSecret("wrong"), nil, tokenServer.Client())
+	_, err = authorization(a)
+	assert.EqualError(t, err, "failed to get an OAuth2 access token; cause: unexpected response status: 401 Unauthorized")
+}
+
+func TestOAuth2Authenticator_shortLivedTokens(t *testing.T) {
+	issued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		_ = json.NewEncoder(w).Encode(oauth2TokenResponse{AccessToken: fmt.Sprintf("token-%d", issued), ExpiresIn: 10})
+	}))
+	defer tokenServer.Close()
+	clock := time.Now()
+	nowFunc = func() time.Time { return clock }
+	defer func() { nowFunc = time.Now }()
+
+	a := NewOAuth2Authenticator(tokenServer.URL, "viewer", StaticSecret("secret"), nil, tokenServer.Client())
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/metrics", nil)
+	require.NoError(t, err)
+	require.NoError(t, a.Authorize(req))
+	// The expiry margin is capped at half of the lifetime of the token
+	clock = clock.Add(4 * time.Second)
+	require.NoError(t, a.Authorize(req))
+	assert.Equal(t, "Bearer token-1", req.Header.Get("Authorization"), "reused")
+	clock = clock.Add(2 * time.Second)
+	require.NoError(t, a.Authorize(req))
+	assert.Equal(t, "Bearer token-2", req.Header.Get("Authorization"), "refreshed")
+}
+
+func TestDoAuthorized(t *testing.T) {
+	issued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		_ = json.NewEncoder(w).Encode(oauth2TokenResponse{AccessToken: fmt.Sprintf("token-%d", issued), ExpiresIn: 3600})
+	}))
+	defer tokenServer.Close()
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, fmt.Sprintf("%s %s", r.Header.Get("Authorization"), body))
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			// The token was revoked before it expired
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	a := NewOAuth2Authenticator(tokenServer.URL, "viewer", StaticSecret("secret"), nil, tokenServer.Client())
+	post := func(authenticator Authenticator) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte("samples")))
+		require.NoError(t, err)
+		res, err := DoAuthorized(server.Client(), authenticator, req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, post(Authenticators{HeadersAuthenticator{}, a}), "retried with a new token")
+	assert.Equal(t, []string{"Bearer token-1 samples", "Bearer token-2 samples"}, received)
+
+	received = nil
+	assert.Equal(t, http.StatusOK, post(a), "the new token is reused")
+	assert.Equal(t, []string{"Bearer token-2 samples"}, received)
+
+	received = nil
+	assert.Equal(t, http.StatusUnauthorized, post(AccessTokenAuthenticator{Token: StaticSecret("token-1")}), "not retried")
+	assert.Equal(t, []string{"Bearer token-1 samples"}, received)
+}
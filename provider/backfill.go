@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/parser"
+)
+
+// Backfiller provides the metrics which were available before it started providing new ones, e.g. in its log file.
+// Backfill is called before the first Get, which then provides only the metrics added since.
+type Backfiller interface {
+	Backfill(since time.Time) ([]models.Metrics, error)
+}
+
+// formatDetectionSize is the size of the head of a file used for detecting its format
+const formatDetectionSize = 64 * 1024
+
+// Backfill reads the metrics since the given time from the end of the file, and then follows the file from its end.
+// The start of the metrics is found by a binary search of the sample timestamps, which are ordered in the log.
+func (p *fileProvider) Backfill(since time.Time) ([]models.Metrics, error) {
+	if p.lines != nil {
+		return nil, nil
+	}
+	f, err := os.Open(p.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	end := stat.Size()
+	head := make([]byte, min(end, formatDetectionSize))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil, err
+	}
+	if parser.DetectFormat(head) == parser.FormatOpenMetrics {
+		p.format = parser.FormatOpenMetrics
+	}
+
+	lo, hi := int64(0), end
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ts, ok := p.nextSampleTime(f, mid, end)
+		if ok && ts.Before(since) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	var metricsCollection []models.Metrics
+	r := linesFrom(f, lo, end)
+	b := bytes.NewBuffer([]byte{})
+	for {
+		text, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if text != "" {
+			metrics, parseErr := p.parseLine(b, strings.TrimRight(text, "\r\n"))
+			if parseErr != nil {
+				return nil, parseErr
+			}
+			metricsCollection = append(metricsCollection, metrics...)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err := p.follow(end); err != nil {
+		return nil, err
+	}
+	return filterSince(metricsCollection, since.Add(-time.Nanosecond)), nil
+}
+
+// nextSampleTime returns the timestamp of the first sample line starting at or after the offset
+func (p *fileProvider) nextSampleTime(f *os.File, offset int64, end int64) (time.Time, bool) {
+	r := linesFrom(f, offset, end)
+	for {
+		text, err := r.ReadString('\n')
+		text = strings.TrimRight(text, "\r\n")
+		if text != "" && !strings.HasPrefix(text, "#") {
+			metrics, parseErr := parser.ParseMetricsWithFormatAt(strings.NewReader(text+"\n"), p.format, time.Time{})
+			if parseErr == nil && len(metrics) > 0 && len(metrics[0].Metrics) > 0 {
+				ts := metrics[0].Metrics[0].Timestamp
+				// Samples without a timestamp are never before the backfill start
+				return ts, !ts.IsZero()
+			}
+		}
+		if err != nil {
+			return time.Time{}, false
+		}
+	}
+}
+
+// linesFrom returns a reader of the lines starting at or after the offset, up to the end
+func linesFrom(f *os.File, offset int64, end int64) *bufio.Reader {
+	if offset == 0 {
+		return bufio.NewReader(io.NewSectionReader(f, 0, end))
+	}
+	// Start from the previous byte, so a line starting exactly at the offset is not skipped as a partial line
+	r := bufio.NewReader(io.NewSectionReader(f, offset-1, end-offset+1))
+	_, _ = r.ReadString('\n')
+	return r
+}
+
+// Backfill gets the metrics of the sources which can be backfilled, labeling them with their source name
+func (p *multiProvider) Backfill(since time.Time) ([]models.Metrics, error) {
+	var metricsCollection []models.Metrics
+	for i, prov := range p.providers {
+		backfiller, ok := prov.(Backfiller)
+		if !ok {
+			continue
+		}
+		backfilled, err := backfiller.Backfill(since)
+		if err != nil {
+			return nil, err
+		}
+		metricsCollection = append(metricsCollection, withInstanceLabel(backfilled, p.names[i])...)
+	}
+	return metricsCollection, nil
+}
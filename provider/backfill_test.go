@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_fileProvider_Backfill(t *testing.T) {
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+	tests := []struct {
+		name   string
+		sample func(i int, ts time.Time) string
+	}{
+		{
+			name: "prometheus format",
+			sample: func(i int, ts time.Time) string {
+				return fmt.Sprintf("# HELP foo Foo\n# TYPE foo gauge\nfoo %d %d\n", i, ts.UnixMilli())
+			},
+		},
+		{
+			name: "open metrics format",
+			sample: func(i int, ts time.Time) string {
+				return fmt.Sprintf("# TYPE foo gauge\n# UNIT foo bytes\nfoo %d %.3f\n", i, float64(ts.UnixMilli())/1000)
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// A sample every 30 seconds for 10 minutes
+			filename := filepath.Join(t.TempDir(), "artifactory-metrics.log")
+			content := strings.Builder{}
+			for i := 0; i < 20; i++ {
+				content.WriteString(tc.sample(i, start.Add(time.Duration(i)*30*time.Second)))
+			}
+			require.NoError(t, os.WriteFile(filename, []byte(content.String()), 0644))
+
+			p, err := newFileProvider(filename, 100*time.Millisecond)
+			require.NoError(t, err)
+			defer p.Close()
+			metrics, err := p.Backfill(start.Add(8 * time.Minute))
+			require.NoError(t, err)
+			var backfilled []float64
+			for _, m := range metrics {
+				assert.Equal(t, models.MetricTypeGauge, m.Type, "type")
+				backfilled = append(backfilled, values(m.Metrics)...)
+			}
+			assert.Equal(t, []float64{16, 17, 18, 19}, backfilled, "backfilled values")
+			assert.True(t, start.Add(8*time.Minute).Equal(metrics[0].Metrics[0].Timestamp), "first timestamp")
+
+			// Only the metrics appended after the backfill are read by Get
+			f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+			require.NoError(t, err)
+			_, err = f.WriteString(tc.sample(20, start.Add(10*time.Minute)))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			var got []float64
+			assert.Eventually(t, func() bool {
+				metrics, err := p.Get(context.Background())
+				require.NoError(t, err)
+				for _, m := range metrics {
+					got = append(got, values(m.Metrics)...)
+				}
+				return len(got) > 0
+			}, time.Second, 10*time.Millisecond)
+			assert.Equal(t, []float64{20}, got, "followed values")
+		})
+	}
+}
+
+func values(metrics []models.Metric) []float64 {
+	var v []float64
+	for _, m := range metrics {
+		v = append(v, m.Value)
+	}
+	return v
+}
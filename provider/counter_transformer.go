@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/eldada/metrics-viewer/models"
+)
+
+// CounterMode defines how cumulative metrics (counters, histogram and summary sums and counts) are presented
+type CounterMode string
+
+const (
+	CounterModeRaw      CounterMode = "raw"      // the value as reported
+	CounterModeRate     CounterMode = "rate"     // per-second rate of increase
+	CounterModeIncrease CounterMode = "increase" // increase since the previous sample
+)
+
+var SupportedCounterModes = map[string]CounterMode{
+	string(CounterModeRaw):      CounterModeRaw,
+	string(CounterModeRate):     CounterModeRate,
+	string(CounterModeIncrease): CounterModeIncrease,
+}
+
+// next returns the mode following this one, used for cycling through the modes
+func (m CounterMode) next() CounterMode {
+	switch m {
+	case CounterModeRaw:
+		return CounterModeRate
+	case CounterModeRate:
+		return CounterModeIncrease
+	}
+	return CounterModeRaw
+}
+
+// CounterModeSwitcher is optionally implemented by a Provider which can switch the counter mode per metric
+type CounterModeSwitcher interface {
+	// CounterMode returns the counter mode of the metric, or false if it is not cumulative
+	CounterMode(name string) (CounterMode, bool)
+	// ToggleCounterMode switches the metric to the next counter mode, or returns false if it is not cumulative
+	ToggleCounterMode(name string) (CounterMode, bool)
+}
+
+func NewCounterTransformer(defaultMode CounterMode) *CounterTransformer {
+	return &CounterTransformer{
+		defaultMode: defaultMode,
+		modes:       make(map[string]CounterMode),
+		previous:    make(map[string]models.Metric),
+		cumulative:  make(map[string]bool),
+	}
+}
+
+// CounterTransformer converts cumulative metrics into rate or increase values.
+// It keeps the last raw sample of each metric, so consecutive calls are handled as one continuous stream.
+type CounterTransformer struct {
+	defaultMode CounterMode
+	modes       map[string]CounterMode // per metric overrides of the default mode
+	previous    map[string]models.Metric
+	cumulative  map[string]bool
+	mu          sync.Mutex
+}
+
+func (t *CounterTransformer) Transform(metricsCollection []models.Metrics) []models.Metrics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	newCollection := make([]models.Metrics, 0, len(metricsCollection))
+	for _, metrics := range metricsCollection {
+		if !IsCumulative(metrics) {
+			newCollection = append(newCollection, metrics)
+			continue
+		}
+		t.cumulative[metrics.Name] = true
+		mode := t.mode(metrics.Name)
+		if mode == CounterModeRaw {
+			for _, metric := range metrics.Metrics {
+				if prev, found := t.previous[metrics.Name]; !found || metric.Timestamp.After(prev.Timestamp) {
+					t.previous[metrics.Name] = metric
+				}
+			}
+			newCollection = append(newCollection, metrics)
+			continue
+		}
+		var transformed []models.Metric
+		for _, metric := range metrics.Metrics {
+			prev, found := t.previous[metrics.Name]
+			if found && !metric.Timestamp.After(prev.Timestamp) {
+				continue
+			}
+			t.previous[metrics.Name] = metric
+			if !found {
+				continue
+			}
+			delta := metric.Value - prev.Value
+			if delta < 0 {
+				// Counter reset, assume it started again from zero
+				delta = metric.Value
+			}
+			if mode == CounterModeRate {
+				delta = delta / metric.Timestamp.Sub(prev.Timestamp).Seconds()
+			}
+			metric.Value = delta
+			transformed = append(transformed, metric)
+		}
+		metrics.Metrics = transformed
+		newCollection = append(newCollection, metrics)
+	}
+	return newCollection
+}
+
+// Fresh returns a transformer with the same counter modes and no previous samples, to transform a separate stream
+func (t *CounterTransformer) Fresh() *CounterTransformer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fresh := NewCounterTransformer(t.defaultMode)
+	for name, mode := range t.modes {
+		fresh.modes[name] = mode
+	}
+	for name := range t.cumulative {
+		fresh.cumulative[name] = true
+	}
+	return fresh
+}
+
+func (t *CounterTransformer) mode(name string) CounterMode {
+	if mode, found := t.modes[name]; found {
+		return mode
+	}
+	return t.defaultMode
+}
+
+// Mode returns the counter mode of the metric, or false if the metric was not seen as cumulative
+func (t *CounterTransformer) Mode(name string) (CounterMode, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.cumulative[name] {
+		return "", false
+	}
+	return t.mode(name), true
+}
+
+// Toggle switches the metric to the next counter mode and returns it, or false if the metric was not seen as cumulative
+func (t *CounterTransformer) Toggle(name string) (CounterMode, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.cumulative[name] {
+		return "", false
+	}
+	mode := t.mode(name).next()
+	t.modes[name] = mode
+	return mode, true
+}
+
+// IsCumulative returns true if the metrics values only go up (except for resets)
+func IsCumulative(metrics models.Metrics) bool {
+	switch metrics.Type {
+	case models.MetricTypeCounter:
+		return true
+	case models.MetricTypeHistogram, models.MetricTypeSummary:
+		for _, suffix := range []string{"_bucket", "_count", "_sum"} {
+			if strings.HasSuffix(metrics.Key, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
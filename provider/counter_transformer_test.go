@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterTransformer_Transform(t *testing.T) {
+	ts := func(sec int64) time.Time {
+		return time.Unix(1606343800+sec, 0)
+	}
+	counter := func(values ...float64) models.Metrics {
+		metrics := models.Metrics{Key: "foo_total", Name: "foo_total", Type: models.MetricTypeCounter}
+		for i, v := range values {
+			metrics.Metrics = append(metrics.Metrics, models.Metric{Value: v, Timestamp: ts(int64(i * 5))})
+		}
+		return metrics
+	}
+	tests := []struct {
+		name     string
+		mode     CounterMode
+		input    models.Metrics
+		expected []float64
+	}{
+		{
+			name:     "raw",
+			mode:     CounterModeRaw,
+			input:    counter(10, 20, 45),
+			expected: []float64{10, 20, 45},
+		},
+		{
+			name:     "increase",
+			mode:     CounterModeIncrease,
+			input:    counter(10, 20, 45),
+			expected: []float64{10, 25},
+		},
+		{
+			name:     "rate",
+			mode:     CounterModeRate,
+			input:    counter(10, 20, 45),
+			expected: []float64{2, 5},
+		},
+		{
+			name:     "rate with counter reset",
+			mode:     CounterModeRate,
+			input:    counter(10, 20, 5, 15),
+			expected: []float64{2, 1, 2},
+		},
+		{
+			name: "gauge is not transformed",
+			mode: CounterModeRate,
+			input: models.Metrics{Key: "foo", Name: "foo", Type: models.MetricTypeGauge, Metrics: []models.Metric{
+				{Value: 10, Timestamp: ts(0)},
+				{Value: 5, Timestamp: ts(5)},
+			}},
+			expected: []float64{10, 5},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			transformer := NewCounterTransformer(tc.mode)
+			result := transformer.Transform([]models.Metrics{tc.input})
+			var actual []float64
+			for _, m := range result[0].Metrics {
+				actual = append(actual, m.Value)
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCounterTransformer_TransformAcrossCalls(t *testing.T) {
+	transformer := NewCounterTransformer(CounterModeIncrease)
+	first := transformer.Transform([]models.Metrics{{Key: "foo_total", Name: "foo_total", Type: models.MetricTypeCounter, Metrics: []models.Metric{
+		{Value: 10, Timestamp: time.Unix(100, 0)},
+	}}})
+	assert.Empty(t, first[0].Metrics, "first sample has no previous value")
+	second := transformer.Transform([]models.Metrics{{Key: "foo_total", Name: "foo_total", Type: models.MetricTypeCounter, Metrics: []models.Metric{
+		{Value: 10, Timestamp: time.Unix(100, 0)}, // already seen
+		{Value: 17, Timestamp: time.Unix(105, 0)},
+	}}})
+	if assert.Len(t, second[0].Metrics, 1) {
+		assert.Equal(t, 7.0, second[0].Metrics[0].Value)
+	}
+}
+
+func TestCounterTransformer_Toggle(t *testing.T) {
+	transformer := NewCounterTransformer(CounterModeRaw)
+	_, ok := transformer.Toggle("foo_total")
+	assert.False(t, ok, "unknown metric cannot be toggled")
+	transformer.Transform([]models.Metrics{
+		{Key: "foo_total", Name: "foo_total", Type: models.MetricTypeCounter},
+		{Key: "bar", Name: "bar", Type: models.MetricTypeGauge},
+	})
+	_, ok = transformer.Toggle("bar")
+	assert.False(t, ok, "gauge cannot be toggled")
+	for _, expected := range []CounterMode{CounterModeRate, CounterModeIncrease, CounterModeRaw} {
+		mode, ok := transformer.Toggle("foo_total")
+		assert.True(t, ok)
+		assert.Equal(t, expected, mode)
+	}
+	mode, ok := transformer.Mode("foo_total")
+	assert.True(t, ok)
+	assert.Equal(t, CounterModeRaw, mode)
+}
+
+func TestIsCumulative(t *testing.T) {
+	assert.True(t, IsCumulative(models.Metrics{Key: "foo_total", Type: models.MetricTypeCounter}))
+	assert.True(t, IsCumulative(models.Metrics{Key: "foo_seconds_bucket", Type: models.MetricTypeHistogram}))
+	assert.True(t, IsCumulative(models.Metrics{Key: "foo_seconds_count", Type: models.MetricTypeSummary}))
+	assert.False(t, IsCumulative(models.Metrics{Key: "foo_seconds", Type: models.MetricTypeSummary}))
+	assert.False(t, IsCumulative(models.Metrics{Key: "foo", Type: models.MetricTypeGauge}))
+	assert.False(t, IsCumulative(models.Metrics{Key: "foo_total", Type: models.MetricTypeUntyped}))
+}
@@ -0,0 +1,325 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+)
+
+// Storage persists metrics, so they outlive the in-memory cache
+type Storage interface {
+	Append(metricsCollection []models.Metrics) error
+	// Load returns the metrics with timestamps in the range [from, to]
+	Load(from, to time.Time) ([]models.Metrics, error)
+}
+
+// segmentDuration is the time span of the samples in each segment file
+const segmentDuration = time.Hour
+
+const seriesIndexFile = "series.ndjson"
+const segmentsDir = "segments"
+const segmentSuffix = ".ndjson"
+
+// NewDiskStorage opens (or creates) a storage in the given directory.
+//
+// Samples are appended to segment files, one per hour of sample timestamps, named by the segment start (Unix millis).
+// The series metadata (name, description, type and unit) is appended once to a series index, referenced by ID
+// from the samples. Both are append-only JSON lines, so multiple processes can share the same directory.
+// Created timestamps and exemplars are not stored.
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(filepath.Join(dir, segmentsDir), 0755); err != nil {
+		return nil, fmt.Errorf("could not create storage directory %s; cause: %w", dir, err)
+	}
+	s := &DiskStorage{
+		dir:    dir,
+		series: map[string]storedSeries{},
+	}
+	if err := s.loadSeriesIndex(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewDiskStorageWithRetention opens (or creates) a storage which deletes the segments older than the retention,
+// i.e. whose samples are all older than it, on opening and whenever a segment expires while appending
+func NewDiskStorageWithRetention(dir string, retention time.Duration) (*DiskStorage, error) {
+	s, err := NewDiskStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	s.retention = retention
+	if err := s.deleteExpiredSegments(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type DiskStorage struct {
+	dir           string
+	series        map[string]storedSeries // by ID
+	retention     time.Duration           // 0 keeps the segments forever
+	expiredBefore time.Time               // the segments ending before it were deleted
+	mu            sync.Mutex
+}
+
+type storedSeries struct {
+	ID          string            `json:"id"`
+	Key         string            `json:"key"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Type        models.MetricType `json:"type,omitempty"`
+	Unit        string            `json:"unit,omitempty"`
+}
+
+type storedSample struct {
+	Series    string            `json:"s"`
+	Timestamp int64             `json:"t"`           // Unix millis
+	Value     string            `json:"v"`           // as a string, since JSON has no NaN and Inf
+	Labels    map[string]string `json:"l,omitempty"` // the sample labels
+}
+
+func (s *DiskStorage) Append(metricsCollection []models.Metrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	newSeries := bytes.Buffer{}
+	segments := map[int64]*bytes.Buffer{}
+	for _, metrics := range metricsCollection {
+		id := seriesID(metrics.Name)
+		if _, found := s.series[id]; !found {
+			series := storedSeries{
+				ID:          id,
+				Key:         metrics.Key,
+				Name:        metrics.Name,
+				Description: metrics.Description,
+				Type:        metrics.Type,
+				Unit:        metrics.Unit,
+			}
+			if err := appendJSONLine(&newSeries, series); err != nil {
+				return err
+			}
+			s.series[id] = series
+		}
+		for _, metric := range metrics.Metrics {
+			segment := metric.Timestamp.Truncate(segmentDuration).UnixNano() / int64(time.Millisecond)
+			if segments[segment] == nil {
+				segments[segment] = &bytes.Buffer{}
+			}
+			sample := storedSample{
+				Series:    id,
+				Timestamp: metric.Timestamp.UnixNano() / int64(time.Millisecond),
+				Value:     strconv.FormatFloat(metric.Value, 'g', -1, 64),
+				Labels:    metric.Labels,
+			}
+			if err := appendJSONLine(segments[segment], sample); err != nil {
+				return err
+			}
+		}
+	}
+	// The series are written first, so samples never reference an unknown series
+	if newSeries.Len() > 0 {
+		if err := appendToFile(filepath.Join(s.dir, seriesIndexFile), newSeries.Bytes()); err != nil {
+			return err
+		}
+	}
+	for segment, data := range segments {
+		if err := appendToFile(s.segmentPath(segment), data.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.deleteExpiredSegments()
+}
+
+func (s *DiskStorage) Load(from, to time.Time) ([]models.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Other processes may have added series since the index was last read
+	if err := s.loadSeriesIndex(); err != nil {
+		return nil, err
+	}
+	segments, err := s.segmentsInRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	fromMillis := from.UnixNano() / int64(time.Millisecond)
+	toMillis := to.UnixNano() / int64(time.Millisecond)
+	metricsMap := map[string]*models.Metrics{}
+	seen := map[string]bool{} // samples appended by multiple processes are loaded once
+	for _, segment := range segments {
+		err := readJSONLines(s.segmentPath(segment), func(line []byte) {
+			sample := storedSample{}
+			if json.Unmarshal(line, &sample) != nil {
+				return
+			}
+			series, found := s.series[sample.Series]
+			if !found || sample.Timestamp < fromMillis || sample.Timestamp > toMillis {
+				return
+			}
+			value, err := strconv.ParseFloat(sample.Value, 64)
+			if err != nil {
+				return
+			}
+			signature := fmt.Sprintf("%s%s\xff%d", sample.Series, models.LabelsSignature(sample.Labels), sample.Timestamp)
+			if seen[signature] {
+				return
+			}
+			seen[signature] = true
+			metrics, found := metricsMap[series.ID]
+			if !found {
+				metrics = &models.Metrics{
+					Key:         series.Key,
+					Name:        series.Name,
+					Description: series.Description,
+					Type:        series.Type,
+					Unit:        series.Unit,
+				}
+				metricsMap[series.ID] = metrics
+			}
+			metrics.Metrics = append(metrics.Metrics, models.Metric{
+				Value:     value,
+				Labels:    sample.Labels,
+				Timestamp: time.Unix(0, sample.Timestamp*int64(time.Millisecond)).UTC(),
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	metricsCollection := make([]models.Metrics, 0, len(metricsMap))
+	for _, metrics := range metricsMap {
+		sort.SliceStable(metrics.Metrics, func(i, j int) bool {
+			return metrics.Metrics[i].Timestamp.Before(metrics.Metrics[j].Timestamp)
+		})
+		metricsCollection = append(metricsCollection, *metrics)
+	}
+	sort.Slice(metricsCollection, func(i, j int) bool {
+		return metricsCollection[i].Name < metricsCollection[j].Name
+	})
+	return metricsCollection, nil
+}
+
+func (s *DiskStorage) loadSeriesIndex() error {
+	return readJSONLines(filepath.Join(s.dir, seriesIndexFile), func(line []byte) {
+		series := storedSeries{}
+		if json.Unmarshal(line, &series) == nil && series.ID != "" {
+			s.series[series.ID] = series
+		}
+	})
+}
+
+// segmentsInRange returns the start times of the existing segments which may have samples in the range
+func (s *DiskStorage) segmentsInRange(from, to time.Time) ([]int64, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, segmentsDir))
+	if err != nil {
+		return nil, fmt.Errorf("could not list storage segments; cause: %w", err)
+	}
+	fromSegment := from.Truncate(segmentDuration).UnixNano() / int64(time.Millisecond)
+	toMillis := to.UnixNano() / int64(time.Millisecond)
+	var segments []int64
+	for _, entry := range entries {
+		segment, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), segmentSuffix), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), segmentSuffix) {
+			continue
+		}
+		if segment >= fromSegment && segment <= toMillis {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+	return segments, nil
+}
+
+// deleteExpiredSegments deletes the segments which ended before the retention, once per segment duration at most.
+// The series index is kept, as series are few compared to samples.
+func (s *DiskStorage) deleteExpiredSegments() error {
+	if s.retention <= 0 {
+		return nil
+	}
+	before := now().Add(-s.retention).Truncate(segmentDuration)
+	if !before.After(s.expiredBefore) {
+		return nil
+	}
+	// The segments ending at the latest at the start of the retention
+	expired, err := s.segmentsInRange(time.Unix(0, 0), before.Add(-segmentDuration))
+	if err != nil {
+		return err
+	}
+	for _, segment := range expired {
+		if err := os.Remove(s.segmentPath(segment)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not delete expired storage segment; cause: %w", err)
+		}
+	}
+	s.expiredBefore = before
+	return nil
+}
+
+func (s *DiskStorage) segmentPath(segment int64) string {
+	return filepath.Join(s.dir, segmentsDir, fmt.Sprintf("%d%s", segment, segmentSuffix))
+}
+
+// seriesID is derived from the name, so all processes sharing a storage agree on it
+func seriesID(name string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func appendJSONLine(b *bytes.Buffer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode stored metrics; cause: %w", err)
+	}
+	b.Write(data)
+	b.WriteByte('\n')
+	return nil
+}
+
+// appendToFile writes the data with a single write, so concurrent appends of other processes are not interleaved
+func appendToFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open storage file %s; cause: %w", path, err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write storage file %s; cause: %w", path, err)
+	}
+	return nil
+}
+
+// readJSONLines calls the handler for each line of the file. A missing file has no lines.
+func readJSONLines(path string, handle func(line []byte)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open storage file %s; cause: %w", path, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		// A partially written last line (e.g. after a crash) fails to decode and is skipped by the handler
+		handle(scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read storage file %s; cause: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStorage(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2020, 11, 25, 22, 59, 50, 0, time.UTC)
+	s, err := NewDiskStorage(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Append([]models.Metrics{
+		{
+			Key:         "foo",
+			Name:        "foo",
+			Description: "Foo",
+			Type:        models.MetricTypeCounter,
+			Unit:        "bytes",
+			Metrics: []models.Metric{
+				{Value: 1, Labels: map[string]string{"a": "1"}, Timestamp: t0},
+				{Value: 2, Labels: map[string]string{"a": "2"}, Timestamp: t0},
+			},
+		},
+	}))
+	// Crossing into the next segment
+	require.NoError(t, s.Append([]models.Metrics{
+		{
+			Key:         "foo",
+			Name:        "foo",
+			Description: "Foo",
+			Type:        models.MetricTypeCounter,
+			Unit:        "bytes",
+			Metrics: []models.Metric{
+				{Value: 3, Labels: map[string]string{"a": "1"}, Timestamp: t0.Add(20 * time.Second)},
+			},
+		},
+		{
+			Key:     "bar",
+			Name:    "bar",
+			Metrics: []models.Metric{{Value: math.NaN(), Timestamp: t0.Add(20 * time.Second)}},
+		},
+	}))
+	entries, err := os.ReadDir(filepath.Join(dir, segmentsDir))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "segments")
+
+	// Another storage sharing the directory sees the same data, and appending the same samples again does not duplicate them
+	other, err := NewDiskStorage(dir)
+	require.NoError(t, err)
+	require.NoError(t, other.Append([]models.Metrics{
+		{Key: "foo", Name: "foo", Metrics: []models.Metric{{Value: 1, Labels: map[string]string{"a": "1"}, Timestamp: t0}}},
+	}))
+
+	metricsCollection, err := s.Load(t0, t0.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, metricsCollection, 2)
+	bar, foo := metricsCollection[0], metricsCollection[1]
+	assert.Equal(t, "bar", bar.Name)
+	require.Len(t, bar.Metrics, 1)
+	assert.True(t, math.IsNaN(bar.Metrics[0].Value))
+	assert.Equal(t, models.Metrics{
+		Key:         "foo",
+		Name:        "foo",
+		Description: "Foo",
+		Type:        models.MetricTypeCounter,
+		Unit:        "bytes",
+		Metrics: []models.Metric{
+			{Value: 1, Labels: map[string]string{"a": "1"}, Timestamp: t0},
+			{Value: 2, Labels: map[string]string{"a": "2"}, Timestamp: t0},
+			{Value: 3, Labels: map[string]string{"a": "1"}, Timestamp: t0.Add(20 * time.Second)},
+		},
+	}, foo)
+
+	// Only the samples in the range are loaded
+	metricsCollection, err = other.Load(t0.Add(time.Second), t0.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, metricsCollection, 2)
+	assert.Equal(t, []models.Metric{
+		{Value: 3, Labels: map[string]string{"a": "1"}, Timestamp: t0.Add(20 * time.Second)},
+	}, metricsCollection[1].Metrics)
+}
+
+func TestDiskStorage_LoadSkipsPartialLines(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2020, 11, 25, 22, 0, 0, 0, time.UTC)
+	s, err := NewDiskStorage(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Append([]models.Metrics{
+		{Key: "foo", Name: "foo", Metrics: []models.Metric{{Value: 1, Timestamp: t0}}},
+	}))
+	segment := s.segmentPath(t0.UnixNano() / int64(time.Millisecond))
+	require.NoError(t, appendToFile(segment, []byte(`{"s":"`)))
+
+	metricsCollection, err := s.Load(t0, t0)
+	require.NoError(t, err)
+	require.Len(t, metricsCollection, 1)
+	assert.Len(t, metricsCollection[0].Metrics, 1)
+}
+
+func Test_storedProvider(t *testing.T) {
+	dir := t.TempDir()
+	nowFunc = func() time.Time {
+		return time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	}
+	defer func() { nowFunc = time.Now }()
+	storage, err := NewDiskStorage(dir)
+	require.NoError(t, err)
+	require.NoError(t, storage.Append([]models.Metrics{
+		{Key: "old", Name: "old", Metrics: []models.Metric{{Value: 1, Timestamp: now().Add(-time.Hour)}}},
+		{Key: "recent", Name: "recent", Metrics: []models.Metric{{Value: 2, Timestamp: now().Add(-time.Minute)}}},
+	}))
+
+	p := NewStoredProvider(staticProvider{
+		{Key: "foo", Name: "foo", Metrics: []models.Metric{{Value: 3, Timestamp: now()}}},
+	}, storage, 5*time.Minute)
+	names := func(metricsCollection []models.Metrics) []string {
+		var names []string
+		for _, metrics := range metricsCollection {
+			names = append(names, metrics.Name)
+		}
+		return names
+	}
+
+	metricsCollection, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recent", "foo"}, names(metricsCollection), "first get includes the history")
+	metricsCollection, err = p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, names(metricsCollection))
+
+	stored, err := storage.Load(now().Add(-time.Minute), now())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo", "recent"}, names(stored))
+
+	// Past time windows are queried from the storage
+	querier, ok := p.(RangeQuerier)
+	require.True(t, ok, "range querier")
+	past, err := querier.QueryRange(context.Background(), now().Add(-2*time.Hour), now().Add(-30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old"}, names(past))
+}
+
+func TestDiskStorageWithRetention(t *testing.T) {
+	dir := t.TempDir()
+	clock := time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	nowFunc = func() time.Time {
+		return clock
+	}
+	defer func() { nowFunc = time.Now }()
+	s, err := NewDiskStorage(dir)
+	require.NoError(t, err)
+	sample := func(name string, ts time.Time) []models.Metrics {
+		return []models.Metrics{{Key: name, Name: name, Metrics: []models.Metric{{Value: 1, Timestamp: ts}}}}
+	}
+	require.NoError(t, s.Append(sample("a", clock.Add(-3*time.Hour))))
+	require.NoError(t, s.Append(sample("b", clock.Add(-2*time.Hour))))
+	require.NoError(t, s.Append(sample("c", clock.Add(-time.Hour))))
+	names := func() []string {
+		metricsCollection, err := s.Load(clock.Add(-24*time.Hour), clock)
+		require.NoError(t, err)
+		var names []string
+		for _, metrics := range metricsCollection {
+			names = append(names, metrics.Name)
+		}
+		return names
+	}
+
+	// The segment of 19:00-20:00 is older than the retention, the one of 20:00-21:00 is partly within it
+	s, err = NewDiskStorageWithRetention(dir, 2*time.Hour+30*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, names(), "on opening")
+
+	clock = clock.Add(time.Hour)
+	require.NoError(t, s.Append(sample("d", clock)))
+	assert.Equal(t, []string{"c", "d"}, names(), "on appending")
+}
+
+type staticProvider []models.Metrics
+
+func (p staticProvider) Get(_ context.Context) ([]models.Metrics, error) {
+	return p, nil
+}
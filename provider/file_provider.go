@@ -1,39 +1,89 @@
 package provider
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/eldada/metrics-viewer/models"
 	"github.com/eldada/metrics-viewer/parser"
 	"github.com/hpcloud/tail"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
+// newFileProvider follows the file from its start, or from its end at the time of the backfill (see Backfill)
 func newFileProvider(file string, interval time.Duration) (*fileProvider, error) {
-	t, err := tail.TailFile(file, tail.Config{
-		Follow: true,
-		ReOpen: true,
-	})
-	if err != nil {
-		return nil, err
-	}
 	return &fileProvider{
+		file:     file,
 		interval: interval,
-		tail:     t,
 	}, nil
 }
 
+// newRotatedFileProvider reads the lines of the archives in order, and then follows the live file if set,
+// so the metrics of the rotated logs are available before the new ones
+func newRotatedFileProvider(archives []string, file string, interval time.Duration) (*fileProvider, error) {
+	p := &fileProvider{
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	if file != "" {
+		t, err := tail.TailFile(file, tail.Config{
+			Follow: true,
+			ReOpen: true,
+			Logger: tail.DiscardingLogger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		p.tail = t
+	}
+	lines := make(chan *tail.Line)
+	p.lines = lines
+	go p.feedLines(archives, lines)
+	return p, nil
+}
+
 type fileProvider struct {
+	file          string
 	interval      time.Duration
 	tail          *tail.Tail
+	lines         <-chan *tail.Line
+	stop          chan struct{}
+	stopOnce      sync.Once
 	stagedMetrics []models.Metrics
+	format        parser.Format // once the file is detected as OpenMetrics, keep parsing it as such
 }
 
 const maxBatchSize = 10240         // no real reason ...
 const maxBatchIntervalFactor = 0.9 // use up to 90% of an interval time to fetch and process records
 
-func (p *fileProvider) Get() ([]models.Metrics, error) {
-	r := bytes.NewReader([]byte{})
+// follow starts following the file from the offset
+func (p *fileProvider) follow(offset int64) error {
+	t, err := tail.TailFile(p.file, tail.Config{
+		Follow:   true,
+		ReOpen:   true,
+		Location: &tail.SeekInfo{Offset: offset, Whence: io.SeekStart},
+		Logger:   tail.DiscardingLogger, // the seek is logged otherwise, which garbles the viewer
+	})
+	if err != nil {
+		return err
+	}
+	p.tail = t
+	p.lines = t.Lines
+	return nil
+}
+
+func (p *fileProvider) Get(ctx context.Context) ([]models.Metrics, error) {
+	if p.lines == nil {
+		if err := p.follow(0); err != nil {
+			return nil, err
+		}
+	}
 	b := bytes.NewBuffer([]byte{})
 	start := now()
 	maxBatchIntervalDuration := time.Duration(float64(p.interval) * maxBatchIntervalFactor)
@@ -41,26 +91,25 @@ func (p *fileProvider) Get() ([]models.Metrics, error) {
 	noLinesCounter := 0
 	for {
 		select {
-		case line, ok := <-p.tail.Lines:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case line, ok := <-p.lines:
 			if !ok {
-				// channel is closed
-				break
+				// The lines were all read, e.g. of archives without a live file, so only the staged metrics are left
+				p.stagedMetrics = nil
+				return metricsCollection, nil
 			}
 			if line == nil {
 				continue
 			}
 			noLinesCounter = 0
-			b.WriteString(line.Text)
-			b.WriteRune('\n')
-			if strings.HasPrefix(line.Text, "#") || line.Text == "" {
-				continue
-			}
-			r.Reset(b.Bytes())
-			metrics, err := parser.ParseMetrics(r)
+			metrics, err := p.parseLine(b, line.Text)
 			if err != nil {
 				return nil, err
 			}
-			b.Reset()
+			if metrics == nil {
+				continue
+			}
 			metricsCollection = append(metricsCollection, metrics...)
 			p.stagedMetrics = metricsCollection
 		default:
@@ -82,6 +131,77 @@ func (p *fileProvider) Get() ([]models.Metrics, error) {
 	return metricsCollection, nil
 }
 
+// parseLine adds the line to the entry in the buffer, and parses the entry once it is complete, i.e. ends with a sample.
+// It returns nil while the entry is not complete.
+func (p *fileProvider) parseLine(b *bytes.Buffer, text string) ([]models.Metrics, error) {
+	b.WriteString(text)
+	b.WriteRune('\n')
+	if strings.HasPrefix(text, "#") || text == "" {
+		return nil, nil
+	}
+	if p.format == parser.FormatUnknown && parser.DetectFormat(b.Bytes()) == parser.FormatOpenMetrics {
+		p.format = parser.FormatOpenMetrics
+	}
+	metrics, err := parser.ParseMetricsWithFormat(bytes.NewReader(b.Bytes()), p.format)
+	b.Reset()
+	if err != nil {
+		return nil, err
+	}
+	if metrics == nil {
+		metrics = []models.Metrics{}
+	}
+	return metrics, nil
+}
+
+// feedLines sends the lines of the archives, and then the lines of the live file
+func (p *fileProvider) feedLines(archives []string, lines chan<- *tail.Line) {
+	defer close(lines)
+	send := func(line *tail.Line) bool {
+		select {
+		case <-p.stop:
+			return false
+		case lines <- line:
+			return true
+		}
+	}
+	for _, archive := range archives {
+		f, err := OpenLogFile(archive)
+		if err != nil {
+			log.Warn(fmt.Sprintf("failed to read %s; cause: %s", archive, err))
+			continue
+		}
+		r := bufio.NewReader(f)
+		for {
+			text, err := r.ReadString('\n')
+			if text != "" && !send(&tail.Line{Text: strings.TrimRight(text, "\r\n")}) {
+				_ = f.Close()
+				return
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					log.Warn(fmt.Sprintf("failed to read %s; cause: %s", archive, err))
+				}
+				break
+			}
+		}
+		_ = f.Close()
+	}
+	if p.tail == nil {
+		return
+	}
+	for line := range p.tail.Lines {
+		if !send(line) {
+			return
+		}
+	}
+}
+
 func (p *fileProvider) Close() error {
+	if p.stop != nil {
+		p.stopOnce.Do(func() { close(p.stop) })
+	}
+	if p.tail == nil {
+		return nil
+	}
 	return p.tail.Stop()
 }
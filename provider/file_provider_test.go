@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -13,7 +14,7 @@ func Test_fileProvider(t *testing.T) {
 	p, err := newFileProvider("testdata/metrics1.log", 100*time.Millisecond)
 	require.NoError(t, err)
 	defer p.Close()
-	metrics, err := p.Get()
+	metrics, err := p.Get(context.Background())
 	require.NoError(t, err)
 	actual := metricsToString(metrics)
 	expected, _ := os.ReadFile("testdata/metrics1.txt")
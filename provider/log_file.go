@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eldada/metrics-viewer/parser"
+	"github.com/klauspost/compress/zstd"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// OpenLogFile opens a metrics log file for reading from its start, decompressing it if it is a gzip or zstd archive
+// (e.g. a rotated artifactory-metrics.log.gz). Archives are detected by their content rather than their name.
+func OpenLogFile(filename string) (io.ReadCloser, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to read the gzip archive %s; cause: %w", filename, err)
+		}
+		return &logFile{Reader: gz, file: f}, nil
+	case bytes.Equal(magic, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to read the zstd archive %s; cause: %w", filename, err)
+		}
+		return &logFile{Reader: zr, file: f, closeReader: zr.Close}, nil
+	}
+	return &logFile{Reader: r, file: f}, nil
+}
+
+type logFile struct {
+	io.Reader
+	file        *os.File
+	closeReader func()
+}
+
+func (f *logFile) Close() error {
+	if f.closeReader != nil {
+		f.closeReader()
+	}
+	return f.file.Close()
+}
+
+// IsLogFilesPattern returns whether the file name is a glob of rotated log files, e.g. artifactory-metrics*.log*
+func IsLogFilesPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// RotatedLogFiles returns the files matching the glob as the archives, ordered by the timestamp of their first sample,
+// and the live file, which is the most recently modified file that is not compressed. The live file is empty if all
+// the matching files are compressed.
+func RotatedLogFiles(pattern string) ([]string, string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid file pattern %s; cause: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, "", fmt.Errorf("no files match %s", pattern)
+	}
+	type logFileInfo struct {
+		name       string
+		compressed bool
+		modTime    time.Time
+		start      time.Time
+	}
+	var files []logFileInfo
+	live := -1
+	for _, name := range matches {
+		stat, err := os.Stat(name)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not open file %s: %w", name, err)
+		}
+		if stat.IsDir() {
+			continue
+		}
+		compressed, err := isCompressed(name)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not open file %s: %w", name, err)
+		}
+		files = append(files, logFileInfo{name: name, compressed: compressed, modTime: stat.ModTime()})
+		i := len(files) - 1
+		if !compressed && (live < 0 || stat.ModTime().After(files[live].modTime)) {
+			live = i
+		}
+	}
+	var archives []logFileInfo
+	for i, f := range files {
+		if i == live {
+			continue
+		}
+		f.start = firstSampleTime(f.name, f.modTime)
+		archives = append(archives, f)
+	}
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].start.Before(archives[j].start)
+	})
+	names := make([]string, 0, len(archives))
+	for _, f := range archives {
+		names = append(names, f.name)
+	}
+	if live < 0 {
+		return names, "", nil
+	}
+	return names, files[live].name, nil
+}
+
+func isCompressed(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(zstdMagic))
+	n, _ := io.ReadFull(f, magic)
+	return bytes.HasPrefix(magic[:n], gzipMagic) || bytes.Equal(magic[:n], zstdMagic), nil
+}
+
+// firstSampleTime returns the timestamp of the first sample of the file, or the default if it has no timestamped sample
+func firstSampleTime(filename string, defaultTime time.Time) time.Time {
+	f, err := OpenLogFile(filename)
+	if err != nil {
+		return defaultTime
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		metrics, err := parser.ParseMetricsAt(strings.NewReader(line), time.Time{})
+		if err != nil || len(metrics) == 0 || len(metrics[0].Metrics) == 0 || metrics[0].Metrics[0].Timestamp.IsZero() {
+			return defaultTime
+		}
+		return metrics[0].Metrics[0].Timestamp
+	}
+	return defaultTime
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRotatedLogFiles writes a set of rotated log files, with names and modification times not in the order of their samples
+func writeRotatedLogFiles(t *testing.T) string {
+	dir := t.TempDir()
+	writeLogFile(t, filepath.Join(dir, "artifactory-metrics.log.1"), []byte("# TYPE a gauge\na 1 1606343802324\n"), time.Hour)
+	writeLogFile(t, filepath.Join(dir, "artifactory-metrics.b.log.gz"), gzipped(t, "b 2 1606343813456\n"), 3*time.Hour)
+	writeLogFile(t, filepath.Join(dir, "artifactory-metrics.a.log.zst"), zstdCompressed(t, "c 3 1606343834567\n"), 2*time.Hour)
+	writeLogFile(t, filepath.Join(dir, "artifactory-metrics.log"), []byte("d 4 1606343845678\n"), 0)
+	return dir
+}
+
+func writeLogFile(t *testing.T, filename string, content []byte, age time.Duration) {
+	require.NoError(t, os.WriteFile(filename, content, 0644))
+	modTime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(filename, modTime, modTime))
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	b := bytes.Buffer{}
+	w := gzip.NewWriter(&b)
+	_, err := w.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func zstdCompressed(t *testing.T, s string) []byte {
+	b := bytes.Buffer{}
+	w, err := zstd.NewWriter(&b)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func TestOpenLogFile(t *testing.T) {
+	dir := writeRotatedLogFiles(t)
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{file: "artifactory-metrics.log", expected: "d 4 1606343845678\n"},
+		{file: "artifactory-metrics.b.log.gz", expected: "b 2 1606343813456\n"},
+		{file: "artifactory-metrics.a.log.zst", expected: "c 3 1606343834567\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			f, err := OpenLogFile(filepath.Join(dir, tc.file))
+			require.NoError(t, err)
+			defer f.Close()
+			content, err := io.ReadAll(f)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(content))
+		})
+	}
+}
+
+func TestRotatedLogFiles(t *testing.T) {
+	dir := writeRotatedLogFiles(t)
+	archives, live, err := RotatedLogFiles(filepath.Join(dir, "artifactory-metrics*.log*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "artifactory-metrics.log.1"),
+		filepath.Join(dir, "artifactory-metrics.b.log.gz"),
+		filepath.Join(dir, "artifactory-metrics.a.log.zst"),
+	}, archives, "archives")
+	assert.Equal(t, filepath.Join(dir, "artifactory-metrics.log"), live, "live")
+
+	archives, live, err = RotatedLogFiles(filepath.Join(dir, "*.gz"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "artifactory-metrics.b.log.gz")}, archives, "archives only")
+	assert.Equal(t, "", live, "no live file")
+
+	_, _, err = RotatedLogFiles(filepath.Join(dir, "*.bz2"))
+	assert.EqualError(t, err, "no files match "+filepath.Join(dir, "*.bz2"))
+}
+
+func Test_rotatedFileProvider(t *testing.T) {
+	dir := writeRotatedLogFiles(t)
+	archives, live, err := RotatedLogFiles(filepath.Join(dir, "artifactory-metrics*.log*"))
+	require.NoError(t, err)
+	p, err := newRotatedFileProvider(archives, live, 100*time.Millisecond)
+	require.NoError(t, err)
+	defer p.Close()
+	metrics, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, `a:
+  2020-11-25T22:36:42.324 1.000
+b:
+  2020-11-25T22:36:53.456 2.000
+c:
+  2020-11-25T22:37:14.567 3.000
+d:
+  2020-11-25T22:37:25.678 4.000
+`, metricsToString(metrics))
+}
+
+func Test_rotatedFileProvider_archivesOnly(t *testing.T) {
+	dir := writeRotatedLogFiles(t)
+	archives, live, err := RotatedLogFiles(filepath.Join(dir, "*.gz"))
+	require.NoError(t, err)
+	p, err := newRotatedFileProvider(archives, live, time.Minute)
+	require.NoError(t, err)
+	defer p.Close()
+	start := time.Now()
+	metrics, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "b:\n  2020-11-25T22:36:53.456 2.000\n", metricsToString(metrics))
+	metrics, err = p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+	assert.Less(t, time.Since(start), time.Second, "the metrics are returned once the archives were read, without waiting for the interval")
+}
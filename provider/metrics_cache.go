@@ -2,21 +2,32 @@ package provider
 
 import (
 	"github.com/eldada/metrics-viewer/models"
+	"sync"
 	"time"
 )
 
 func NewMetricsCache(timeWindow time.Duration) *MetricsCache {
+	return NewMetricsCacheWithClock(timeWindow, now)
+}
+
+// NewMetricsCacheWithClock creates a cache whose time window ends at the time of the given clock, e.g. of a replay
+func NewMetricsCacheWithClock(timeWindow time.Duration, clock func() time.Time) *MetricsCache {
 	return &MetricsCache{
 		timeWindow: timeWindow,
+		clock:      clock,
 	}
 }
 
 type MetricsCache struct {
 	timeWindow        time.Duration
+	clock             func() time.Time
 	metricsCollection []models.Metrics
+	mu                sync.Mutex
 }
 
 func (m *MetricsCache) Add(metricsCollection []models.Metrics) []models.Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	metricsMap := make(map[string]models.Metrics, len(metricsCollection))
 	for _, m := range metricsCollection {
 		metricsMap[m.Name] = m
@@ -33,13 +44,16 @@ func (m *MetricsCache) Add(metricsCollection []models.Metrics) []models.Metrics
 	for _, m := range metricsMap {
 		newCollection = append(newCollection, m)
 	}
-	newCollection = filterByTimeWindow(newCollection, m.timeWindow)
+	newCollection = filterSince(newCollection, m.clock().UTC().Add(-m.timeWindow))
 	m.metricsCollection = newCollection
 	return newCollection
 }
 
 func filterByTimeWindow(metricsCollection []models.Metrics, window time.Duration) []models.Metrics {
-	startFrom := now().UTC().Add(window * time.Duration(-1))
+	return filterSince(metricsCollection, now().UTC().Add(window*time.Duration(-1)))
+}
+
+func filterSince(metricsCollection []models.Metrics, startFrom time.Time) []models.Metrics {
 	var newCollection []models.Metrics
 	for _, metrics := range metricsCollection {
 		var filtered []models.Metric
@@ -53,3 +67,16 @@ func filterByTimeWindow(metricsCollection []models.Metrics, window time.Duration
 	}
 	return newCollection
 }
+
+// Remove drops all the cached values of the given metrics
+func (m *MetricsCache) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var newCollection []models.Metrics
+	for _, metrics := range m.metricsCollection {
+		if metrics.Name != name {
+			newCollection = append(newCollection, metrics)
+		}
+	}
+	m.metricsCollection = newCollection
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/eldada/metrics-viewer/parser"
+	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
+)
+
+// ProductLabel is the label holding the JFrog product, added to the metrics of the products scraped from a server
+const ProductLabel = "product"
+
+// Product is a JFrog product of a server, serving its metrics at its own endpoint
+type Product string
+
+const (
+	ProductArtifactory  Product = "artifactory"
+	ProductXray         Product = "xray"
+	ProductDistribution Product = "distribution"
+	ProductAccess       Product = "access"
+)
+
+var SupportedProducts = map[string]Product{
+	string(ProductArtifactory):  ProductArtifactory,
+	string(ProductXray):         ProductXray,
+	string(ProductDistribution): ProductDistribution,
+	string(ProductAccess):       ProductAccess,
+}
+
+// metricsUrl returns the metrics endpoint of the product in the server configuration.
+// A product without its own url is assumed to be served under the platform url, e.g. <url>/xray/.
+func (p Product) metricsUrl(details *config.ServerDetails) (string, error) {
+	var productUrl string
+	switch p {
+	case ProductArtifactory:
+		productUrl = details.ArtifactoryUrl
+	case ProductXray:
+		productUrl = details.XrayUrl
+	case ProductDistribution:
+		productUrl = details.DistributionUrl
+	case ProductAccess:
+		productUrl = details.AccessUrl
+	default:
+		return "", fmt.Errorf("unknown product: %s", p)
+	}
+	if productUrl == "" && details.Url != "" {
+		productUrl = strings.TrimSuffix(details.Url, "/") + "/" + string(p)
+	}
+	if productUrl == "" {
+		return "", fmt.Errorf("no %s url in the configuration of server %s", p, details.ServerId)
+	}
+	return fmt.Sprintf("%s/api/v1/metrics", strings.TrimSuffix(productUrl, "/")), nil
+}
+
+// NewProductMetricsFetcher creates a fetcher of the metrics of a product of the server, labeling them with the product
+func NewProductMetricsFetcher(details *config.ServerDetails, product Product, retryPolicy RetryPolicy) (UrlMetricsFetcher, error) {
+	url, err := product.metricsUrl(details)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, err := newJFrogMetricsFetcher(details, url, retryPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &labeledMetricsFetcher{fetcher: fetcher, name: ProductLabel, value: string(product)}, nil
+}
+
+// labeledMetricsFetcher sets a label on all the samples of the payloads of a fetcher
+type labeledMetricsFetcher struct {
+	fetcher UrlMetricsFetcher
+	name    string
+	value   string
+}
+
+func (f *labeledMetricsFetcher) Get(ctx context.Context) ([]byte, error) {
+	data, err := f.fetcher.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(parser.SetLabel(string(data), f.name, f.value)), nil
+}
+
+func (f *labeledMetricsFetcher) ContentType() string {
+	if contentTypeAware, ok := f.fetcher.(ContentTypeAware); ok {
+		return contentTypeAware.ContentType()
+	}
+	return ""
+}
+
+func (f *labeledMetricsFetcher) String() string {
+	return fmt.Sprintf("%s, %s: %s", f.fetcher, f.name, f.value)
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProduct_metricsUrl(t *testing.T) {
+	details := &config.ServerDetails{
+		ServerId:       "art17",
+		Url:            "https://acme.jfrog.io/",
+		ArtifactoryUrl: "https://acme.jfrog.io/artifactory/",
+		XrayUrl:        "https://xray.acme.io",
+	}
+	tests := []struct {
+		name    string
+		details *config.ServerDetails
+		product Product
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "artifactory",
+			details: details,
+			product: ProductArtifactory,
+			want:    "https://acme.jfrog.io/artifactory/api/v1/metrics",
+		},
+		{
+			name:    "product url",
+			details: details,
+			product: ProductXray,
+			want:    "https://xray.acme.io/api/v1/metrics",
+		},
+		{
+			name:    "platform url",
+			details: details,
+			product: ProductAccess,
+			want:    "https://acme.jfrog.io/access/api/v1/metrics",
+		},
+		{
+			name:    "no url",
+			details: &config.ServerDetails{ServerId: "art17", ArtifactoryUrl: "https://acme.jfrog.io/artifactory/"},
+			product: ProductDistribution,
+			wantErr: "no distribution url in the configuration of server art17",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.product.metricsUrl(tc.details)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNewProductMetricsFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xray/api/v1/metrics" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte("# TYPE jfxr_db_sync_running_total gauge\njfxr_db_sync_running_total 1\nsys_cpu_ratio{product=\"other\"} 0.5\n"))
+	}))
+	defer server.Close()
+
+	fetcher, err := NewProductMetricsFetcher(&config.ServerDetails{
+		ServerId:       "art17",
+		Url:            server.URL,
+		ArtifactoryUrl: server.URL + "/artifactory",
+		AccessToken:    "secret",
+	}, ProductXray, testRetryPolicy)
+	require.NoError(t, err)
+	data, err := fetcher.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "# TYPE jfxr_db_sync_running_total gauge\njfxr_db_sync_running_total{product=\"xray\"} 1\nsys_cpu_ratio{product=\"xray\"} 0.5\n", string(data))
+	assert.Equal(t, "text/plain; version=0.0.4", fetcher.(ContentTypeAware).ContentType())
+}
@@ -0,0 +1,250 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+)
+
+// prometheusMaxPoints is the maximum number of points per series that Prometheus returns for a range query
+const prometheusMaxPoints = 11000
+
+// prometheusLookback is the default staleness lookback of Prometheus, within which a series is considered present
+const prometheusLookback = 5 * time.Minute
+
+// NewPrometheusAPI creates a client of a Prometheus compatible HTTP API, e.g. of Prometheus, Thanos or Mimir,
+// querying the series matching the selector
+func NewPrometheusAPI(url string, match string, client *http.Client, authenticator Authenticator, retryPolicy RetryPolicy) *PrometheusAPI {
+	return &PrometheusAPI{
+		url:           strings.TrimSuffix(url, "/"),
+		match:         match,
+		client:        client,
+		authenticator: authenticator,
+		retryPolicy:   retryPolicy,
+	}
+}
+
+type PrometheusAPI struct {
+	url           string
+	match         string
+	client        *http.Client
+	authenticator Authenticator
+	retryPolicy   RetryPolicy
+}
+
+func (a *PrometheusAPI) String() string {
+	if a.authenticator == nil {
+		return fmt.Sprintf("prometheus: %s, match: %s", a.url, a.match)
+	}
+	return fmt.Sprintf("prometheus: %s, match: %s, auth-by-%s", a.url, a.match, a.authenticator)
+}
+
+type prometheusResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+type prometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]any          `json:"values"`
+}
+
+type prometheusMatrix struct {
+	ResultType string             `json:"resultType"`
+	Result     []prometheusSeries `json:"result"`
+}
+
+// Series returns the labels of the series matching the selector in the time range
+func (a *PrometheusAPI) Series(ctx context.Context, start time.Time, end time.Time) ([]map[string]string, error) {
+	var series []map[string]string
+	err := a.get(ctx, "/api/v1/series", url.Values{
+		"match[]": {a.match},
+		"start":   {formatPrometheusTime(start)},
+		"end":     {formatPrometheusTime(end)},
+	}, &series)
+	return series, err
+}
+
+// QueryRange returns the samples of the series matching the selector in the time range, at every step
+func (a *PrometheusAPI) QueryRange(ctx context.Context, start time.Time, end time.Time, step time.Duration) ([]models.Metrics, error) {
+	var matrix prometheusMatrix
+	err := a.get(ctx, "/api/v1/query_range", url.Values{
+		"query": {a.match},
+		"start": {formatPrometheusTime(start)},
+		"end":   {formatPrometheusTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}, &matrix)
+	if err != nil {
+		return nil, err
+	}
+	if matrix.ResultType != "matrix" {
+		return nil, fmt.Errorf("unexpected result type of range query: %s", matrix.ResultType)
+	}
+	return matrixToMetrics(matrix.Result)
+}
+
+// get sends the request to the API, and unmarshals the data of a successful response
+func (a *PrometheusAPI) get(ctx context.Context, path string, params url.Values, data any) error {
+	body, err := a.retryPolicy.Do(ctx, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url+path+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := DoAuthorized(a.client, a.authenticator, req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			statusErr := &StatusError{Status: res.Status, StatusCode: res.StatusCode}
+			var errRes prometheusResponse
+			if json.Unmarshal(body, &errRes) == nil && errRes.Error != "" {
+				return nil, fmt.Errorf("%s: %s; cause: %w", errRes.ErrorType, errRes.Error, statusErr)
+			}
+			return nil, statusErr
+		}
+		return body, nil
+	})
+	if err != nil {
+		return err
+	}
+	var res prometheusResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return fmt.Errorf("failed to parse the response of %s; cause: %w", path, err)
+	}
+	if res.Status != "success" {
+		return fmt.Errorf("%s: %s", res.ErrorType, res.Error)
+	}
+	if err := json.Unmarshal(res.Data, data); err != nil {
+		return fmt.Errorf("failed to parse the response of %s; cause: %w", path, err)
+	}
+	return nil
+}
+
+// matrixToMetrics maps the series into metrics by their name, with the other labels as the labels of the samples
+func matrixToMetrics(result []prometheusSeries) ([]models.Metrics, error) {
+	var metricsCollection []models.Metrics
+	indices := map[string]int{}
+	for _, series := range result {
+		name := series.Metric["__name__"]
+		labels := make(map[string]string, len(series.Metric))
+		for k, v := range series.Metric {
+			if k != "__name__" {
+				labels[k] = v
+			}
+		}
+		i, found := indices[name]
+		if !found {
+			i = len(metricsCollection)
+			indices[name] = i
+			metricsCollection = append(metricsCollection, models.Metrics{
+				Key:  name,
+				Name: name,
+				Type: models.MetricTypeUntyped,
+			})
+		}
+		for _, point := range series.Values {
+			ts, ok := point[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("invalid timestamp of %s: %v", name, point[0])
+			}
+			s, ok := point[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid value of %s: %v", name, point[1])
+			}
+			value, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %s: %s; cause: %w", name, s, err)
+			}
+			metricsCollection[i].Metrics = append(metricsCollection[i].Metrics, models.Metric{
+				Value:     value,
+				Labels:    labels,
+				Timestamp: time.UnixMilli(int64(math.Round(ts * 1000))),
+			})
+		}
+	}
+	return metricsCollection, nil
+}
+
+func formatPrometheusTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+func newPrometheusProvider(api *PrometheusAPI, interval time.Duration) (*prometheusProvider, error) {
+	return &prometheusProvider{
+		api:      api,
+		interval: interval,
+	}, nil
+}
+
+// prometheusProvider queries the metrics of a Prometheus compatible API at each interval, evaluated at times aligned to
+// the interval. Since the API keeps the history of the metrics, any past time range can be queried as well.
+type prometheusProvider struct {
+	api      *PrometheusAPI
+	interval time.Duration
+	last     time.Time // the last evaluation time which was provided
+	matched  bool
+}
+
+func (p *prometheusProvider) Get(ctx context.Context) ([]models.Metrics, error) {
+	end := now().Truncate(p.interval)
+	start := end
+	if !p.last.IsZero() {
+		start = p.last.Add(p.interval)
+	}
+	if start.After(end) {
+		return nil, nil
+	}
+	metricsCollection, err := p.QueryRange(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	p.last = end
+	return metricsCollection, nil
+}
+
+// Backfill queries the metrics since the given time, and the following calls to Get provide the metrics after them
+func (p *prometheusProvider) Backfill(since time.Time) ([]models.Metrics, error) {
+	end := now().Truncate(p.interval)
+	metricsCollection, err := p.QueryRange(context.Background(), since, end)
+	if err != nil {
+		return nil, err
+	}
+	p.last = end
+	return metricsCollection, nil
+}
+
+// QueryRange queries the metrics of the time range. The step is the interval, unless the range has too many of them.
+// It first checks that the selector matches any series, so a mistyped selector is reported rather than showing nothing.
+func (p *prometheusProvider) QueryRange(ctx context.Context, start time.Time, end time.Time) ([]models.Metrics, error) {
+	if !p.matched {
+		series, err := p.api.Series(ctx, start.Add(-prometheusLookback), end)
+		if err != nil {
+			return nil, err
+		}
+		if len(series) == 0 {
+			return nil, fmt.Errorf("no series match %s", p.api.match)
+		}
+		p.matched = true
+	}
+	step := p.interval
+	if minStep := end.Sub(start) / prometheusMaxPoints; step < minStep {
+		step = minStep.Truncate(time.Second) + time.Second
+	}
+	return p.api.QueryRange(ctx, start, end, step)
+}
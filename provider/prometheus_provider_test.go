@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPrometheusStub serves the series api, and a range query api returning the value of a gauge and a counter
+// at every step, where the value of the gauge is its time in seconds
+func newPrometheusStub(queries *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/series":
+			if r.FormValue("match[]") != `{__name__=~"foo.*"}` {
+				_, _ = w.Write([]byte(`{"status":"success","data":[]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":[{"__name__":"foo","job":"a"}]}`))
+		case "/api/v1/query_range":
+			if r.FormValue("query") == "foo{" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"unexpected end of input"}`))
+				return
+			}
+			start, _ := strconv.ParseFloat(r.FormValue("start"), 64)
+			end, _ := strconv.ParseFloat(r.FormValue("end"), 64)
+			step, _ := strconv.ParseFloat(r.FormValue("step"), 64)
+			*queries = append(*queries, fmt.Sprintf("%g-%g/%g", start, end, step))
+			values := strings.Builder{}
+			for ts := start; ts <= end; ts += step {
+				if values.Len() > 0 {
+					values.WriteString(",")
+				}
+				values.WriteString(fmt.Sprintf(`[%.3f,"%g"]`, ts, ts))
+			}
+			_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[`+
+				`{"metric":{"__name__":"foo","job":"a"},"values":[%s]},`+
+				`{"metric":{"__name__":"foo_total","job":"b"},"values":[[%.3f,"NaN"]]}]}}`, values.String(), start)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func Test_prometheusProvider(t *testing.T) {
+	var queries []string
+	server := newPrometheusStub(&queries)
+	defer server.Close()
+	clock := time.Unix(1000, 0)
+	nowFunc = func() time.Time { return clock }
+	defer func() { nowFunc = time.Now }()
+
+	api := NewPrometheusAPI(server.URL+"/", `{__name__=~"foo.*"}`, server.Client(), nil, testRetryPolicy)
+	p, err := newPrometheusProvider(api, 10*time.Second)
+	require.NoError(t, err)
+	metrics, err := p.Backfill(time.Unix(970, 0))
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "foo", metrics[0].Name)
+	assert.Equal(t, []float64{970, 980, 990, 1000}, values(metrics[0].Metrics))
+	assert.Equal(t, map[string]string{"job": "a"}, metrics[0].Metrics[0].Labels)
+	assert.True(t, time.Unix(970, 0).Equal(metrics[0].Metrics[0].Timestamp), "timestamp")
+	assert.Equal(t, "foo_total", metrics[1].Name)
+
+	// Get provides the values evaluated since the previous call, aligned to the interval
+	clock = time.Unix(1025, 0)
+	metrics, err = p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1010, 1020}, values(metrics[0].Metrics))
+	clock = time.Unix(1028, 0)
+	metrics, err = p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics, "no new evaluation time")
+
+	// The step of long ranges is increased to stay within the points limit of Prometheus
+	_, err = p.QueryRange(context.Background(), time.Unix(0, 0), time.Unix(220000, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"970-1000/10", "1010-1020/10", "0-220000/21"}, queries)
+}
+
+func Test_prometheusProviderErrors(t *testing.T) {
+	var queries []string
+	server := newPrometheusStub(&queries)
+	defer server.Close()
+
+	api := NewPrometheusAPI(server.URL, `{__name__=~"bar.*"}`, server.Client(), nil, testRetryPolicy)
+	p, err := newPrometheusProvider(api, 10*time.Second)
+	require.NoError(t, err)
+	_, err = p.Get(context.Background())
+	assert.EqualError(t, err, `no series match {__name__=~"bar.*"}`)
+
+	api = NewPrometheusAPI(server.URL, "foo{", server.Client(), nil, testRetryPolicy)
+	_, err = api.QueryRange(context.Background(), time.Unix(0, 0), time.Unix(10, 0), time.Second)
+	assert.EqualError(t, err, "bad_data: unexpected end of input; cause: unexpected response status: 400 Bad Request")
+}
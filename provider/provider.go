@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"fmt"
 	"github.com/eldada/metrics-viewer/models"
 	"regexp"
@@ -9,27 +10,52 @@ import (
 	"time"
 )
 
+// Provider provides the metrics added since its previous call. Get returns once the context is done.
 type Provider interface {
-	Get() ([]models.Metrics, error)
+	Get(ctx context.Context) ([]models.Metrics, error)
+}
+
+// RangeQuerier is optionally implemented by a Provider which can query the metrics of any past time range
+type RangeQuerier interface {
+	QueryRange(ctx context.Context, start time.Time, end time.Time) ([]models.Metrics, error)
+}
+
+// TimeScroller is optionally implemented by a Provider whose metrics can be shown for past time windows
+type TimeScroller interface {
+	// Scroll moves the time window back or forward by half of it, up to the present.
+	// It returns how long ago the time window ends, or false if the provider cannot scroll.
+	Scroll(back bool) (time.Duration, bool)
 }
 
 type Config interface {
-	UrlMetricsFetcher() UrlMetricsFetcher
-	File() string
+	Sources() []Source
 	Interval() time.Duration
 	TimeWindow() time.Duration
 	Filter() *regexp.Regexp
+	Selector() *Selector
 	AggregateIgnoreLabels() StringSet
+	AggregateFunc() AggregateFunc
 }
 
+// New creates a provider of the configured sources. Metrics of multiple sources are labeled with the source name.
 func New(c Config) (Provider, error) {
-	if c.File() != "" {
-		return newFileProvider(c.File(), c.Interval())
+	switch len(c.Sources()) {
+	case 0:
+		return nil, fmt.Errorf("illegal state, could not create provider - file or url are mandatory")
+	case 1:
+		return newSourceProvider(c.Sources()[0], c.Interval())
+	}
+	p, err := newMultiProvider(c.Sources(), c.Interval())
+	if err != nil {
+		return nil, err
 	}
-	if c.UrlMetricsFetcher() != nil {
-		return newUrlProvider(c.UrlMetricsFetcher())
+	// Past time ranges can be queried only if any of the sources keeps a history of the metrics
+	for _, prov := range p.providers {
+		if _, ok := prov.(RangeQuerier); ok {
+			return &rangeQueryingMultiProvider{p}, nil
+		}
 	}
-	return nil, fmt.Errorf("illegal state, could not create provider - file or url are mandatory")
+	return p, nil
 }
 
 type StringSet map[string]struct{}
@@ -59,35 +85,84 @@ func NewRegexMetricsFilter(regex *regexp.Regexp) MetricsFilterFunc {
 
 type MetricsMapperFunc func(metricsCollection []models.Metrics) []models.Metrics
 
-func NewLabelsMetricsMapper(ignoredLabels StringSet, delim string) MetricsMapperFunc {
+// NewLabelsMetricsMapper maps the metrics into series named by their key and labels, ignoring the given labels.
+// Values of series which differ only by ignored labels are combined per timestamp using the aggregate function.
+func NewLabelsMetricsMapper(ignoredLabels StringSet, delim string, aggregateFunc AggregateFunc) MetricsMapperFunc {
+	type aggregatedMetric struct {
+		metric      models.Metric
+		aggregation *Aggregation
+	}
 	return func(metricsCollection []models.Metrics) []models.Metrics {
 		metricsMap := make(map[string]models.Metrics, 0)
+		aggregatedMap := make(map[string]map[time.Time]*aggregatedMetric, 0)
 		for _, metrics := range metricsCollection {
 			for _, metric := range metrics.Metrics {
-				name := generateMetricName(ignoredLabels, delim, metrics.Key, metric.Labels)
+				name := SeriesName(ignoredLabels, delim, metrics.Key, metric.Labels)
 				mappedMetrics, found := metricsMap[name]
 				if !found {
 					mappedMetrics = models.Metrics{
 						Key:  metrics.Key,
 						Name: name,
+						Type: metrics.Type,
+						Unit: metrics.Unit,
 					}
+					aggregatedMap[name] = make(map[time.Time]*aggregatedMetric)
 				}
 				if mappedMetrics.Description == "" {
 					mappedMetrics.Description = metrics.Description
 				}
-				mappedMetrics.Metrics = append(mappedMetrics.Metrics, metric)
 				metricsMap[name] = mappedMetrics
+				ts := metric.Timestamp.UTC()
+				aggregated, found := aggregatedMap[name][ts]
+				if !found {
+					metric.Labels = FilterLabels(ignoredLabels, metric.Labels)
+					aggregatedMap[name][ts] = &aggregatedMetric{
+						metric:      metric,
+						aggregation: NewAggregation(metric.Value),
+					}
+					continue
+				}
+				aggregated.aggregation.Add(metric.Value)
+				if aggregated.metric.Exemplar == nil {
+					aggregated.metric.Exemplar = metric.Exemplar
+				}
 			}
 		}
 		newCollection := make([]models.Metrics, 0, len(metricsMap))
-		for _, v := range metricsMap {
-			newCollection = append(newCollection, v)
+		for name, mappedMetrics := range metricsMap {
+			for _, aggregated := range aggregatedMap[name] {
+				metric := aggregated.metric
+				metric.Value = aggregated.aggregation.Value(aggregateFunc)
+				mappedMetrics.Metrics = append(mappedMetrics.Metrics, metric)
+			}
+			sort.SliceStable(mappedMetrics.Metrics, func(i, j int) bool {
+				return mappedMetrics.Metrics[i].Timestamp.Before(mappedMetrics.Metrics[j].Timestamp)
+			})
+			newCollection = append(newCollection, mappedMetrics)
 		}
 		return newCollection
 	}
 }
 
-func generateMetricName(ignoredLabels StringSet, delim string, key string, labels map[string]string) string {
+// FilterLabels returns only the labels which are not ignored
+func FilterLabels(ignoredLabels StringSet, labels map[string]string) map[string]string {
+	if ignoredLabels.Len() == 1 && ignoredLabels.Contains("NONE") {
+		return labels
+	}
+	filtered := make(map[string]string, len(labels))
+	if ignoredLabels.Len() == 1 && ignoredLabels.Contains("ALL") {
+		return filtered
+	}
+	for k, v := range labels {
+		if !ignoredLabels.Contains(k) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// SeriesName returns the name of the series of the labels, i.e. the key and the labels which are not ignored, e.g. foo{a="1",b="2"}
+func SeriesName(ignoredLabels StringSet, delim string, key string, labels map[string]string) string {
 	name := strings.Builder{}
 	name.WriteString(key)
 	if ignoredLabels.Len() == 1 && ignoredLabels.Contains("ALL") {
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLabelsMetricsMapper(t *testing.T) {
+	ts1 := time.Unix(1606343802, 0)
+	ts2 := time.Unix(1606343807, 0)
+	input := []models.Metrics{{
+		Key:  "foo",
+		Name: "foo",
+		Type: models.MetricTypeGauge,
+		Metrics: []models.Metric{
+			{Value: 1, Timestamp: ts1, Labels: map[string]string{"node": "a", "status": "200"}},
+			{Value: 3, Timestamp: ts1, Labels: map[string]string{"node": "a", "status": "500"}},
+			{Value: 8, Timestamp: ts1, Labels: map[string]string{"node": "a", "status": "404"}},
+			{Value: 2, Timestamp: ts2, Labels: map[string]string{"node": "a", "status": "200"}},
+			{Value: 6, Timestamp: ts2, Labels: map[string]string{"node": "a", "status": "500"}},
+			{Value: 5, Timestamp: ts1, Labels: map[string]string{"node": "b", "status": "200"}},
+		},
+	}}
+	tests := []struct {
+		aggregateFunc AggregateFunc
+		expected      map[string][]float64
+	}{
+		{aggregateFunc: AggregateSum, expected: map[string][]float64{`foo{node="a"}`: {12, 8}, `foo{node="b"}`: {5}}},
+		{aggregateFunc: AggregateAvg, expected: map[string][]float64{`foo{node="a"}`: {4, 4}, `foo{node="b"}`: {5}}},
+		{aggregateFunc: AggregateMin, expected: map[string][]float64{`foo{node="a"}`: {1, 2}, `foo{node="b"}`: {5}}},
+		{aggregateFunc: AggregateMax, expected: map[string][]float64{`foo{node="a"}`: {8, 6}, `foo{node="b"}`: {5}}},
+		{aggregateFunc: AggregateCount, expected: map[string][]float64{`foo{node="a"}`: {3, 2}, `foo{node="b"}`: {1}}},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.aggregateFunc), func(t *testing.T) {
+			mapMetrics := NewLabelsMetricsMapper(StringSet{"status": {}}, ",", tc.aggregateFunc)
+			actual := make(map[string][]float64)
+			for _, metrics := range mapMetrics(input) {
+				assert.Equal(t, models.MetricTypeGauge, metrics.Type, "type")
+				for _, metric := range metrics.Metrics {
+					actual[metrics.Name] = append(actual[metrics.Name], metric.Value)
+					assert.NotContains(t, metric.Labels, "status", "ignored label")
+				}
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const recordingHeader = "metrics-viewer-recording v1\n"
+
+// Record is a raw payload of a scrape, as returned by a UrlMetricsFetcher
+type Record struct {
+	Time        time.Time
+	Source      string
+	ContentType string
+	Payload     []byte
+}
+
+type recordHeader struct {
+	Time        int64  `json:"time"` // Unix nanos
+	Source      string `json:"source,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// NewRecordWriter writes records into a gzip compressed archive.
+// Each record is a JSON header line (time, source, content type and payload size) followed by the raw payload.
+func NewRecordWriter(w io.Writer) (*RecordWriter, error) {
+	gz := gzip.NewWriter(w)
+	if _, err := io.WriteString(gz, recordingHeader); err != nil {
+		return nil, fmt.Errorf("could not write recording header; cause: %w", err)
+	}
+	return &RecordWriter{gz: gz}, nil
+}
+
+type RecordWriter struct {
+	gz *gzip.Writer
+	mu sync.Mutex
+}
+
+// Write writes the record, it is safe to call concurrently
+func (w *RecordWriter) Write(record Record) error {
+	header, err := json.Marshal(recordHeader{
+		Time:        record.Time.UnixNano(),
+		Source:      record.Source,
+		ContentType: record.ContentType,
+		Size:        len(record.Payload),
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode record header; cause: %w", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, data := range [][]byte{header, {'\n'}, record.Payload, {'\n'}} {
+		if _, err := w.gz.Write(data); err != nil {
+			return fmt.Errorf("could not write record; cause: %w", err)
+		}
+	}
+	// Flush, so an interrupted recording keeps all the complete records
+	return w.gz.Flush()
+}
+
+func (w *RecordWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.gz.Close()
+}
+
+// ReadRecords reads all the records of an archive written by a RecordWriter
+func ReadRecords(filename string) ([]Record, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open recording %s; cause: %w", filename, err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a metrics-viewer recording; cause: %w", filename, err)
+	}
+	r := bufio.NewReader(gz)
+	line, err := r.ReadString('\n')
+	if err != nil || line != recordingHeader {
+		return nil, fmt.Errorf("%s is not a metrics-viewer recording", filename)
+	}
+	var records []Record
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// A recording which was interrupted may end with a partial record
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read recording %s; cause: %w", filename, err)
+		}
+		header := recordHeader{}
+		if err := json.Unmarshal(line, &header); err != nil {
+			return nil, fmt.Errorf("invalid record in %s; cause: %w", filename, err)
+		}
+		payload := make([]byte, header.Size+1)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return records, nil
+		}
+		records = append(records, Record{
+			Time:        time.Unix(0, header.Time).UTC(),
+			Source:      header.Source,
+			ContentType: header.ContentType,
+			Payload:     payload[:header.Size],
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRecording(t *testing.T, records ...Record) string {
+	filename := filepath.Join(t.TempDir(), "recording.gz")
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	w, err := NewRecordWriter(f)
+	require.NoError(t, err)
+	for _, record := range records {
+		require.NoError(t, w.Write(record))
+	}
+	require.NoError(t, w.Close())
+	return filename
+}
+
+func TestRecording(t *testing.T) {
+	t0 := time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	records := []Record{
+		{Time: t0, Source: "node1", ContentType: "text/plain; version=0.0.4", Payload: []byte("foo 1\n")},
+		{Time: t0.Add(time.Second), Source: "node2", Payload: []byte("foo 2\nbar{a=\"b\"} 3")},
+	}
+	filename := writeRecording(t, records...)
+
+	read, err := ReadRecords(filename)
+	require.NoError(t, err)
+	require.Len(t, read, 2)
+	for i := range records {
+		assert.True(t, records[i].Time.Equal(read[i].Time), "time")
+		assert.Equal(t, records[i].Source, read[i].Source, "source")
+		assert.Equal(t, records[i].ContentType, read[i].ContentType, "content type")
+		assert.Equal(t, records[i].Payload, read[i].Payload, "payload")
+	}
+	assert.True(t, HasMultipleSources(read))
+	assert.False(t, HasMultipleSources(read[:1]))
+}
+
+func TestReadRecords_NotARecording(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "foo")
+	require.NoError(t, os.WriteFile(filename, []byte("foo 1\n"), 0644))
+	_, err := ReadRecords(filename)
+	assert.EqualError(t, err, filename+" is not a metrics-viewer recording; cause: unexpected EOF")
+}
+
+func TestReplayProvider(t *testing.T) {
+	wallTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	nowFunc = func() time.Time {
+		return wallTime
+	}
+	defer func() { nowFunc = time.Now }()
+	t0 := time.Date(2020, 11, 25, 22, 36, 50, 0, time.UTC)
+	filename := writeRecording(t,
+		Record{Time: t0, Source: "node1", Payload: []byte("foo 1\nbar 2 1606343802324\n")},
+		Record{Time: t0.Add(10 * time.Second), Source: "node2", Payload: []byte("foo 3\n")},
+	)
+	p, err := NewReplayProvider(filename, 5)
+	require.NoError(t, err)
+
+	metricsCollection, err := p.Get(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metricsCollection, 2)
+	assert.Equal(t, t0, p.Now())
+	for _, metrics := range metricsCollection {
+		require.Len(t, metrics.Metrics, 1)
+		assert.Equal(t, "node1", metrics.Metrics[0].Labels[InstanceLabel], "instance")
+		switch metrics.Name {
+		case "foo":
+			assert.Equal(t, t0, metrics.Metrics[0].Timestamp, "timestamp-less samples get the recording time")
+		case "bar":
+			assert.Equal(t, time.Unix(0, 1606343802324*int64(time.Millisecond)), metrics.Metrics[0].Timestamp)
+		default:
+			t.Errorf("unexpected metrics %s", metrics.Name)
+		}
+	}
+
+	// At 5 times the speed, the second payload is replayed 2 seconds later
+	wallTime = wallTime.Add(time.Second)
+	metricsCollection, err = p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metricsCollection)
+	assert.Equal(t, t0.Add(5*time.Second), p.Now())
+
+	wallTime = wallTime.Add(time.Second)
+	metricsCollection, err = p.Get(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metricsCollection, 1)
+	assert.Equal(t, "node2", metricsCollection[0].Metrics[0].Labels[InstanceLabel], "instance")
+	assert.Equal(t, 3.0, metricsCollection[0].Metrics[0].Value)
+
+	// The replay ended
+	wallTime = wallTime.Add(time.Minute)
+	metricsCollection, err = p.Get(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metricsCollection)
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/eldada/metrics-viewer/parser"
+)
+
+// Clock is optionally implemented by a provider whose metrics are not timed by the wall clock
+type Clock interface {
+	Now() time.Time
+}
+
+// NewReplayProvider replays the payloads of a recording made by the record command.
+// The recording time starts at the first payload on the first call to Get, and runs at the given speed (1 is the
+// original speed). Each call returns the metrics of the payloads recorded up to the current recording time.
+// Metrics keep their original timestamps; samples without a timestamp get the time the payload was recorded.
+func NewReplayProvider(filename string, speed float64) (*ReplayProvider, error) {
+	records, err := ReadRecords(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("recording %s is empty", filename)
+	}
+	return &ReplayProvider{
+		records:  records,
+		speed:    speed,
+		labelled: HasMultipleSources(records),
+	}, nil
+}
+
+type ReplayProvider struct {
+	records   []Record
+	speed     float64
+	labelled  bool // whether the metrics are labeled with the recorded source name
+	next      int
+	startedAt time.Time
+}
+
+// Now returns the current recording time
+func (p *ReplayProvider) Now() time.Time {
+	first := p.records[0].Time
+	if p.startedAt.IsZero() {
+		return first
+	}
+	return first.Add(time.Duration(float64(now().Sub(p.startedAt)) * p.speed))
+}
+
+func (p *ReplayProvider) Get(_ context.Context) ([]models.Metrics, error) {
+	if p.startedAt.IsZero() {
+		p.startedAt = now()
+	}
+	recordingTime := p.Now()
+	var metricsCollection []models.Metrics
+	for ; p.next < len(p.records) && !p.records[p.next].Time.After(recordingTime); p.next++ {
+		record := p.records[p.next]
+		metrics, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse payload recorded at %s; cause: %w", record.Time, err)
+		}
+		if p.labelled {
+			metrics = withInstanceLabel(metrics, record.Source)
+		}
+		metricsCollection = append(metricsCollection, metrics...)
+	}
+	return metricsCollection, nil
+}
+
+// HasMultipleSources returns whether the records were recorded from more than one source
+func HasMultipleSources(records []Record) bool {
+	for _, record := range records {
+		if record.Source != records[0].Source {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRecord parses the payload of the record, stamping the samples without a timestamp with the time it was recorded at
+func parseRecord(record Record) ([]models.Metrics, error) {
+	data := append(append([]byte{}, record.Payload...), '\n')
+	return parser.ParseMetricsWithFormatAt(bytes.NewReader(data), parser.FormatFromContentType(record.ContentType), record.Time)
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// RetryPolicy bounds the requests of a UrlMetricsFetcher, retrying failed requests with an exponential backoff
+type RetryPolicy struct {
+	Timeout      time.Duration // of each request
+	Retries      int           // number of retries after the first request fails
+	RetryWait    time.Duration // wait before the first retry, doubled before each following one
+	MaxRetryWait time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Timeout:      10 * time.Second,
+	Retries:      2,
+	RetryWait:    500 * time.Millisecond,
+	MaxRetryWait: 10 * time.Second,
+}
+
+// StatusError is returned for a response with an unexpected status
+type StatusError struct {
+	Status     string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+// isRetryable returns whether a failed request may succeed if retried, i.e. it failed due to the network or the server
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// Do calls the request until it succeeds or the retries are exhausted, bounding each call by the timeout.
+// It stops as soon as the context is done, returning the error of the context.
+func (p RetryPolicy) Do(ctx context.Context, request func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := p.attempt(ctx, request)
+		if err == nil {
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt >= p.Retries || !isRetryable(err) {
+			return nil, err
+		}
+		wait := p.backoff(attempt)
+		log.Debug(fmt.Sprintf("request failed, retrying in %s; cause: %s", wait, err))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (p RetryPolicy) attempt(ctx context.Context, request func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	if p.Timeout <= 0 {
+		return request(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	data, err := request(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("request timed out after %s", p.Timeout)
+	}
+	return data, err
+}
+
+// backoff returns the wait before the retry following the attempt, jittered between half of it and all of it,
+// so sources failing together do not retry together
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.RetryWait
+	for i := 0; i < attempt && (p.MaxRetryWait <= 0 || wait < p.MaxRetryWait); i++ {
+		wait *= 2
+	}
+	if p.MaxRetryWait > 0 && wait > p.MaxRetryWait {
+		wait = p.MaxRetryWait
+	}
+	if wait <= 0 {
+		return 0
+	}
+	half := wait / 2
+	return half + rand.N(wait-half+1)
+}
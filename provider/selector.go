@@ -0,0 +1,228 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/eldada/metrics-viewer/models"
+)
+
+var selectorPattern = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)?\s*\{(.*)\}\s*$`)
+
+var matcherPrefixPattern = regexp.MustCompile(`^\s*[a-zA-Z_][a-zA-Z0-9_]*\s*(=|!=|=~|!~)`)
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+
+// Selector selects metrics by name and labels, using the Prometheus selector syntax: name{label="x",other=~"y.*",bad!="z"}
+type Selector struct {
+	Name     string // empty matches any name
+	Matchers []*LabelMatcher
+}
+
+// IsSelector returns true if the value is written as a selector (rather than e.g. a regular expression),
+// meaning an optional metric name followed by label matchers in curly braces
+func IsSelector(s string) bool {
+	match := selectorPattern.FindStringSubmatch(s)
+	if match == nil {
+		return false
+	}
+	return strings.TrimSpace(match[2]) == "" || matcherPrefixPattern.MatchString(match[2])
+}
+
+func ParseSelector(s string) (*Selector, error) {
+	match := selectorPattern.FindStringSubmatch(s)
+	if match == nil {
+		return nil, fmt.Errorf("selector must be in the form name{label=\"value\",...}; got: '%s'", s)
+	}
+	selector := &Selector{Name: match[1]}
+	rest := strings.TrimSpace(match[2])
+	for rest != "" {
+		name := labelNamePattern.FindString(rest)
+		if name == "" {
+			return nil, fmt.Errorf("expected label name at: '%s'", rest)
+		}
+		rest = strings.TrimSpace(rest[len(name):])
+		var op string
+		for _, candidate := range []string{"!=", "=~", "!~", "="} {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("expected label matching operator (=, !=, =~, !~) after label %s", name)
+		}
+		rest = strings.TrimSpace(rest[len(op):])
+		value, remaining, err := unquote(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of label %s; cause: %w", name, err)
+		}
+		matcher, err := NewLabelMatcher(name, op, value)
+		if err != nil {
+			return nil, err
+		}
+		selector.Matchers = append(selector.Matchers, matcher)
+		rest = strings.TrimSpace(remaining)
+		if rest != "" {
+			if rest[0] != ',' {
+				return nil, fmt.Errorf("expected ',' between label matchers at: '%s'", rest)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+	}
+	if selector.Name == "" && len(selector.Matchers) == 0 {
+		return nil, fmt.Errorf("selector must have a metric name or at least one label matcher")
+	}
+	return selector, nil
+}
+
+// unquote reads a double or single quoted string from the start of s, and returns it with the rest of s
+func unquote(s string) (string, string, error) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return "", "", fmt.Errorf("expected quoted string at: '%s'", s)
+	}
+	quote := s[0]
+	value := strings.Builder{}
+	for pos := 1; pos < len(s); pos++ {
+		switch s[pos] {
+		case quote:
+			return value.String(), s[pos+1:], nil
+		case '\\':
+			if pos+1 < len(s) {
+				pos++
+			}
+		}
+		value.WriteByte(s[pos])
+	}
+	return "", "", fmt.Errorf("unterminated string: %s", s)
+}
+
+// Matches returns true if the metrics has the selector name (if set), and its labels match all the matchers.
+// The labels are taken from the first metric, since all the metrics of a mapped series have the same labels,
+// or from the series name if there are no metrics. Only the name is matched if the labels are unknown.
+func (s *Selector) Matches(metrics models.Metrics) bool {
+	labels, known := seriesLabels(metrics)
+	if !known {
+		return s.Name == "" || s.Name == metrics.Key
+	}
+	return s.MatchesSample(metrics.Key, labels)
+}
+
+// MatchesSample returns true if the sample of the metric key has the selector name (if set), and its labels match
+// all the matchers
+func (s *Selector) MatchesSample(key string, labels map[string]string) bool {
+	if s.Name != "" && s.Name != key {
+		return false
+	}
+	for _, m := range s.Matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// seriesLabels returns the labels of the series, which are in its name when mapped (see NewLabelsMetricsMapper)
+func seriesLabels(metrics models.Metrics) (map[string]string, bool) {
+	if len(metrics.Metrics) > 0 {
+		return metrics.Metrics[0].Labels, true
+	}
+	if metrics.Name == metrics.Key {
+		return nil, true
+	}
+	nameSelector, err := ParseSelector(metrics.Name)
+	if err != nil || nameSelector.Name != metrics.Key {
+		return nil, false
+	}
+	labels := make(map[string]string, len(nameSelector.Matchers))
+	for _, m := range nameSelector.Matchers {
+		labels[m.Name] = m.Value
+	}
+	return labels, true
+}
+
+func (s *Selector) String() string {
+	matchers := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		matchers = append(matchers, m.String())
+	}
+	return fmt.Sprintf("%s{%s}", s.Name, strings.Join(matchers, ","))
+}
+
+// NewSelectorMetricsFilter keeps the metrics matching the selector, or all the metrics if the selector is nil
+func NewSelectorMetricsFilter(selector *Selector) MetricsFilterFunc {
+	return func(metrics models.Metrics) bool {
+		return selector == nil || selector.Matches(metrics)
+	}
+}
+
+// NewSelectorSamplesMapper keeps only the samples matching the selector, or all the samples if the selector is nil.
+// The samples are matched by all their labels, so the selector must be applied before any labels are ignored
+// (see NewLabelsMetricsMapper). Metrics left without samples are dropped.
+func NewSelectorSamplesMapper(selector *Selector) MetricsMapperFunc {
+	return func(metricsCollection []models.Metrics) []models.Metrics {
+		if selector == nil {
+			return metricsCollection
+		}
+		selected := make([]models.Metrics, 0, len(metricsCollection))
+		for _, metrics := range metricsCollection {
+			var samples []models.Metric
+			for _, m := range metrics.Metrics {
+				if selector.MatchesSample(metrics.Key, m.Labels) {
+					samples = append(samples, m)
+				}
+			}
+			if len(samples) > 0 {
+				metrics.Metrics = samples
+				selected = append(selected, metrics)
+			}
+		}
+		return selected
+	}
+}
+
+// LabelMatcher matches a label value, using one of the operators: =, !=, =~, !~
+type LabelMatcher struct {
+	Name  string
+	Op    string
+	Value string
+	regex *regexp.Regexp
+}
+
+func NewLabelMatcher(name, op, value string) (*LabelMatcher, error) {
+	m := &LabelMatcher{Name: name, Op: op, Value: value}
+	switch op {
+	case "=", "!=":
+	case "=~", "!~":
+		var err error
+		// Regular expressions are anchored, as in Prometheus
+		m.regex, err = regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression for label %s; cause: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown label matching operator: %s", op)
+	}
+	return m, nil
+}
+
+// Matches returns true if the label value matches. A missing label is matched as an empty value.
+func (m *LabelMatcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name]
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.regex.MatchString(v)
+	case "!~":
+		return !m.regex.MatchString(v)
+	}
+	return false
+}
+
+func (m *LabelMatcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Op, m.Value)
+}
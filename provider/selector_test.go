@@ -0,0 +1,188 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSelector(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{value: `foo{bar="x"}`, expected: true},
+		{value: ` {bar=~"x.*", baz!="y"} `, expected: true},
+		{value: `foo{}`, expected: true},
+		{value: `foo`, expected: false},
+		{value: `app_.*`, expected: false},
+		{value: `foo{2}`, expected: false},
+		{value: `foo\{bar="x"\}`, expected: false},
+		{value: ``, expected: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsSelector(tc.value))
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "name and matchers",
+			value:    `foo{label="x",other=~"y.*",bad!="z",worse!~'w'}`,
+			expected: `foo{label="x",other=~"y.*",bad!="z",worse!~"w"}`,
+		},
+		{
+			name:     "matchers only with spaces and trailing comma",
+			value:    ` { label = "x" , } `,
+			expected: `{label="x"}`,
+		},
+		{
+			name:     "escaped quote",
+			value:    `foo{label="a\"b"}`,
+			expected: `foo{label="a\"b"}`,
+		},
+		{
+			name:        "empty selector",
+			value:       `{}`,
+			expectedErr: "selector must have a metric name or at least one label matcher",
+		},
+		{
+			name:        "missing operator",
+			value:       `foo{label}`,
+			expectedErr: "expected label matching operator (=, !=, =~, !~) after label label",
+		},
+		{
+			name:        "unquoted value",
+			value:       `foo{label=x}`,
+			expectedErr: "invalid value of label label; cause: expected quoted string at: 'x'",
+		},
+		{
+			name:        "missing comma",
+			value:       `foo{a="x" b="y"}`,
+			expectedErr: "expected ',' between label matchers at: 'b=\"y\"'",
+		},
+		{
+			name:        "bad regex",
+			value:       `foo{a=~"("}`,
+			expectedErr: "invalid regular expression for label a; cause: error parsing regexp: missing closing ): `^(?:()$`",
+		},
+		{
+			name:        "not a selector",
+			value:       `foo`,
+			expectedErr: "selector must be in the form name{label=\"value\",...}; got: 'foo'",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			selector, err := ParseSelector(tc.value)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, selector.String())
+		})
+	}
+}
+
+func TestNewSelectorMetricsFilter(t *testing.T) {
+	metrics := func(key string, labels map[string]string) models.Metrics {
+		return models.Metrics{Key: key, Metrics: []models.Metric{{Value: 1, Labels: labels}}}
+	}
+	tests := []struct {
+		name     string
+		selector string
+		metrics  models.Metrics
+		expected bool
+	}{
+		{
+			name:     "name only",
+			selector: `foo{}`,
+			metrics:  metrics("foo", map[string]string{"a": "b"}),
+			expected: true,
+		},
+		{
+			name:     "different name",
+			selector: `foo{}`,
+			metrics:  metrics("foobar", nil),
+			expected: false,
+		},
+		{
+			name:     "all matchers match",
+			selector: `foo{a="b",c=~"d.*",e!="f",g!~"h.*"}`,
+			metrics:  metrics("foo", map[string]string{"a": "b", "c": "dd", "e": "x", "g": "y"}),
+			expected: true,
+		},
+		{
+			name:     "regex is anchored",
+			selector: `{c=~"d"}`,
+			metrics:  metrics("foo", map[string]string{"c": "dd"}),
+			expected: false,
+		},
+		{
+			name:     "missing label matches empty value",
+			selector: `foo{a!="b",c=""}`,
+			metrics:  metrics("foo", nil),
+			expected: true,
+		},
+		{
+			name:     "labels of a series without metrics from its name",
+			selector: `foo{a="b"}`,
+			metrics:  models.Metrics{Key: "foo", Name: `foo{a="b",c="d"}`},
+			expected: true,
+		},
+		{
+			name:     "labels of a series without metrics not matching",
+			selector: `foo{a="b"}`,
+			metrics:  models.Metrics{Key: "foo", Name: `foo{a="x"}`},
+			expected: false,
+		},
+		{
+			name:     "series without metrics nor labels",
+			selector: `foo{a=""}`,
+			metrics:  models.Metrics{Key: "foo", Name: "foo"},
+			expected: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			selector, err := ParseSelector(tc.selector)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, NewSelectorMetricsFilter(selector)(tc.metrics))
+		})
+	}
+	assert.True(t, NewSelectorMetricsFilter(nil)(metrics("foo", nil)))
+}
+
+func TestNewSelectorSamplesMapper(t *testing.T) {
+	selector, err := ParseSelector(`foo{status="200"}`)
+	require.NoError(t, err)
+	metricsCollection := []models.Metrics{
+		{Key: "foo", Name: "foo", Metrics: []models.Metric{
+			{Value: 1, Labels: map[string]string{"status": "200", "path": "/a"}},
+			{Value: 2, Labels: map[string]string{"status": "500", "path": "/a"}},
+			{Value: 3, Labels: map[string]string{"status": "200", "path": "/b"}},
+		}},
+		{Key: "bar", Name: "bar", Metrics: []models.Metric{{Value: 4, Labels: map[string]string{"status": "200"}}}},
+	}
+	// The ignored status label is matched before the series are mapped
+	mapped := NewLabelsMetricsMapper(StringSet{"status": {}}, ",", AggregateSum)(NewSelectorSamplesMapper(selector)(metricsCollection))
+	require.Len(t, mapped, 2)
+	values := map[string]float64{}
+	for _, metrics := range mapped {
+		require.Len(t, metrics.Metrics, 1)
+		values[metrics.Name] = metrics.Metrics[0].Value
+	}
+	assert.Equal(t, map[string]float64{`foo{path="/a"}`: 1, `foo{path="/b"}`: 3}, values)
+	assert.Equal(t, metricsCollection, NewSelectorSamplesMapper(nil)(metricsCollection))
+}
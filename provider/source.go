@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// InstanceLabel is the label holding the source name, added to the metrics when there are multiple sources
+const InstanceLabel = "instance"
+
+// Source is a named source of metrics, either a file, a url, a Prometheus API or a recording to replay
+type Source struct {
+	Name              string
+	File              string
+	UrlMetricsFetcher UrlMetricsFetcher
+	Prometheus        *PrometheusAPI
+	Replay            string
+	ReplaySpeed       float64
+	NoFollow          bool     // the file is read from its start to its end, instead of being tailed
+	Archives          []string // rotated files, in order, which are read before the file
+}
+
+func (s Source) String() string {
+	if s.Replay != "" {
+		return fmt.Sprintf("%s: replay: '%s', speed: %g", s.Name, s.Replay, s.ReplaySpeed)
+	}
+	if len(s.Archives) > 0 {
+		return fmt.Sprintf("%s: file: '%s', archives: ['%s']", s.Name, s.File, strings.Join(s.Archives, "', '"))
+	}
+	if s.File != "" && s.NoFollow {
+		return fmt.Sprintf("%s: file: '%s', no follow", s.Name, s.File)
+	}
+	if s.File != "" {
+		return fmt.Sprintf("%s: file: '%s'", s.Name, s.File)
+	}
+	if s.Prometheus != nil {
+		return fmt.Sprintf("%s: %s", s.Name, s.Prometheus)
+	}
+	return fmt.Sprintf("%s: %s", s.Name, s.UrlMetricsFetcher)
+}
+
+func newSourceProvider(source Source, interval time.Duration) (Provider, error) {
+	if source.Replay != "" {
+		return NewReplayProvider(source.Replay, source.ReplaySpeed)
+	}
+	if len(source.Archives) > 0 {
+		return newRotatedFileProvider(source.Archives, source.File, interval)
+	}
+	if source.File != "" {
+		return newFileProvider(source.File, interval)
+	}
+	if source.UrlMetricsFetcher != nil {
+		return newUrlProvider(source.UrlMetricsFetcher)
+	}
+	if source.Prometheus != nil {
+		return newPrometheusProvider(source.Prometheus, interval)
+	}
+	return nil, fmt.Errorf("illegal state, could not create provider for source %s - file, url, prometheus or replay are mandatory", source.Name)
+}
+
+func newMultiProvider(sources []Source, interval time.Duration) (*multiProvider, error) {
+	p := &multiProvider{}
+	for _, source := range sources {
+		prov, err := newSourceProvider(source, interval)
+		if err != nil {
+			return nil, err
+		}
+		p.names = append(p.names, source.Name)
+		p.providers = append(p.providers, prov)
+	}
+	return p, nil
+}
+
+// multiProvider gets the metrics of all the sources concurrently, labeling each metric with its source name
+type multiProvider struct {
+	names     []string
+	providers []Provider
+}
+
+func (p *multiProvider) Get(ctx context.Context) ([]models.Metrics, error) {
+	results := make([][]models.Metrics, len(p.providers))
+	errs := make([]error, len(p.providers))
+	wg := sync.WaitGroup{}
+	for i, prov := range p.providers {
+		wg.Add(1)
+		go func(i int, prov Provider) {
+			defer wg.Done()
+			results[i], errs[i] = prov.Get(ctx)
+		}(i, prov)
+	}
+	wg.Wait()
+
+	var metricsCollection []models.Metrics
+	var failures []error
+	for i, name := range p.names {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Errorf("failed to get metrics from %s; cause: %w", name, errs[i]))
+			continue
+		}
+		metricsCollection = append(metricsCollection, withInstanceLabel(results[i], name)...)
+	}
+	// A failing source should not hide the others, unless all of them fail
+	if len(failures) == len(p.providers) {
+		return nil, errors.Join(failures...)
+	}
+	for _, err := range failures {
+		log.Warn(err.Error())
+	}
+	return metricsCollection, nil
+}
+
+// rangeQueryingMultiProvider is a multiProvider with sources which keep a history of the metrics
+type rangeQueryingMultiProvider struct {
+	*multiProvider
+}
+
+// QueryRange queries the metrics of the time range from the sources which can query it, labeling them with their source name
+func (p *rangeQueryingMultiProvider) QueryRange(ctx context.Context, start time.Time, end time.Time) ([]models.Metrics, error) {
+	var metricsCollection []models.Metrics
+	for i, prov := range p.providers {
+		querier, ok := prov.(RangeQuerier)
+		if !ok {
+			continue
+		}
+		metrics, err := querier.QueryRange(ctx, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query metrics from %s; cause: %w", p.names[i], err)
+		}
+		metricsCollection = append(metricsCollection, withInstanceLabel(metrics, p.names[i])...)
+	}
+	return metricsCollection, nil
+}
+
+// withInstanceLabel returns a copy of the metrics with the instance label set, overriding any existing one
+func withInstanceLabel(metricsCollection []models.Metrics, instance string) []models.Metrics {
+	newCollection := make([]models.Metrics, 0, len(metricsCollection))
+	for _, metrics := range metricsCollection {
+		labeled := make([]models.Metric, 0, len(metrics.Metrics))
+		for _, metric := range metrics.Metrics {
+			labels := make(map[string]string, len(metric.Labels)+1)
+			for k, v := range metric.Labels {
+				labels[k] = v
+			}
+			labels[InstanceLabel] = instance
+			metric.Labels = labels
+			labeled = append(labeled, metric)
+		}
+		metrics.Metrics = labeled
+		newCollection = append(newCollection, metrics)
+	}
+	return newCollection
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_multiProvider(t *testing.T) {
+	p, err := newMultiProvider([]Source{
+		{Name: "node1", UrlMetricsFetcher: staticMetricsFetcher("foo 1 1606343802324\n")},
+		{Name: "node2", UrlMetricsFetcher: staticMetricsFetcher(`foo{instance="other",a="b"} 2 1606343802324` + "\n")},
+	}, time.Second)
+	require.NoError(t, err)
+	metricsCollection, err := p.Get(context.Background())
+	require.NoError(t, err)
+	var actual []string
+	for _, metrics := range metricsCollection {
+		for _, metric := range metrics.Metrics {
+			actual = append(actual, fmt.Sprintf("%s %v %v", metrics.Key, metric.Labels, metric.Value))
+		}
+	}
+	assert.Equal(t, []string{
+		"foo map[instance:node1] 1",
+		"foo map[a:b instance:node2] 2",
+	}, actual)
+}
+
+func Test_multiProviderWithFailingSource(t *testing.T) {
+	p, err := newMultiProvider([]Source{
+		{Name: "node1", UrlMetricsFetcher: staticMetricsFetcher("foo 1 1606343802324\n")},
+		{Name: "node2", UrlMetricsFetcher: failingMetricsFetcher{}},
+	}, time.Second)
+	require.NoError(t, err)
+	metricsCollection, err := p.Get(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metricsCollection, 1)
+	assert.Equal(t, "node1", metricsCollection[0].Metrics[0].Labels[InstanceLabel])
+
+	p, err = newMultiProvider([]Source{
+		{Name: "node1", UrlMetricsFetcher: failingMetricsFetcher{}},
+		{Name: "node2", UrlMetricsFetcher: failingMetricsFetcher{}},
+	}, time.Second)
+	require.NoError(t, err)
+	_, err = p.Get(context.Background())
+	assert.EqualError(t, err, "failed to get metrics from node1; cause: connection refused\n"+
+		"failed to get metrics from node2; cause: connection refused")
+}
+
+type staticMetricsFetcher string
+
+func (f staticMetricsFetcher) Get(_ context.Context) ([]byte, error) {
+	return []byte(f), nil
+}
+
+type failingMetricsFetcher struct{}
+
+func (f failingMetricsFetcher) Get(_ context.Context) ([]byte, error) {
+	return nil, fmt.Errorf("connection refused")
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/eldada/metrics-viewer/models"
+	"github.com/jfrog/jfrog-client-go/utils/log"
+)
+
+// NewStoredProvider stores the metrics of the provider. The first call to Get also returns the stored
+// metrics of the given history duration, so a new session continues where previous ones stopped.
+// Past time ranges are queried from the storage, unless the provider keeps a history of its own (see RangeQuerier).
+func NewStoredProvider(provider Provider, storage Storage, history time.Duration) Provider {
+	return &storedProvider{
+		provider: provider,
+		storage:  storage,
+		history:  history,
+	}
+}
+
+type storedProvider struct {
+	provider      Provider
+	storage       Storage
+	history       time.Duration
+	historyLoaded bool
+}
+
+func (p *storedProvider) Get(ctx context.Context) ([]models.Metrics, error) {
+	var metricsCollection []models.Metrics
+	if !p.historyLoaded {
+		// Loaded before storing the fetched metrics, so they are not returned twice
+		end := now()
+		stored, err := p.storage.Load(end.Add(-p.history), end)
+		if err != nil {
+			log.Warn("could not load stored metrics:", err.Error())
+		}
+		metricsCollection = append(metricsCollection, stored...)
+	}
+	fetched, err := p.provider.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.historyLoaded = true
+	// Failing to store should not stop the viewer, the metrics are still cached in memory
+	if err := p.storage.Append(fetched); err != nil {
+		log.Warn("could not store metrics:", err.Error())
+	}
+	return append(metricsCollection, fetched...), nil
+}
+
+// QueryRange queries the metrics of the time range from the provider if it keeps a history of its own,
+// which starts before the storage, and from the storage otherwise
+func (p *storedProvider) QueryRange(ctx context.Context, start time.Time, end time.Time) ([]models.Metrics, error) {
+	if querier, ok := p.provider.(RangeQuerier); ok {
+		return querier.QueryRange(ctx, start, end)
+	}
+	return p.storage.Load(start, end)
+}
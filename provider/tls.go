@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSOptions configures the TLS connections to url sources
+type TLSOptions struct {
+	CACert             string // PEM file of the certificate authorities to trust instead of the system ones
+	ClientCert         string // PEM file of the client certificate, for servers requiring mutual TLS
+	ClientKey          string // PEM file of the private key of the client certificate
+	InsecureSkipVerify bool
+	ServerName         string // name to verify the server certificate against, instead of the url host
+}
+
+// NewHttpClient creates a client with a dedicated transport configured by the TLS options
+func NewHttpClient(o TLSOptions) (*http.Client, error) {
+	if (o.ClientCert == "") != (o.ClientKey == "") {
+		return nil, fmt.Errorf("--client-cert and --client-key must be used together")
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		ServerName:         o.ServerName,
+	}
+	if o.CACert != "" {
+		pem, err := os.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate %s; cause: %w", o.CACert, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA certificate %s", o.CACert)
+		}
+	}
+	if o.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate %s; cause: %w", o.ClientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
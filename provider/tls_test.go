@@ -0,0 +1,148 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHttpClient(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientKey, clientX509 := writeClientCertificate(t, dir)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("foo 1\n"))
+	})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+	mtlsServer := httptest.NewUnstartedServer(handler)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX509)
+	mtlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mtlsServer.StartTLS()
+	defer mtlsServer.Close()
+	// The certificates of the test servers are issued by the same authority
+	caCert := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644))
+
+	tests := []struct {
+		name       string
+		url        string
+		options    TLSOptions
+		wantErr    string
+		wantGetErr string
+	}{
+		{
+			name:       "untrusted server",
+			url:        server.URL,
+			wantGetErr: "certificate signed by unknown authority",
+		},
+		{
+			name:    "ca cert",
+			url:     server.URL,
+			options: TLSOptions{CACert: caCert},
+		},
+		{
+			name:    "insecure skip verify",
+			url:     server.URL,
+			options: TLSOptions{InsecureSkipVerify: true},
+		},
+		{
+			name:    "server name",
+			url:     server.URL,
+			options: TLSOptions{CACert: caCert, ServerName: "example.com"},
+		},
+		{
+			name:       "wrong server name",
+			url:        server.URL,
+			options:    TLSOptions{CACert: caCert, ServerName: "other.com"},
+			wantGetErr: "not other.com",
+		},
+		{
+			name:    "client cert",
+			url:     mtlsServer.URL,
+			options: TLSOptions{CACert: caCert, ClientCert: clientCert, ClientKey: clientKey},
+		},
+		{
+			name:       "missing client cert",
+			url:        mtlsServer.URL,
+			options:    TLSOptions{CACert: caCert},
+			wantGetErr: "certificate required",
+		},
+		{
+			name:    "client cert without key",
+			options: TLSOptions{ClientCert: clientCert},
+			wantErr: "--client-cert and --client-key must be used together",
+		},
+		{
+			name:    "missing ca cert",
+			options: TLSOptions{CACert: filepath.Join(dir, "missing.pem")},
+			wantErr: "could not read CA certificate " + filepath.Join(dir, "missing.pem") + "; cause: open " + filepath.Join(dir, "missing.pem") + ": no such file or directory",
+		},
+		{
+			name:    "invalid ca cert",
+			options: TLSOptions{CACert: clientKey},
+			wantErr: "no certificates found in CA certificate " + clientKey,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewHttpClient(tc.options)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			f := NewUrlMetricsFetcher(tc.url, client, nil, RetryPolicy{Timeout: 5 * time.Second})
+			data, err := f.Get(context.Background())
+			if tc.wantGetErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantGetErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "foo 1\n", string(data))
+		})
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key, returning their files and the certificate
+func writeClientCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "metrics-viewer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile, cert
+}
@@ -1,11 +1,13 @@
 package provider
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/jfrog/jfrog-cli-core/v2/artifactory/utils"
 	"github.com/jfrog/jfrog-cli-core/v2/utils/config"
@@ -13,26 +15,39 @@ import (
 	"github.com/jfrog/jfrog-client-go/utils/io/httputils"
 )
 
+// UrlMetricsFetcher gets the metrics payload of a url. Get returns once the context is done, even if the request hangs.
 type UrlMetricsFetcher interface {
-	Get() ([]byte, error)
+	Get(ctx context.Context) ([]byte, error)
 }
 
-func NewArtifactoryMetricsFetcher(rtDetails *config.ServerDetails) (*artifactoryMetricsFetcher, error) {
-	const useDefaultRetries = -1
-	const useDefaultRetryWaitTime = -1
-	sm, err := utils.CreateServiceManager(rtDetails, useDefaultRetries, useDefaultRetryWaitTime, false)
+// ContentTypeAware is optionally implemented by a UrlMetricsFetcher to report the Content-Type of the last fetched payload
+type ContentTypeAware interface {
+	ContentType() string
+}
+
+func NewArtifactoryMetricsFetcher(rtDetails *config.ServerDetails, retryPolicy RetryPolicy) (*artifactoryMetricsFetcher, error) {
+	return newJFrogMetricsFetcher(rtDetails, fmt.Sprintf("%s/api/v1/metrics", strings.TrimSuffix(rtDetails.ArtifactoryUrl, "/")), retryPolicy)
+}
+
+// newJFrogMetricsFetcher creates a fetcher of a metrics endpoint of the server, using the credentials of its configuration
+func newJFrogMetricsFetcher(details *config.ServerDetails, url string, retryPolicy RetryPolicy) (*artifactoryMetricsFetcher, error) {
+	// Retries are done by the retry policy, and the client times out by itself since its context is bound on creation
+	const noRetries = 0
+	const noRetryWaitTime = 0
+	sm, err := utils.CreateServiceManagerWithContext(context.Background(), details, false, 0, noRetries, noRetryWaitTime, retryPolicy.Timeout)
 	if err != nil {
 		return nil, err
 	}
-	authConfig, err := rtDetails.CreateArtAuthConfig()
+	authConfig, err := details.CreateArtAuthConfig()
 	if err != nil {
 		return nil, err
 	}
 	clientDetails := authConfig.CreateHttpClientDetails()
 	return &artifactoryMetricsFetcher{
-		url:           fmt.Sprintf("%s/api/v1/metrics", strings.TrimSuffix(rtDetails.ArtifactoryUrl, "/")),
+		url:           url,
 		client:        sm.Client(),
 		clientDetails: &clientDetails,
+		retryPolicy:   retryPolicy,
 	}, nil
 }
 
@@ -40,76 +55,140 @@ type artifactoryMetricsFetcher struct {
 	url           string
 	client        *jfroghttpclient.JfrogHttpClient
 	clientDetails *httputils.HttpClientDetails
+	retryPolicy   RetryPolicy
+	contentType   contentTypeHolder
+}
+
+func (f *artifactoryMetricsFetcher) Get(ctx context.Context) ([]byte, error) {
+	return f.retryPolicy.Do(ctx, f.get)
 }
 
-func (f *artifactoryMetricsFetcher) Get() ([]byte, error) {
-	res, body, _, err := f.client.SendGet(f.url, true, f.clientDetails)
+type sendGetResult struct {
+	res  *http.Response
+	body []byte
+	err  error
+}
+
+// get sends the request in the background, since the client cannot be cancelled by the context.
+// An abandoned request still ends by the timeout of the client.
+func (f *artifactoryMetricsFetcher) get(ctx context.Context) ([]byte, error) {
+	results := make(chan sendGetResult, 1)
+	go func() {
+		res, body, _, err := f.client.SendGet(f.url, true, f.clientDetails)
+		results <- sendGetResult{res: res, body: body, err: err}
+	}()
+	var result sendGetResult
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result = <-results:
+	}
+	res, body, err := result.res, result.body, result.err
 	if err != nil {
 		return nil, err
 	}
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected response status: %s", res.Status)
+		return nil, &StatusError{Status: res.Status, StatusCode: res.StatusCode}
 	}
 	if len(body) == 0 {
 		return nil, fmt.Errorf("response body is empty")
 	}
+	f.contentType.Set(res.Header.Get("Content-Type"))
 	return body, nil
 }
 
-func (f artifactoryMetricsFetcher) String() string {
+func (f *artifactoryMetricsFetcher) ContentType() string {
+	return f.contentType.Get()
+}
+
+func (f *artifactoryMetricsFetcher) String() string {
 	return fmt.Sprintf("url: %s, user: %s", f.url, f.clientDetails.User)
 }
 
-func NewUrlMetricsFetcher(url string, authenticator Authenticator) *urlMetricsFetcher {
+func NewUrlMetricsFetcher(url string, client *http.Client, authenticator Authenticator, retryPolicy RetryPolicy) *urlMetricsFetcher {
 	return &urlMetricsFetcher{
 		url:           url,
 		authenticator: authenticator,
+		client:        client,
+		retryPolicy:   retryPolicy,
 	}
 }
 
 type urlMetricsFetcher struct {
 	url           string
 	authenticator Authenticator
+	client        *http.Client
+	retryPolicy   RetryPolicy
+	contentType   contentTypeHolder
 }
 
-func (f urlMetricsFetcher) String() string {
+func (f *urlMetricsFetcher) String() string {
 	if f.authenticator == nil {
 		return fmt.Sprintf("url: %s", f.url)
 	}
 	return fmt.Sprintf("url: %s, auth-by-%s", f.url, f.authenticator)
 }
 
-func (f urlMetricsFetcher) Get() ([]byte, error) {
-	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+func (f *urlMetricsFetcher) Get(ctx context.Context) ([]byte, error) {
+	return f.retryPolicy.Do(ctx, f.get)
+}
+
+func (f *urlMetricsFetcher) get(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
 	if err != nil {
 		return nil, err
 	}
-	if f.authenticator != nil {
-		f.authenticator.Authorize(req)
-	}
-	res, err := http.DefaultClient.Do(req)
+	res, err := DoAuthorized(f.client, f.authenticator, req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected response status: %s", res.Status)
+		return nil, &StatusError{Status: res.Status, StatusCode: res.StatusCode}
 	}
+	f.contentType.Set(res.Header.Get("Content-Type"))
 	return io.ReadAll(res.Body)
 }
 
+func (f *urlMetricsFetcher) ContentType() string {
+	return f.contentType.Get()
+}
+
+type contentTypeHolder struct {
+	mu          sync.Mutex
+	contentType string
+}
+
+func (h *contentTypeHolder) Set(contentType string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.contentType = contentType
+}
+
+func (h *contentTypeHolder) Get() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.contentType
+}
+
+// Authenticator authorizes the requests to a url, failing if its credentials are not available
 type Authenticator interface {
-	Authorize(req *http.Request)
+	Authorize(req *http.Request) error
 }
 
 type UserPassAuthenticator struct {
 	Username string
-	Password string
+	Password Secret
 }
 
-func (a UserPassAuthenticator) Authorize(req *http.Request) {
-	credsEncoded := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", a.Username, a.Password)))
-	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", credsEncoded))
+func (a UserPassAuthenticator) Authorize(req *http.Request) error {
+	password, err := a.Password.Value()
+	if err != nil {
+		return err
+	}
+	credsEncoded := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", a.Username, password)))
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", credsEncoded))
+	return nil
 }
 
 func (a UserPassAuthenticator) String() string {
@@ -117,11 +196,16 @@ func (a UserPassAuthenticator) String() string {
 }
 
 type AccessTokenAuthenticator struct {
-	Token string
+	Token Secret
 }
 
-func (a AccessTokenAuthenticator) Authorize(req *http.Request) {
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", a.Token))
+func (a AccessTokenAuthenticator) Authorize(req *http.Request) error {
+	token, err := a.Token.Value()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return nil
 }
 
 func (a AccessTokenAuthenticator) String() string {
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{
+	Timeout:      100 * time.Millisecond,
+	Retries:      2,
+	RetryWait:    time.Millisecond,
+	MaxRetryWait: 5 * time.Millisecond,
+}
+
+func Test_urlMetricsFetcher_Get(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      string
+		wantRequests int32
+	}{
+		{
+			name:         "succeeds",
+			statuses:     []int{http.StatusOK},
+			wantRequests: 1,
+		},
+		{
+			name:         "retries server errors",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "retries are exhausted",
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			wantErr:      "unexpected response status: 502 Bad Gateway",
+			wantRequests: 3,
+		},
+		{
+			name:         "does not retry client errors",
+			statuses:     []int{http.StatusNotFound, http.StatusOK},
+			wantErr:      "unexpected response status: 404 Not Found",
+			wantRequests: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[requests.Add(1)-1]
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, _ = w.Write([]byte("foo 1\n"))
+				}
+			}))
+			defer server.Close()
+			f := NewUrlMetricsFetcher(server.URL, server.Client(), nil, testRetryPolicy)
+			data, err := f.Get(context.Background())
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "foo 1\n", string(data))
+			}
+			assert.Equal(t, tc.wantRequests, requests.Load(), "requests")
+		})
+	}
+}
+
+func Test_urlMetricsFetcher_GetHanging(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	f := NewUrlMetricsFetcher(server.URL, server.Client(), nil, testRetryPolicy)
+	_, err := f.Get(context.Background())
+	assert.EqualError(t, err, "request timed out after 100ms")
+	assert.Equal(t, int32(3), requests.Load(), "requests")
+
+	// A cancelled context stops the request and the retries
+	policy := testRetryPolicy
+	policy.Timeout = time.Minute
+	f = NewUrlMetricsFetcher(server.URL, server.Client(), nil, policy)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = f.Get(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "elapsed")
+	assert.Equal(t, int32(4), requests.Load(), "requests")
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{RetryWait: 100 * time.Millisecond, MaxRetryWait: time.Second}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		wait := p.backoff(attempt)
+		assert.GreaterOrEqual(t, wait, want/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, wait, want, "attempt %d", attempt)
+	}
+}
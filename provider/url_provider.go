@@ -2,6 +2,8 @@ package provider
 
 import (
 	"bytes"
+	"context"
+
 	"github.com/eldada/metrics-viewer/models"
 	"github.com/eldada/metrics-viewer/parser"
 )
@@ -16,14 +18,18 @@ type urlProvider struct {
 	metricsFetcher UrlMetricsFetcher
 }
 
-func (p *urlProvider) Get() ([]models.Metrics, error) {
-	data, err := p.metricsFetcher.Get()
+func (p *urlProvider) Get(ctx context.Context) ([]models.Metrics, error) {
+	data, err := p.metricsFetcher.Get(ctx)
 	if err != nil {
 		return nil, err
 	}
 	data = append(data, byte('\n'))
 	r := bytes.NewReader(data)
-	metrics, err := parser.ParseMetrics(r)
+	contentType := ""
+	if f, ok := p.metricsFetcher.(ContentTypeAware); ok {
+		contentType = f.ContentType()
+	}
+	metrics, err := parser.ParseMetricsWithContentType(r, contentType)
 	if err != nil {
 		return nil, err
 	}
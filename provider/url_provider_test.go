@@ -1,6 +1,7 @@
 package provider
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -14,7 +15,7 @@ func Test_urlProvider(t *testing.T) {
 	}
 	p, err := newUrlProvider(metricsFetcher)
 	require.NoError(t, err)
-	metrics, err := p.Get()
+	metrics, err := p.Get(context.Background())
 	require.NoError(t, err)
 	actual := metricsToString(metrics)
 	expectedData, _ := os.ReadFile("testdata/metrics1_sorted.txt")
@@ -26,6 +27,6 @@ type metricsFetcherMock struct {
 	filename string
 }
 
-func (f metricsFetcherMock) Get() ([]byte, error) {
+func (f metricsFetcherMock) Get(_ context.Context) ([]byte, error) {
 	return os.ReadFile(f.filename)
 }
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/eldada/metrics-viewer/models"
@@ -47,6 +48,8 @@ type index struct {
 	lastFocusedBox       tview.Primitive // Track which box had focus
 	lastSelectedBoxIndex int             // Track selected item in Selected Metrics box
 	updatingSelectedBox  bool            // Guard against recursive updates
+	refresh              chan struct{}   // Requests an update of the metrics before the next tick
+	scrollOffset         atomic.Int64    // How long ago the shown time window ends, if scrolled back
 }
 
 func NewIndex() *index {
@@ -55,6 +58,7 @@ func NewIndex() *index {
 		missingMetricsCache:  newMissingMetricsCache(),
 		items:                map[string]models.Metrics{},
 		userInteractionMutex: &sync.Mutex{},
+		refresh:              make(chan struct{}, 1),
 	}
 }
 
@@ -85,7 +89,7 @@ func (i *index) Present(ctx context.Context, interval time.Duration, prov provid
 
 	// Create the filter box
 	i.filterBox = tview.NewInputField().
-		SetLabel("Search metrics (regex): ").
+		SetLabel("Search metrics (regex or selector): ").
 		SetFieldWidth(0). // Allow full width
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
@@ -192,7 +196,7 @@ func (i *index) Present(ctx context.Context, interval time.Duration, prov provid
 
 	i.app = i.app.SetRoot(i.grid, true).SetFocus(i.currentMenu)
 	go i.updateMenuOnGrid(ctx, interval)
-	i.replaceMenuContentOnGrid()
+	i.replaceMenuContentOnGrid(ctx)
 	i.app.SetAfterDrawFunc(func(screen tcell.Screen) {
 		i.drawing = true
 	})
@@ -206,6 +210,14 @@ func (i *index) Present(ctx context.Context, interval time.Duration, prov provid
 				i.app.SetFocus(i.filterBox)
 				return nil
 			}
+			if event.Rune() == 'r' && !i.isFilterActive {
+				i.toggleCounterMode()
+				return nil
+			}
+			if (event.Rune() == '[' || event.Rune() == ']') && !i.isFilterActive {
+				i.scroll(event.Rune() == '[')
+				return nil
+			}
 		case tcell.KeyCtrlC:
 			if closer, ok := i.provider.(io.Closer); ok {
 				_ = closer.Close()
@@ -248,14 +260,16 @@ func (i *index) updateMenuOnGrid(ctx context.Context, interval time.Duration) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			i.replaceMenuContentOnGrid()
+			i.replaceMenuContentOnGrid(ctx)
+		case <-i.refresh:
+			i.replaceMenuContentOnGrid(ctx)
 		}
 	}
 }
 
 // Recreating the menu every time an update has arrived
-func (i *index) replaceMenuContentOnGrid() {
-	metrics, err := i.provider.Get()
+func (i *index) replaceMenuContentOnGrid(ctx context.Context) {
+	metrics, err := i.provider.Get(ctx)
 
 	// Store current focus and selection states
 	i.lastFocusedBox = i.app.GetFocus()
@@ -275,7 +289,7 @@ func (i *index) replaceMenuContentOnGrid() {
 		i.hasError = true
 		return
 	} else {
-		i.setSecondHeader("")
+		i.setSecondHeader(i.scrollStatus())
 	}
 
 	if i.hasError {
@@ -413,12 +427,23 @@ func (i *index) generateMenu() *tview.List {
 	}
 	sort.Strings(nonSelectedItems)
 
-	// Get current filter text
+	// Get current filter text, either a regex or a selector like name{label="x"}.
+	// An incomplete selector (while still typing) is handled as a regex.
 	filterText := i.filterBox.GetText()
+	matchesFilter := func(name string) bool {
+		return textContains(name, filterText)
+	}
+	if provider.IsSelector(filterText) {
+		if selector, err := provider.ParseSelector(filterText); err == nil {
+			matchesFilter = func(name string) bool {
+				return selector.Matches(i.items[name])
+			}
+		}
+	}
 
 	// Add non-selected items (filtered)
 	for _, name := range nonSelectedItems {
-		if filterText == "" || textContains(name, filterText) {
+		if filterText == "" || matchesFilter(name) {
 			menu.AddItem(name, "", 0, nil)
 		}
 	}
@@ -458,11 +483,7 @@ func (i *index) selectedFunc(name string) {
 
 	i.toggleSelected(name)
 
-	_, _, width, height := i.mainContent.GetInnerRect()
-	summary, selectedMetrics := i.selectedToList()
-	res := NewGraph().SprintOnce(width, height, selectedMetrics...)
-	i.mainContent.SetText(replaceColors(res))
-	i.setRightPane(summary)
+	i.redrawGraph()
 	i.hasError = false
 
 	// Update both boxes
@@ -495,6 +516,70 @@ func (i *index) selectedFunc(name string) {
 	}
 }
 
+// Drawing the graph and the summary of the selected items
+func (i *index) redrawGraph() {
+	_, _, width, height := i.mainContent.GetInnerRect()
+	summary, selectedMetrics := i.selectedToList()
+	res := NewGraph().SprintOnce(width, height, selectedMetrics...)
+	i.mainContent.SetText(replaceColors(res))
+	i.setRightPane(summary)
+}
+
+// Switching the counter mode (raw, rate, increase) of the highlighted metric, if supported by the provider
+func (i *index) toggleCounterMode() {
+	switcher, ok := i.provider.(provider.CounterModeSwitcher)
+	if !ok {
+		return
+	}
+	i.userInteractionMutex.Lock()
+	defer i.userInteractionMutex.Unlock()
+	menu := i.currentMenu
+	if i.app.GetFocus() == i.selectedMetricsBox {
+		menu = i.selectedMetricsBox
+	}
+	if menu.GetItemCount() == 0 {
+		return
+	}
+	name, _ := menu.GetItemText(menu.GetCurrentItem())
+	name = i.cleanItemName(name)
+	if _, ok := switcher.ToggleCounterMode(name); !ok {
+		return
+	}
+	// The values shown so far are in the previous mode, new ones will arrive on the next update
+	if item, found := i.items[name]; found {
+		item.Metrics = nil
+		i.items[name] = item
+	}
+	i.redrawGraph()
+}
+
+// Scrolling the time window back or forward in time, if supported by the provider
+func (i *index) scroll(back bool) {
+	scroller, ok := i.provider.(provider.TimeScroller)
+	if !ok {
+		return
+	}
+	offset, ok := scroller.Scroll(back)
+	if !ok {
+		return
+	}
+	i.scrollOffset.Store(int64(offset))
+	i.setSecondHeader(i.scrollStatus())
+	// The metrics of the new time window are shown without waiting for the next tick
+	select {
+	case i.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (i *index) scrollStatus() string {
+	offset := time.Duration(i.scrollOffset.Load())
+	if offset <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("[yellow]Showing the time window ending %s ago; use '[' and ']' to scroll back and forward in time[-]", offset)
+}
+
 // Inverting a menu item selection
 func (i *index) toggleSelected(name string) {
 	i.userInteractionMutex.Lock()
@@ -598,9 +683,23 @@ func (i *index) selectedToList() (string, []models.Metrics) {
 			desc = "No description"
 		}
 		summaryToAdd += fmt.Sprintf("%s%s[-]\n", colors[selectedIndex], desc)
+		if item.Type != "" {
+			summaryToAdd += fmt.Sprintf("%sType:    %s[-]\n", colors[selectedIndex], item.Type)
+		}
+		if item.Unit != "" {
+			summaryToAdd += fmt.Sprintf("%sUnit:    %s[-]\n", colors[selectedIndex], item.Unit)
+		}
+		if switcher, ok := i.provider.(provider.CounterModeSwitcher); ok {
+			if mode, ok := switcher.CounterMode(val); ok {
+				summaryToAdd += fmt.Sprintf("%sMode:    %s[-]\n", colors[selectedIndex], mode)
+			}
+		}
 		summaryToAdd += fmt.Sprintf("%sMax:     %f[-]\n", colors[selectedIndex], findMaxMetricValue(item.Metrics))
 		summaryToAdd += fmt.Sprintf("%sMin:     %f[-]\n", colors[selectedIndex], findMinMetricValue(item.Metrics))
 		summaryToAdd += fmt.Sprintf("%sCurrent: %f[-]\n", colors[selectedIndex], findCurrentMetricValue(item.Metrics))
+		if exemplar := findCurrentExemplar(item.Metrics); exemplar != nil {
+			summaryToAdd += fmt.Sprintf("%sExemplar: %s %f[-]\n", colors[selectedIndex], tview.Escape(formatLabels(exemplar.Labels)), exemplar.Value)
+		}
 		selectedSummary = append(selectedSummary, fmt.Sprintf("%s%s[-]", colors[selectedIndex], summaryToAdd))
 	}
 
@@ -642,6 +741,29 @@ func findCurrentMetricValue(metrics []models.Metric) float64 {
 	return metrics[len(metrics)-1].Value
 }
 
+// Finding the exemplar of the most recent metric having one, if any
+func findCurrentExemplar(metrics []models.Metric) *models.Exemplar {
+	for idx := len(metrics) - 1; idx >= 0; idx-- {
+		if metrics[idx].Exemplar != nil {
+			return metrics[idx].Exemplar
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, labels[k]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
 func (i *index) addItemToMenu(m models.Metrics) {
 	// Store the metric in items map
 	i.items[m.Name] = m
@@ -31,7 +31,7 @@ var defaultMetrics = []models.Metrics{{
 	Name:        "hello_abc",
 }}
 
-func (m mockProvider) Get() ([]models.Metrics, error) {
+func (m mockProvider) Get(_ context.Context) ([]models.Metrics, error) {
 	if m.error {
 		return nil, errors.New("error")
 	}
@@ -431,7 +431,7 @@ func Test_index_replaceMenuContentOnGrid(t *testing.T) {
 				}()
 
 				log.Printf("Calling replaceMenuContentOnGrid")
-				i.replaceMenuContentOnGrid()
+				i.replaceMenuContentOnGrid(ctx)
 				log.Printf("Finished replaceMenuContentOnGrid")
 			}()
 
@@ -520,7 +520,7 @@ func Test_index_searchbar(t *testing.T) {
 		},
 		selectedMetricsBox:   tview.NewList(),
 		userInteractionMutex: &sync.Mutex{},
-		filterBox:            tview.NewInputField().SetLabel("Search metrics (regex): "),
+		filterBox:            tview.NewInputField().SetLabel("Search metrics (regex or selector): "),
 	}
 
 	done := make(chan struct{})
@@ -539,3 +539,43 @@ func Test_index_searchbar(t *testing.T) {
 		// Test completed successfully
 	}
 }
+
+func Test_index_searchbarWithSelector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	i := &index{
+		grid: tview.NewGrid(),
+		app:  newMockApplication().Application,
+		items: map[string]models.Metrics{
+			`foo{a="1"}`: {Key: "foo", Name: `foo{a="1"}`, Metrics: []models.Metric{{Labels: map[string]string{"a": "1"}}}},
+			`foo{a="2"}`: {Key: "foo", Name: `foo{a="2"}`, Metrics: []models.Metric{{Labels: map[string]string{"a": "2"}}}},
+			`bar{a="1"}`: {Key: "bar", Name: `bar{a="1"}`, Metrics: []models.Metric{{Labels: map[string]string{"a": "1"}}}},
+		},
+		selectedMetricsBox:   tview.NewList(),
+		userInteractionMutex: &sync.Mutex{},
+		filterBox:            tview.NewInputField().SetLabel("Search metrics (regex or selector): "),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		i.currentMenu = i.generateMenu()
+		i.filterBox.SetText(`foo{a!="2"}`)
+		i.refreshMenuAccordingToFilterInput()
+		if assert.Equal(t, 1, i.currentMenu.GetItemCount()) {
+			name, _ := i.currentMenu.GetItemText(0)
+			assert.Equal(t, `foo{a="1"}`, name)
+		}
+		i.filterBox.SetText(`{a=~"1"}`)
+		i.refreshMenuAccordingToFilterInput()
+		assert.Equal(t, 2, i.currentMenu.GetItemCount()) // Both foo and bar with a="1"
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Test timed out")
+	case <-done:
+		// Test completed successfully
+	}
+}